@@ -8,7 +8,7 @@ import (
 
 var _ = API("webhooks", func() {
 	Title("Webhooks Service")
-	Description("<h3>How does it work</h3>\n<ol>\n    <li> register a webhook using <code>POST /webhook</code> endpoint. You will receive a URL with <code>HASH</code> where you can send data It\n        requires:\n        <ul>\n            <li>STORAGE token in Keboola</li>\n            <li>name of table where the data should be stored in. If it doesn't exists, it will be created</li>\n            <li>Optionaly you can define Conditions</li>\n        </ul>\n    </li>\n    <li>\n        Then you can send data on the provided URL <code>POST /webhook/HASH/import</code>\n    </li>\n    <li>\n        Based on Conditions, the webhook app sends provided data to specified table in Keboola\n    </li>\n    <li>You can send the data to Keboola manualy calling <code>POST /webhook/HASH/flush</code>.</li>\n</ol>\n<h4>\n    Conditions\n</h4>\n<ul>\n    <li> Webhook service sends the data to Keboola if one of the following condition complies\n   <ul>\n       <li><b>time</b> - each X seconds/minutes</li>\n       <li><b>size</b> - in bulk of X KB/MB</li>\n       <li><b>rows</b> - in bulk of N rows. <b>Default value is 1000</b></li>\n   </ul>\n    </li>\n    <li>You can specify this conditions when registering the webhook using <code>POST /webhook</code> endpoint or update it using <code>PUT\n        /webhook/{hash}</code></li>\n\n</ul>")
+	Description("<h3>How does it work</h3>\n<ol>\n    <li> register a webhook using <code>POST /webhook</code> endpoint. You will receive a URL with <code>HASH</code> where you can send data It\n        requires:\n        <ul>\n            <li>STORAGE token in Keboola</li>\n            <li>Storage API host of the project stack, if it is not the default stack of the service</li>\n            <li>name of table where the data should be stored in. If it doesn't exists, it will be created</li>\n            <li>Optionaly you can define Conditions</li>\n        </ul>\n    </li>\n    <li>\n        Then you can send data on the provided URL <code>POST /webhook/HASH/import</code>.\n        Other HTTP methods (GET, PUT, PATCH) can be enabled by the <code>methods</code> option. Query parameters of a GET request are stored as the body.\n        Form bodies (<code>application/x-www-form-urlencoded</code>, <code>multipart/form-data</code>) are stored as a JSON object, uploaded files are stored in Keboola File Storage and replaced by their file IDs.\n        XML bodies are converted to JSON if the <code>bodyFormat</code> option is set to <code>xml</code>.\n        JSON bodies can be stored flattened to columns by the <code>flatten</code> option.\n        CloudEvents are accepted if the <code>cloudEvents</code> option is enabled.\n        If a JSON Schema is set by the <code>schema</code> option, requests with an invalid body are rejected.\n        A repeated delivery of the same event can be skipped by the <code>idempotency</code> option.\n        The time of the event can be read from the request by the <code>eventTime</code> option.\n    </li>\n    <li>\n        Based on Conditions, the webhook app sends provided data to specified table in Keboola.\n        Records can be appended, upserted by the primary key or the table content can be replaced, see the <code>loadType</code> and <code>primaryKey</code> options.\n        Data can be imported to a development branch by the <code>branchId</code> option.\n        A new table is created with native column types declared by the <code>columnTypes</code> option, the <code>description</code> is stored in the table metadata.\n        Events can be sent to different tables based on a header or the body by the <code>routes</code> option.\n        Unwanted events can be dropped by the <code>dropRules</code> and <code>sampleRate</code> options, see <code>GET /webhook/HASH/stats</code>.\n        A Keboola flow or another component job can be run after a successful import by the <code>trigger</code> option.\n    </li>\n    <li>You can send the data to Keboola manualy calling <code>POST /webhook/HASH/flush</code>.</li>\n    <li>Each accepted record gets a receipt ID, its status can be checked by <code>GET /webhook/HASH/receipts/ID</code>.</li>\n</ol>\n<h4>\n    Conditions\n</h4>\n<ul>\n    <li> Webhook service sends the data to Keboola if one of the following condition complies\n   <ul>\n       <li><b>time</b> - each X seconds/minutes</li>\n       <li><b>size</b> - in bulk of X KB/MB</li>\n       <li><b>rows</b> - in bulk of N rows. <b>Default value is 1000</b></li>\n   </ul>\n    </li>\n    <li>You can specify this conditions when registering the webhook using <code>POST /webhook</code> endpoint or update it using <code>PUT\n        /webhook/{hash}</code></li>\n    <li>The update changes only the sent settings, the conditions and other settings not sent are kept.</li>\n\n</ul>")
 	Version("1.0")
 	HTTP(func() {
 		Consumes("application/json")
@@ -52,6 +52,149 @@ var conditions = Type("conditions", func() {
 	})
 })
 
+var methods = ArrayOf(String, func() {
+	Enum("GET", "POST", "PUT", "PATCH")
+})
+
+var responseType = Type("responseType", String, func() {
+	Description("Response returned from the import URL. \"json\" returns the import result, \"pixel\" returns a transparent 1x1 GIF. Default is \"json\".")
+	Enum("json", "pixel")
+	Example("pixel")
+})
+
+var bodyFormat = Type("bodyFormat", String, func() {
+	Description("Format of the request body. \"auto\" stores JSON and text bodies as they are and converts form bodies to JSON, \"xml\" converts XML bodies to JSON. Default is \"auto\".")
+	Enum("auto", "xml")
+	Example("xml")
+})
+
+const schemaDesc = "JSON Schema of the request body. Requests with an invalid body are rejected with 422 status code. Use an empty string to remove the schema."
+
+const flattenDesc = "Store the JSON body flattened to columns, for example \"customer__address__city\", instead of the \"body\" column. New columns are added to the table. Requests with a body which is not a JSON object, or with keys converted to the same column name, for example \"a-b\" and \"a_b\", are rejected."
+
+const addColumnsDesc = "Add columns missing in the existing table before import. If disabled, the import fails and the records are returned to the buffer. Default is true."
+
+var loadType = Type("loadType", String, func() {
+	Description("How are the records loaded to the table. \"append\" adds new rows, \"upsert\" updates rows with the same primary key and adds new rows, \"replace\" replaces the table content. Default is \"append\".")
+	Enum("append", "upsert", "replace")
+	Example("upsert")
+})
+
+const primaryKeyDesc = "Primary key columns of the table. It is required for the \"upsert\" load type. The columns must be written by the webhook: \"timestamp\", \"headers\", \"body\", CloudEvents columns or flattened columns, see the \"flatten\" option. Use an empty array to remove the primary key."
+
+const createPrimaryKeyDesc = "Create a new table with the primary key. Default is false."
+
+var columnType = Type("columnType", func() {
+	Description("Native type of the column, it is used when the table is created.")
+	Attribute("name", String, "Column name.", func() {
+		Example("amount")
+	})
+	Attribute("type", String, "Native type of the column in the project backend.", func() {
+		Example("NUMBER")
+	})
+	Attribute("length", String, "Length of the type.", func() {
+		Example("12,2")
+	})
+	Attribute("nullable", Boolean, "Column can contain null. Default is true.", func() {
+		Example(false)
+	})
+	Required("name", "type")
+})
+
+const columnTypesDesc = "Native types of the columns, they are used when the table is created. Other columns are created as strings. Use an empty array to remove the types."
+
+const tableDescriptionDesc = "Description of the table, it is stored to the table metadata when the table is created."
+
+const storageApiHostDesc = "Storage API host of the project stack. It must be one of the hosts allowed by the service. Default is the default host of the service."
+
+const branchIdDesc = "ID of the development branch where the data are imported. Use 0 for the default branch. Default is 0."
+
+const cloudEventsDesc = "Accept CloudEvents 1.0 in binary or structured content mode. Event id, source, type, subject and time are stored in separate columns."
+
+var idempotency = Type("idempotency", func() {
+	Description("Detection of a repeated delivery of the same event. A repeated delivery received within the window is not stored again.")
+	Attribute("source", String, "Source of the idempotency key. Use \"none\" to disable the detection.", func() {
+		Enum("header", "jsonPath", "bodyHash", "none")
+		Example("header")
+	})
+	Attribute("key", String, "Header name or JSON path in the body, not used for \"bodyHash\".", func() {
+		Example("X-GitHub-Delivery")
+	})
+	Attribute("window", String, "How long is the key remembered. Default is 24h, max is 168h.", func() {
+		Example("24h")
+	})
+	Required("source")
+})
+
+var eventTime = Type("eventTime", func() {
+	Description("Time of the event in the request. It is stored in the \"timestamp\" column and the receive time is stored in the \"received_at\" column. The receive time is used if the value is missing.")
+	Attribute("source", String, "Source of the event time. Use \"none\" to use the receive time.", func() {
+		Enum("header", "jsonPath", "none")
+		Example("jsonPath")
+	})
+	Attribute("key", String, "Header name or JSON path in the body.", func() {
+		Example("data.created_at")
+	})
+	Attribute("format", String, "Format of the event time. Default is \"rfc3339\".", func() {
+		Enum("rfc3339", "unix", "unixMs")
+		Example("unix")
+	})
+	Required("source")
+})
+
+var trigger = Type("trigger", func() {
+	Description("Keboola Queue job created after a successful import, for example a flow run.")
+	Attribute("componentId", String, "ID of the component. Use an empty string to remove the trigger.", func() {
+		Example("keboola.orchestrator")
+	})
+	Attribute("configId", String, "ID of the configuration.", func() {
+		Example("123456")
+	})
+	Attribute("minInterval", String, "Minimal interval between two jobs, an import within the interval doesn't create a job. Default is 0s.", func() {
+		Example("15m")
+	})
+	Required("componentId")
+})
+
+var route = Type("route", func() {
+	Description("Routing rule. The event is stored to the table, if the header or the JSON path value is equal to the value.")
+	Attribute("source", String, "Source of the compared value.", func() {
+		Enum("header", "jsonPath")
+		Example("header")
+	})
+	Attribute("key", String, "Header name or JSON path in the body.", func() {
+		Example("X-GitHub-Event")
+	})
+	Attribute("value", String, "Expected value.", func() {
+		Example("push")
+	})
+	Attribute("tableId", String, "ID of table where the matching events are stored.", func() {
+		Example("in.c-github.push")
+	})
+	Required("source", "key", "value", "tableId")
+})
+
+var dropRule = Type("dropRule", func() {
+	Description("Drop rule. The event is not stored, if the header or the JSON path value is equal to the value.")
+	Attribute("source", String, "Source of the compared value.", func() {
+		Enum("header", "jsonPath")
+		Example("header")
+	})
+	Attribute("key", String, "Header name or JSON path in the body.", func() {
+		Example("X-GitHub-Event")
+	})
+	Attribute("value", String, "Value of the dropped events.", func() {
+		Example("ping")
+	})
+	Required("source", "key", "value")
+})
+
+const dropRulesDesc = "Drop rules, events matching any rule are not stored. Use an empty array to remove the rules."
+
+const sampleRateDesc = "Fraction of the events which are stored, other events are dropped. Default is 1, all events are stored."
+
+const routesDesc = "Routing rules, the first matching rule wins. Events that don't match any rule are stored to the webhook table. Use an empty array to remove the rules."
+
 var importResult = ResultType("application/vnd.webhooks.import.result", func() {
 	Description("Import result")
 	TypeName("ImportResult")
@@ -60,7 +203,55 @@ var importResult = ResultType("application/vnd.webhooks.import.result", func() {
 		Attribute("recordsInBatch", UInt, "Number of records that have not yet been imported into the table.", func() {
 			Example(123)
 		})
-		Required("recordsInBatch")
+		Attribute("duplicates", UInt, "Number of records skipped as a repeated delivery.", func() {
+			Example(0)
+		})
+		Attribute("receipts", ArrayOf(String), "Receipt ID of each accepted record. A repeated delivery gets the receipt of the original delivery.", func() {
+			Example([]string{"V1StGXR8_Z5jdHi6B-myT"})
+		})
+		Attribute("dropped", UInt, "Number of records dropped by drop rules or by sampling.", func() {
+			Example(0)
+		})
+		Required("recordsInBatch", "duplicates", "receipts", "dropped")
+	})
+})
+
+var receiptResult = ResultType("application/vnd.webhooks.receipt.result", func() {
+	Description("Delivery receipt")
+	TypeName("ReceiptResult")
+
+	Attributes(func() {
+		Attribute("id", String, "Receipt ID", func() {
+			Example("V1StGXR8_Z5jdHi6B-myT")
+		})
+		Attribute("status", String, "Status of the record: buffered, importing (in an import batch), imported or failed. A record of a failed import is buffered again and retried, it is failed after 5 failed imports.", func() {
+			Enum("buffered", "importing", "imported", "failed")
+			Example("imported")
+		})
+		Attribute("receivedAt", String, "Time when the record was received.", func() {
+			Format(FormatDateTime)
+			Example("2022-03-10T12:00:00Z")
+		})
+		Attribute("batchId", String, "ID of the import batch.", func() {
+			Example("4f9SOxSjmqQ8Ty7F2RWvK")
+		})
+		Attribute("jobId", Int, "ID of the Storage job which imports the batch, it is set as soon as the job is created.", func() {
+			Example(123456)
+		})
+		Attribute("error", String, "Error message, if the import failed.", func() {
+			Example("cannot upload file: timeout")
+		})
+		Attribute("triggerStatus", String, "Status of the job created after the import: triggered, skipped (within the minimal interval) or failed.", func() {
+			Enum("triggered", "skipped", "failed")
+			Example("triggered")
+		})
+		Attribute("triggerJobId", String, "ID of the Queue job created after the import.", func() {
+			Example("123456789")
+		})
+		Attribute("triggerError", String, "Error message, if the job could not be created.", func() {
+			Example("configuration not found")
+		})
+		Required("id", "status", "receivedAt")
 	})
 })
 
@@ -76,11 +267,54 @@ var registerResult = ResultType("application/vnd.webhooks.register.result", func
 	})
 })
 
+var statsResult = ResultType("application/vnd.webhooks.stats.result", func() {
+	Description("Statistics of the received events")
+	TypeName("StatsResult")
+
+	Attributes(func() {
+		Attribute("received", UInt64, "Number of all received records, including dropped and duplicate records.", func() {
+			Example(1000)
+		})
+		Attribute("dropped", UInt64, "Number of records dropped by drop rules or by sampling.", func() {
+			Example(900)
+		})
+		Attribute("duplicates", UInt64, "Number of records skipped as a repeated delivery.", func() {
+			Example(10)
+		})
+		Attribute("recordsInBatch", UInt, "Number of records that have not yet been imported into the table.", func() {
+			Example(90)
+		})
+		Required("received", "dropped", "duplicates", "recordsInBatch")
+	})
+})
+
 var updateResult = ResultType("application/vnd.webhooks.update.result", func() {
 	Description("Update result")
 	TypeName("UpdateResult")
 	Attribute("conditions", conditions)
-	Required("conditions")
+	Attribute("methods", methods, "HTTP methods accepted on the import URL.", func() {
+		Example([]string{"POST", "GET"})
+	})
+	Attribute("response", responseType)
+	Attribute("bodyFormat", bodyFormat)
+	Attribute("cloudEvents", Boolean, cloudEventsDesc)
+	Attribute("schema", String, schemaDesc)
+	Attribute("idempotency", idempotency)
+	Attribute("eventTime", eventTime)
+	Attribute("routes", ArrayOf(route), routesDesc)
+	Attribute("dropRules", ArrayOf(dropRule), dropRulesDesc)
+	Attribute("sampleRate", Float64, sampleRateDesc)
+	Attribute("flatten", Boolean, flattenDesc)
+	Attribute("addColumns", Boolean, addColumnsDesc)
+	Attribute("primaryKey", ArrayOf(String), primaryKeyDesc)
+	Attribute("loadType", loadType)
+	Attribute("createPrimaryKey", Boolean, createPrimaryKeyDesc)
+	Attribute("columnTypes", ArrayOf(columnType), columnTypesDesc)
+	Attribute("description", String, tableDescriptionDesc)
+	Attribute("trigger", trigger)
+	Attribute("branchId", Int, branchIdDesc)
+	Attribute("storageApiHost", String, storageApiHostDesc)
+	Required("conditions", "methods", "response", "bodyFormat", "cloudEvents", "routes", "dropRules", "sampleRate", "flatten", "addColumns", "primaryKey", "loadType", "createPrimaryKey", "columnTypes", "description", "branchId", "storageApiHost")
 })
 
 var _ = Service("webhooks", func() {
@@ -120,7 +354,51 @@ var _ = Service("webhooks", func() {
 			Attribute("token", String, "Storage token to the project", func() {
 				Example("my-storage-api-token")
 			})
+			Attribute("storageApiHost", String, storageApiHostDesc, func() {
+				Example("connection.eu-central-1.keboola.com")
+			})
 			Attribute("conditions", conditions)
+			Attribute("methods", methods, "HTTP methods accepted on the import URL.", func() {
+				Example([]string{"POST", "GET"})
+			})
+			Attribute("response", responseType)
+			Attribute("bodyFormat", bodyFormat)
+			Attribute("cloudEvents", Boolean, cloudEventsDesc, func() {
+				Example(true)
+			})
+			Attribute("schema", String, schemaDesc, func() {
+				Example(`{"type": "object", "required": ["id"]}`)
+			})
+			Attribute("idempotency", idempotency)
+			Attribute("eventTime", eventTime)
+			Attribute("routes", ArrayOf(route), routesDesc)
+			Attribute("dropRules", ArrayOf(dropRule), dropRulesDesc)
+			Attribute("sampleRate", Float64, sampleRateDesc, func() {
+				Minimum(0)
+				Maximum(1)
+				Example(0.1)
+			})
+			Attribute("flatten", Boolean, flattenDesc, func() {
+				Example(true)
+			})
+			Attribute("addColumns", Boolean, addColumnsDesc, func() {
+				Example(true)
+			})
+			Attribute("primaryKey", ArrayOf(String), primaryKeyDesc, func() {
+				Example([]string{"id"})
+			})
+			Attribute("loadType", loadType)
+			Attribute("createPrimaryKey", Boolean, createPrimaryKeyDesc, func() {
+				Example(true)
+			})
+			Attribute("columnTypes", ArrayOf(columnType), columnTypesDesc)
+			Attribute("description", String, tableDescriptionDesc, func() {
+				Example("Orders from the e-shop.")
+			})
+			Attribute("trigger", trigger)
+			Attribute("branchId", Int, branchIdDesc, func() {
+				Example(123)
+			})
 			Required("tableId", "token")
 		})
 		Result(registerResult)
@@ -139,13 +417,54 @@ var _ = Service("webhooks", func() {
 	})
 
 	Method("update", func() {
-		Meta("swagger:summary", "Update conditions of the webhook.")
+		Meta("swagger:summary", "Update settings of the webhook.")
 		Payload(func() {
 			Field(1, "hash", String, "Authorization hash", func() {
 				Example("yljBSN5QmXRXFFs5Y7GEY")
 			})
 			Attribute("conditions", conditions)
-			Required("hash", "conditions")
+			Attribute("methods", methods, "HTTP methods accepted on the import URL.", func() {
+				Example([]string{"POST", "GET"})
+			})
+			Attribute("response", responseType)
+			Attribute("bodyFormat", bodyFormat)
+			Attribute("cloudEvents", Boolean, cloudEventsDesc, func() {
+				Example(true)
+			})
+			Attribute("schema", String, schemaDesc, func() {
+				Example(`{"type": "object", "required": ["id"]}`)
+			})
+			Attribute("idempotency", idempotency)
+			Attribute("eventTime", eventTime)
+			Attribute("routes", ArrayOf(route), routesDesc)
+			Attribute("dropRules", ArrayOf(dropRule), dropRulesDesc)
+			Attribute("sampleRate", Float64, sampleRateDesc, func() {
+				Minimum(0)
+				Maximum(1)
+				Example(0.1)
+			})
+			Attribute("flatten", Boolean, flattenDesc, func() {
+				Example(true)
+			})
+			Attribute("addColumns", Boolean, addColumnsDesc, func() {
+				Example(true)
+			})
+			Attribute("primaryKey", ArrayOf(String), primaryKeyDesc, func() {
+				Example([]string{"id"})
+			})
+			Attribute("loadType", loadType)
+			Attribute("createPrimaryKey", Boolean, createPrimaryKeyDesc, func() {
+				Example(true)
+			})
+			Attribute("columnTypes", ArrayOf(columnType), columnTypesDesc)
+			Attribute("description", String, tableDescriptionDesc, func() {
+				Example("Orders from the e-shop.")
+			})
+			Attribute("trigger", trigger)
+			Attribute("branchId", Int, branchIdDesc, func() {
+				Example(123)
+			})
+			Required("hash")
 		})
 		Result(updateResult)
 		Error("WebhookNotFoundError", func() {
@@ -180,10 +499,18 @@ var _ = Service("webhooks", func() {
 			})
 			Required("message")
 		})
+		Error("ImportInProgressError", func() {
+			Description("Error returned when the webhook is being imported, by this or another API replica.")
+			Attribute("message", func() {
+				Example("Import of the webhook \"<hash>\" is in progress.")
+			})
+			Required("message")
+		})
 		HTTP(func() {
 			POST("webhook/{hash}/flush")
 			Response(StatusOK)
 			Response("WebhookNotFoundError", StatusNotFound)
+			Response("ImportInProgressError", StatusConflict)
 		})
 	})
 
@@ -203,11 +530,106 @@ var _ = Service("webhooks", func() {
 			})
 			Required("message")
 		})
+		Error("BadRequestError", func() {
+			Description("Error returned when the request body cannot be parsed.")
+			Attribute("message", func() {
+				Example("Cannot parse form body: invalid URL escape \"%zz\".")
+			})
+			Required("message")
+		})
+		Error("InvalidPayloadError", func() {
+			Description("Error returned when the request body does not match the JSON Schema of the webhook.")
+			Attribute("message", String, func() {
+				Example("Request body does not match the webhook schema.")
+			})
+			Attribute("errors", ArrayOf(String), "Validation errors.", func() {
+				Example([]string{"/id: expected integer, but got string"})
+			})
+			Required("message", "errors")
+		})
+		Error("MethodNotAllowedError", func() {
+			Description("Error returned when the webhook does not accept the HTTP method.")
+			Attribute("message", func() {
+				Example("Method \"GET\" is not allowed for webhook \"<hash>\".")
+			})
+			Required("message")
+		})
+		Error("UpstreamError", func() {
+			Description("Error returned when a file from the multipart body cannot be uploaded to the file storage.")
+			Attribute("message", func() {
+				Example("Cannot upload file \"invoice.pdf\" to the file storage, please try again later.")
+			})
+			Required("message")
+		})
 		HTTP(func() {
+			GET("webhook/{hash}/import")
 			POST("webhook/{hash}/import")
+			PUT("webhook/{hash}/import")
+			PATCH("webhook/{hash}/import")
 			SkipRequestBodyEncodeDecode()
 			Response(StatusOK)
+			Response("BadRequestError", StatusBadRequest)
+			Response("WebhookNotFoundError", StatusNotFound)
+			Response("MethodNotAllowedError", StatusMethodNotAllowed)
+			Response("InvalidPayloadError", StatusUnprocessableEntity)
+			Response("UpstreamError", StatusBadGateway)
+		})
+	})
+
+	Method("stats", func() {
+		Meta("swagger:summary", "Get statistics of the received events.")
+		Payload(func() {
+			Field(1, "hash", String, "Authorization hash", func() {
+				Example("yljBSN5QmXRXFFs5Y7GEY")
+			})
+			Required("hash")
+		})
+		Result(statsResult)
+		Error("WebhookNotFoundError", func() {
+			Description("Error returned when no webhook was found under the specified hash.")
+			Attribute("message", func() {
+				Example("Webhook with hash \"<hash>\" not found.")
+			})
+			Required("message")
+		})
+		HTTP(func() {
+			GET("webhook/{hash}/stats")
+			Response(StatusOK)
+			Response("WebhookNotFoundError", StatusNotFound)
+		})
+	})
+
+	Method("receipt", func() {
+		Meta("swagger:summary", "Get status of an accepted record.")
+		Payload(func() {
+			Field(1, "hash", String, "Authorization hash", func() {
+				Example("yljBSN5QmXRXFFs5Y7GEY")
+			})
+			Field(2, "id", String, "Receipt ID", func() {
+				Example("V1StGXR8_Z5jdHi6B-myT")
+			})
+			Required("hash", "id")
+		})
+		Result(receiptResult)
+		Error("WebhookNotFoundError", func() {
+			Description("Error returned when no webhook was found under the specified hash.")
+			Attribute("message", func() {
+				Example("Webhook with hash \"<hash>\" not found.")
+			})
+			Required("message")
+		})
+		Error("ReceiptNotFoundError", func() {
+			Description("Error returned when no receipt was found under the specified ID.")
+			Attribute("message", func() {
+				Example("Receipt \"<id>\" not found.")
+			})
+			Required("message")
+		})
+		HTTP(func() {
+			GET("webhook/{hash}/receipts/{id}")
+			Response(StatusOK)
 			Response("WebhookNotFoundError", StatusNotFound)
+			Response("ReceiptNotFoundError", StatusNotFound)
 		})
 	})
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -28,7 +29,7 @@ func handleHTTPServer(ctx context.Context, wg *sync.WaitGroup, u *url.URL, endpo
 	// Other encodings can be used by providing the corresponding functions,
 	// see goa.design/implement/encoding.
 	dec := goaHTTP.RequestDecoder
-	enc := goaHTTP.ResponseEncoder
+	enc := responseEncoder
 
 	// Build the service HTTP request multiplexer and configure it to serve
 	// HTTP requests to the service endpoints.
@@ -57,7 +58,10 @@ func handleHTTPServer(ctx context.Context, wg *sync.WaitGroup, u *url.URL, endpo
 	handler = httpMiddleware.RequestID()(handler)
 	handler = func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), service.HeadersCtxKey, r.Header)))
+			ctx := context.WithValue(r.Context(), service.HeadersCtxKey, r.Header)
+			ctx = context.WithValue(ctx, service.RequestCtxKey, r)
+			ctx = context.WithValue(ctx, service.ResponseCtxKey, &service.Response{})
+			h.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}(handler)
 
@@ -91,6 +95,27 @@ func handleHTTPServer(ctx context.Context, wg *sync.WaitGroup, u *url.URL, endpo
 	}()
 }
 
+// responseEncoder returns the default goa encoder,
+// or an encoder writing the raw body, if the service has replaced the response, see service.Response.
+func responseEncoder(ctx context.Context, w http.ResponseWriter) goaHTTP.Encoder {
+	if r, ok := ctx.Value(service.ResponseCtxKey).(*service.Response); ok && r.IsReplaced() {
+		w.Header().Set("Content-Type", r.ContentType)
+		return &rawEncoder{w: w, body: r.Body}
+	}
+	return goaHTTP.ResponseEncoder(ctx, w)
+}
+
+// rawEncoder ignores the encoded value and writes the body.
+type rawEncoder struct {
+	w    io.Writer
+	body []byte
+}
+
+func (e *rawEncoder) Encode(_ interface{}) error {
+	_, err := e.w.Write(e.body)
+	return err
+}
+
 // errorHandler returns a function that writes and logs the given error.
 // The function also writes and logs the error unique ID so that it's possible
 // to correlate.
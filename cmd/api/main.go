@@ -12,6 +12,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/keboola/temp-webhooks-api/internal/pkg/env"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
@@ -23,6 +24,7 @@ func main() {
 	httpHostF := flag.String("http-host", "0.0.0.0", "HTTP host")
 	httpPortF := flag.String("http-port", "8888", "HTTP port")
 	debugF := flag.Bool("debug", false, "Log request and response bodies")
+	shutdownTimeoutF := flag.Duration("shutdown-timeout", service.DefaultShutdownTimeout, "Max time of the graceful shutdown, the running imports are cancelled after a half of it")
 	flag.Parse()
 
 	// Setup logger.
@@ -36,13 +38,13 @@ func main() {
 	}
 
 	// Start server
-	if err := start(*httpHostF, *httpPortF, *debugF, logger, envs); err != nil {
+	if err := start(*httpHostF, *httpPortF, *debugF, *shutdownTimeoutF, logger, envs); err != nil {
 		logger.Println(err.Error())
 		os.Exit(1)
 	}
 }
 
-func start(host, port string, debug bool, logger *log.Logger, envs *env.Map) error {
+func start(host, port string, debug bool, shutdownTimeout time.Duration, logger *log.Logger, envs *env.Map) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -81,8 +83,21 @@ func start(host, port string, debug bool, logger *log.Logger, envs *env.Map) err
 	// Send cancellation signal to the goroutines.
 	cancel()
 
-	// Wait for goroutines.
-	wg.Wait()
-	logger.Println("exited")
+	// Stop new imports and drain the running imports, in parallel with the HTTP server.
+	// Shutdown waits up to twice its timeout, so it gets a half of the shutdown timeout.
+	done := make(chan struct{})
+	go func() {
+		svc.Shutdown(shutdownTimeout / 2)
+		wg.Wait()
+		close(done)
+	}()
+
+	// Wait for goroutines, at most the shutdown timeout.
+	select {
+	case <-done:
+		logger.Println("exited")
+	case <-time.After(shutdownTimeout):
+		logger.Printf("exited, the shutdown did not finish in %s", shutdownTimeout)
+	}
 	return nil
 }
@@ -0,0 +1,117 @@
+package abs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+const (
+	// BlockSize of the uploaded blob, the reader is consumed in blocks, so the content size doesn't have to be known.
+	BlockSize  = 4 * 1024 * 1024
+	ApiVersion = "2019-12-12"
+	// PartRetries is the maximum number of retries of one block.
+	PartRetries = 3
+)
+
+// Upload uploads content of the reader to the prepared file resource in Azure Blob Storage.
+// The blob is written block by block and committed by the block list, see https://docs.microsoft.com/en-us/rest/api/storageservices/put-block-list.
+// Each block is retried separately. The upload is aborted when the context is done.
+func Upload(ctx context.Context, reader io.Reader, resource model.FileResource) error {
+	params := resource.AbsUploadParams
+	endpoint, sas, err := ParseConnectionString(params.Credentials.SASConnectionString)
+	if err != nil {
+		return err
+	}
+	blobUrl := fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(endpoint, "/"), params.Container, params.BlobName)
+
+	// Upload blocks
+	var blockIds []string
+	buffer := make([]byte, BlockSize)
+	for {
+		n, readErr := io.ReadFull(reader, buffer)
+		if n > 0 {
+			block := buffer[:n]
+			blockId := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%06d", len(blockIds))))
+			query := "comp=block&blockid=" + url.QueryEscape(blockId) + "&" + sas
+			err := withRetry(ctx, func() error {
+				return send(ctx, http.MethodPut, blobUrl, query, bytes.NewReader(block))
+			})
+			if err != nil {
+				return fmt.Errorf(`cannot upload block %d: %w`, len(blockIds), err)
+			}
+			blockIds = append(blockIds, blockId)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+
+	// Commit blocks
+	var blockList strings.Builder
+	blockList.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for _, blockId := range blockIds {
+		blockList.WriteString("<Latest>" + blockId + "</Latest>")
+	}
+	blockList.WriteString(`</BlockList>`)
+	err = withRetry(ctx, func() error {
+		return send(ctx, http.MethodPut, blobUrl, "comp=blocklist&"+sas, strings.NewReader(blockList.String()))
+	})
+	if err != nil {
+		return fmt.Errorf(`cannot commit block list: %w`, err)
+	}
+	return nil
+}
+
+// ParseConnectionString returns the blob endpoint and the shared access signature from the SAS connection string.
+func ParseConnectionString(str string) (endpoint, sas string, err error) {
+	for _, part := range strings.Split(str, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "BlobEndpoint":
+			endpoint = kv[1]
+		case "SharedAccessSignature":
+			sas = strings.TrimPrefix(kv[1], "?")
+		}
+	}
+	if endpoint == "" || sas == "" {
+		return "", "", fmt.Errorf(`SAS connection string must contain "BlobEndpoint" and "SharedAccessSignature"`)
+	}
+	return endpoint, sas, nil
+}
+
+func withRetry(ctx context.Context, fn func() error) error {
+	return retry.Do(fn, retry.Context(ctx), retry.Attempts(PartRetries+1), retry.Delay(500*time.Millisecond), retry.LastErrorOnly(true))
+}
+
+func send(ctx context.Context, method, blobUrl, query string, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, method, blobUrl+"?"+query, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-ms-version", ApiVersion)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf(`%s "%s" returned http code %d: %s`, method, blobUrl, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package abs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Well-known credentials of the Azurite emulator.
+const (
+	azuriteAccount = "devstoreaccount1"
+	azuriteKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+func TestParseConnectionString(t *testing.T) {
+	t.Parallel()
+	endpoint, sas, err := ParseConnectionString("BlobEndpoint=https://account.blob.core.windows.net;SharedAccessSignature=sv=2017-11-09&sr=c&sig=abc%3D")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://account.blob.core.windows.net", endpoint)
+	assert.Equal(t, "sv=2017-11-09&sr=c&sig=abc%3D", sas)
+
+	_, _, err = ParseConnectionString("BlobEndpoint=https://account.blob.core.windows.net")
+	assert.EqualError(t, err, `SAS connection string must contain "BlobEndpoint" and "SharedAccessSignature"`)
+}
+
+func TestUpload(t *testing.T) {
+	t.Parallel()
+	lock := &sync.Mutex{}
+	blocks := make(map[string]string)
+	var blockList string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/container/file.csv", r.URL.Path)
+		assert.Equal(t, "sig", r.URL.Query().Get("sv"))
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Query().Get("comp") {
+		case "block":
+			blocks[r.URL.Query().Get("blockid")] = string(body)
+		case "blocklist":
+			blockList = string(body)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	resource := model.FileResource{Provider: model.FileProviderAzure}
+	resource.AbsUploadParams.Container = "container"
+	resource.AbsUploadParams.BlobName = "file.csv"
+	resource.AbsUploadParams.Credentials.SASConnectionString = fmt.Sprintf("BlobEndpoint=%s;SharedAccessSignature=sv=sig", server.URL)
+	assert.NoError(t, Upload(context.Background(), strings.NewReader("foo,bar\n"), resource))
+
+	blockId := base64.StdEncoding.EncodeToString([]byte("000000"))
+	assert.Equal(t, map[string]string{blockId: "foo,bar\n"}, blocks)
+	assert.Equal(t, `<?xml version="1.0" encoding="utf-8"?><BlockList><Latest>`+blockId+`</Latest></BlockList>`, blockList)
+}
+
+// TestUploadAzurite runs against the Azurite emulator, for example "http://127.0.0.1:10000/devstoreaccount1".
+func TestUploadAzurite(t *testing.T) {
+	t.Parallel()
+	endpoint := os.Getenv("TEST_AZURITE_BLOB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TEST_AZURITE_BLOB_ENDPOINT is not set")
+	}
+
+	sas := azuriteSas(t)
+	container := fmt.Sprintf("test%d", time.Now().UnixNano())
+	assert.NoError(t, send(context.Background(), http.MethodPut, endpoint+"/"+container, "restype=container&"+sas, nil))
+
+	resource := model.FileResource{Provider: model.FileProviderAzure}
+	resource.AbsUploadParams.Container = container
+	resource.AbsUploadParams.BlobName = "file.csv"
+	resource.AbsUploadParams.Credentials.SASConnectionString = fmt.Sprintf("BlobEndpoint=%s;SharedAccessSignature=%s", endpoint, sas)
+	content := strings.Repeat("foo,bar\n", BlockSize/4) // 2 blocks
+	assert.NoError(t, Upload(context.Background(), strings.NewReader(content), resource))
+
+	resp, err := http.Get(fmt.Sprintf("%s/%s/file.csv?%s", endpoint, container, sas)) // nolint:gosec // test URL
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(body))
+}
+
+// azuriteSas returns an account SAS signed by the Azurite key, see https://docs.microsoft.com/en-us/rest/api/storageservices/create-account-sas.
+func azuriteSas(t *testing.T) string {
+	t.Helper()
+	key, err := base64.StdEncoding.DecodeString(azuriteKey)
+	assert.NoError(t, err)
+
+	expiry := time.Now().UTC().Add(time.Hour).Format("2006-01-02T15:04:05Z")
+	stringToSign := strings.Join([]string{azuriteAccount, "rwdlac", "b", "sco", "", expiry, "", "https,http", ApiVersion, ""}, "\n")
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	query := url.Values{}
+	query.Set("sv", ApiVersion)
+	query.Set("ss", "b")
+	query.Set("srt", "sco")
+	query.Set("sp", "rwdlac")
+	query.Set("se", expiry)
+	query.Set("spr", "https,http")
+	query.Set("sig", signature)
+	return query.Encode()
+}
@@ -0,0 +1,67 @@
+package queueapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+// Api is a client of the Keboola Queue API, it creates component jobs, for example flow runs.
+type Api struct {
+	apiHost    string
+	apiHostUrl string
+	client     *client.Client
+	logger     log.Logger
+	token      *model.Token
+}
+
+func New(ctx context.Context, logger log.Logger, host string, verbose bool) *Api {
+	if host == "" {
+		panic(fmt.Errorf("api host is not set"))
+	}
+	apiHostUrl := "https://" + host
+	c := client.NewClient(ctx, logger, verbose).WithHostUrl(apiHostUrl)
+	c.SetError(&Error{})
+	return &Api{client: c, logger: logger, apiHost: host, apiHostUrl: apiHostUrl}
+}
+
+// HostFromStorageHost returns the Queue API host of the stack, for example "queue.keboola.com" for "connection.keboola.com".
+func HostFromStorageHost(storageHost string) string {
+	return "queue." + strings.TrimPrefix(storageHost, "connection.")
+}
+
+func (a *Api) Host() string {
+	return a.apiHost
+}
+
+func (a *Api) HostUrl() string {
+	return a.apiHostUrl
+}
+
+// WithToken returns a copy of the API, the token is sent with each request.
+func (a Api) WithToken(token model.Token) *Api {
+	a.token = &token
+	return &a
+}
+
+func (a *Api) NewRequest(method string, url string) *client.Request {
+	request := a.client.NewRequest(method, url)
+	if a.token != nil {
+		request.SetHeader("X-StorageApi-Token", a.token.Token)
+	}
+	return request
+}
+
+func (a *Api) SetRetry(count int, waitTime time.Duration, maxWaitTime time.Duration) {
+	a.client.SetRetry(count, waitTime, maxWaitTime)
+}
+
+func (a *Api) HttpClient() *http.Client {
+	return a.client.GetRestyClient().GetClient()
+}
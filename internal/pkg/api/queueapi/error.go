@@ -0,0 +1,60 @@
+package queueapi
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
+)
+
+// Error represents Queue API error structure.
+type Error struct {
+	Message     string `json:"error"`
+	ErrCode     int    `json:"code"`
+	ExceptionId string `json:"exceptionId"`
+	response    *resty.Response
+}
+
+func (e *Error) Error() string {
+	req := e.response.Request
+	msg := fmt.Sprintf(`%s, method: "%s", url: "%s", httpCode: "%d"`, e.Message, req.Method, req.URL, e.HttpStatus())
+	if len(e.ExceptionId) > 0 {
+		msg += fmt.Sprintf(`, exceptionId: "%s"`, e.ExceptionId)
+	}
+	return msg
+}
+
+func (e *Error) SetResponse(response *resty.Response) {
+	e.response = response
+}
+
+func (e *Error) HttpStatus() int {
+	return e.response.StatusCode()
+}
+
+func (e *Error) IsBadRequest() bool {
+	return e.HttpStatus() == 400
+}
+
+func (e *Error) IsUnauthorized() bool {
+	return e.HttpStatus() == 401
+}
+
+func (e *Error) IsForbidden() bool {
+	return e.HttpStatus() == 403
+}
+
+func (e *Error) IsNotFound() bool {
+	return e.HttpStatus() == 404
+}
+
+// IsThrottled returns true if the request has been rejected because of the rate limit or an overload.
+func (e *Error) IsThrottled() bool {
+	return client.IsThrottled(e.HttpStatus())
+}
+
+// RetryAfter returns the delay requested by the "Retry-After" header, or 0 if it is not set.
+func (e *Error) RetryAfter() time.Duration {
+	return client.RetryAfter(e.response)
+}
@@ -0,0 +1,29 @@
+package queueapi
+
+import (
+	"github.com/go-resty/resty/v2"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+func (a *Api) CreateJob(componentId, configId string, branchId int) (*model.QueueJob, error) {
+	response := a.CreateJobRequest(componentId, configId, branchId).Send().Response
+	if response.HasResult() {
+		return response.Result().(*model.QueueJob), nil
+	}
+	return nil, response.Err()
+}
+
+// CreateJobRequest https://app.swaggerhub.com/apis-docs/keboola/job-queue-api/1.0.0#/Jobs/createJob
+// Zero branchId means the default branch.
+func (a *Api) CreateJobRequest(componentId, configId string, branchId int) *client.Request {
+	body := map[string]interface{}{"component": componentId, "config": configId, "mode": "run"}
+	if branchId != 0 {
+		body["branchId"] = branchId
+	}
+	job := &model.QueueJob{}
+	return a.
+		NewRequest(resty.MethodPost, "jobs").
+		SetJsonBody(body).
+		SetResult(job)
+}
@@ -0,0 +1,66 @@
+package queueapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/api/queueapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostFromStorageHost(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "queue.keboola.com", queueapi.HostFromStorageHost("connection.keboola.com"))
+	assert.Equal(t, "queue.eu-central-1.keboola.com", queueapi.HostFromStorageHost("connection.eu-central-1.keboola.com"))
+}
+
+func TestCreateJob(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedQueueApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", "https://queue.keboola.com/jobs", func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "my-token", req.Header.Get("X-StorageApi-Token"))
+		body := make(map[string]string)
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		assert.Equal(t, map[string]string{"component": "keboola.orchestrator", "config": "123", "mode": "run"}, body)
+		return httpmock.NewJsonResponse(201, map[string]interface{}{"id": "456", "status": "created", "url": "https://queue.keboola.com/jobs/456"})
+	})
+
+	job, err := api.CreateJob("keboola.orchestrator", "123", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "456", job.Id)
+	assert.Equal(t, "created", job.Status)
+}
+
+func TestCreateJobError(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedQueueApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", "https://queue.keboola.com/jobs", httpmock.NewJsonResponderOrPanic(400, map[string]interface{}{
+		"error":       `Configuration "123" not found`,
+		"code":        400,
+		"exceptionId": "job-runner-abc",
+	}))
+
+	job, err := api.CreateJob("keboola.orchestrator", "123", 0)
+	assert.Nil(t, job)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `Configuration "123" not found`)
+}
+
+func TestCreateJobInBranch(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedQueueApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", "https://queue.keboola.com/jobs", func(req *http.Request) (*http.Response, error) {
+		body := make(map[string]interface{})
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		assert.Equal(t, float64(789), body["branchId"])
+		return httpmock.NewJsonResponse(201, map[string]interface{}{"id": "456", "status": "created"})
+	})
+
+	job, err := api.CreateJob("keboola.orchestrator", "123", 789)
+	assert.NoError(t, err)
+	assert.Equal(t, "456", job.Id)
+}
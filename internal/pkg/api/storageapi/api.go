@@ -20,6 +20,7 @@ type Api struct {
 	client     *client.Client
 	logger     log.Logger
 	token      *model.Token
+	branchId   int
 }
 
 func NewWithToken(ctx context.Context, logger log.Logger, host, tokenStr string, verbose bool) (*Api, error) {
@@ -79,7 +80,11 @@ func (a *Api) NewPool() *client.Pool {
 }
 
 func (a *Api) NewRequest(method string, url string) *client.Request {
-	return a.client.NewRequest(method, url)
+	request := a.client.NewRequest(method, url)
+	if a.token != nil {
+		request.SetHeader("X-StorageApi-Token", a.token.Token)
+	}
+	return request
 }
 
 func (a *Api) Send(request *client.Request) {
@@ -0,0 +1,45 @@
+package storageapi
+
+import (
+	"fmt"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/spf13/cast"
+)
+
+// WithBranch returns a copy of the API, bucket, table, file and job requests are sent to the development branch.
+// Zero branchId means the default branch.
+func (a Api) WithBranch(branchId int) *Api {
+	a.branchId = branchId
+	return &a
+}
+
+func (a *Api) BranchId() int {
+	return a.branchId
+}
+
+// NewBranchRequest creates a request to an endpoint of the current branch, see WithBranch.
+func (a *Api) NewBranchRequest(method string, url string) *client.Request {
+	if a.branchId != 0 {
+		url = fmt.Sprintf("branch/%d/%s", a.branchId, url)
+	}
+	return a.NewRequest(method, url)
+}
+
+func (a *Api) GetBranch(branchId int) (*model.Branch, error) {
+	response := a.GetBranchRequest(branchId).Send().Response
+	if response.HasResult() {
+		return response.Result().(*model.Branch), nil
+	}
+	return nil, response.Err()
+}
+
+// GetBranchRequest https://keboola.docs.apiary.io/#reference/development-branches/branch-manipulation/branch-detail
+func (a *Api) GetBranchRequest(branchId int) *client.Request {
+	return a.
+		NewRequest(resty.MethodGet, "dev-branches/{branchId}").
+		SetPathParam("branchId", cast.ToString(branchId)).
+		SetResult(&model.Branch{})
+}
@@ -0,0 +1,50 @@
+package storageapi_test
+
+import (
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBranch(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("GET", "https://connection.keboola.com/v2/storage/dev-branches/123", httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+		"id":        123,
+		"name":      "staging",
+		"isDefault": false,
+	}))
+
+	branch, err := api.GetBranch(123)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Branch{Id: 123, Name: "staging"}, branch)
+}
+
+func TestWithBranch(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("GET", "https://connection.keboola.com/v2/storage/tables/in.c-bucket.table", httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+		"id":   "in.c-bucket.table",
+		"name": "main",
+	}))
+	transport.RegisterResponder("GET", "https://connection.keboola.com/v2/storage/branch/123/tables/in.c-bucket.table", httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+		"id":   "in.c-bucket.table",
+		"name": "branch",
+	}))
+
+	branchApi := api.WithBranch(123)
+	assert.Equal(t, 123, branchApi.BranchId())
+	assert.Equal(t, 0, api.BranchId())
+
+	table, err := branchApi.GetTable("in.c-bucket.table")
+	assert.NoError(t, err)
+	assert.Equal(t, "branch", table.Name)
+
+	table, err = api.GetTable("in.c-bucket.table")
+	assert.NoError(t, err)
+	assert.Equal(t, "main", table.Name)
+}
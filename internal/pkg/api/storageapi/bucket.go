@@ -3,6 +3,7 @@ package storageapi
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
@@ -15,7 +16,7 @@ func (a *Api) BucketExists(bucketId string) bool {
 }
 
 func (a *Api) GetBucketRequest(bucketId string) *client.Request {
-	return a.NewRequest(resty.MethodGet, fmt.Sprintf("buckets/%s", bucketId))
+	return a.NewBranchRequest(resty.MethodGet, fmt.Sprintf("buckets/%s", bucketId))
 }
 
 func (a *Api) CreateBucket(name string, stage string, displayName string) (model.Bucket, error) {
@@ -43,14 +44,15 @@ func (a *Api) CreateBucketAsyncRequest(name string, stage string, displayName st
 		body["displayName"] = displayName
 	}
 	request := a.
-		NewRequest(resty.MethodPost, "buckets").
+		NewBranchRequest(resty.MethodPost, "buckets").
 		SetFormBody(body).
 		SetResult(bucket)
 	return request
 }
 
-func (a *Api) CreateTableAsync(bucketId string, tableName string, fileId string) (model.Job, error) {
-	response := a.CreateTableAsyncRequest(bucketId, tableName, fileId).Send().Response
+// CreateTableAsync creates the table from the file. It doesn't wait for the job, see GetJob.
+func (a *Api) CreateTableAsync(bucketId string, tableName string, fileId string, primaryKey []string) (model.Job, error) {
+	response := a.CreateTableAsyncRequest(bucketId, tableName, fileId, primaryKey).Send().Response
 
 	if response.HasResult() {
 		return *response.Result().(*model.Job), nil
@@ -58,16 +60,17 @@ func (a *Api) CreateTableAsync(bucketId string, tableName string, fileId string)
 	return model.Job{}, response.Err()
 }
 
-func (a *Api) CreateTableAsyncRequest(bucketId string, tableName string, fileId string) *client.Request {
+func (a *Api) CreateTableAsyncRequest(bucketId string, tableName string, fileId string, primaryKey []string) *client.Request {
 	job := &model.Job{}
-	request := a.
-		NewRequest(resty.MethodPost, fmt.Sprintf("buckets/%s/tables-async", bucketId)).
-		SetFormBody(map[string]string{
-			"name":       tableName,
-			"dataFileId": fileId,
-		}).
+	body := map[string]string{
+		"name":       tableName,
+		"dataFileId": fileId,
+	}
+	if len(primaryKey) > 0 {
+		body["primaryKey"] = strings.Join(primaryKey, ",")
+	}
+	return a.
+		NewBranchRequest(resty.MethodPost, fmt.Sprintf("buckets/%s/tables-async", bucketId)).
+		SetFormBody(body).
 		SetResult(job)
-	request.
-		OnSuccess(waitForJob(a, request, job, nil))
-	return request
 }
@@ -2,8 +2,10 @@ package storageapi
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
 )
 
 type ErrorWithResponse interface {
@@ -13,6 +15,8 @@ type ErrorWithResponse interface {
 	IsUnauthorized() bool
 	IsForbidden() bool
 	IsNotFound() bool
+	IsThrottled() bool
+	RetryAfter() time.Duration
 }
 
 // Error represents Storage API error structure.
@@ -58,3 +62,13 @@ func (e *Error) IsForbidden() bool {
 func (e *Error) IsNotFound() bool {
 	return e.HttpStatus() == 404
 }
+
+// IsThrottled returns true if the request has been rejected because of the rate limit or an overload.
+func (e *Error) IsThrottled() bool {
+	return client.IsThrottled(e.HttpStatus())
+}
+
+// RetryAfter returns the delay requested by the "Retry-After" header, or 0 if it is not set.
+func (e *Error) RetryAfter() time.Duration {
+	return client.RetryAfter(e.response)
+}
@@ -3,6 +3,7 @@ package storageapi
 import (
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
@@ -63,6 +64,21 @@ func TestErrorIsNotFound(t *testing.T) {
 	assert.True(t, e.IsNotFound())
 }
 
+func TestErrorIsThrottled(t *testing.T) {
+	t.Parallel()
+	e := &Error{}
+	e.SetResponse(newResponseWithStatusCode(500))
+	assert.False(t, e.IsThrottled())
+	assert.Equal(t, time.Duration(0), e.RetryAfter())
+	e.SetResponse(newResponseWithStatusCode(503))
+	assert.True(t, e.IsThrottled())
+	response := newResponseWithStatusCode(429)
+	response.RawResponse.Header = http.Header{"Retry-After": []string{"120"}}
+	e.SetResponse(response)
+	assert.True(t, e.IsThrottled())
+	assert.Equal(t, 120*time.Second, e.RetryAfter())
+}
+
 func newResponseWithStatusCode(code int) *resty.Response {
 	return &resty.Response{
 		Request:     &resty.Request{Method: resty.MethodGet, URL: "https://example.com"},
@@ -4,6 +4,7 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/spf13/cast"
 )
 
 func (a *Api) CreateFileResource(name string) (model.FileResource, error) {
@@ -17,10 +18,43 @@ func (a *Api) CreateFileResource(name string) (model.FileResource, error) {
 
 func (a *Api) PostCreateFileResource(name string) *client.Request {
 	return a.
-		NewRequest(resty.MethodPost, "files/prepare").
+		NewBranchRequest(resty.MethodPost, "files/prepare").
 		SetFormBody(map[string]string{
 			"name":            name,
 			"federationToken": "true",
 		}).
 		SetResult(&model.FileResource{})
 }
+
+// CreateSlicedFileResource registers a sliced file, the slices and the manifest are uploaded separately.
+func (a *Api) CreateSlicedFileResource(name string) (model.FileResource, error) {
+	response := a.PostCreateSlicedFileResource(name).Send().Response
+
+	if response.HasResult() {
+		return *response.Result().(*model.FileResource), nil
+	}
+	return model.FileResource{}, response.Err()
+}
+
+func (a *Api) PostCreateSlicedFileResource(name string) *client.Request {
+	return a.
+		NewBranchRequest(resty.MethodPost, "files/prepare").
+		SetFormBody(map[string]string{
+			"name":            name,
+			"federationToken": "true",
+			"isSliced":        "true",
+		}).
+		SetResult(&model.FileResource{})
+}
+
+// DeleteFile deletes the file from the File Storage.
+func (a *Api) DeleteFile(fileId int) error {
+	return a.DeleteFileRequest(fileId).Send().Response.Err()
+}
+
+// DeleteFileRequest https://keboola.docs.apiary.io/#reference/files/manage-files/delete-file
+func (a *Api) DeleteFileRequest(fileId int) *client.Request {
+	return a.
+		NewBranchRequest(resty.MethodDelete, "files/{fileId}").
+		SetPathParam("fileId", cast.ToString(fileId))
+}
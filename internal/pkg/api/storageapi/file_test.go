@@ -1,9 +1,13 @@
 package storageapi_test
 
 import (
+	"net/http"
 	"testing"
 
+	"github.com/jarcoal/httpmock"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/env"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testapi"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testproject"
 	"github.com/stretchr/testify/assert"
 )
@@ -23,3 +27,28 @@ func TestPostCreateFileResource(t *testing.T) {
 	assert.NotNil(t, response.UploadParams.Key)
 	assert.NotNil(t, response.UploadParams.Credentials.AccessKeyId)
 }
+
+func TestCreateSlicedFileResource(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", `=~/files/prepare$`, func(req *http.Request) (*http.Response, error) {
+		assert.NoError(t, req.ParseForm())
+		assert.Equal(t, "data.csv.gz", req.PostForm.Get("name"))
+		assert.Equal(t, "true", req.PostForm.Get("isSliced"))
+		return httpmock.NewJsonResponse(200, map[string]interface{}{"id": 123, "name": "data.csv.gz", "provider": "aws", "isSliced": true})
+	})
+
+	response, err := api.CreateSlicedFileResource("data.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, 123, response.Id)
+	assert.True(t, response.IsSliced)
+}
+
+func TestDeleteFile(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("DELETE", `=~/files/123$`, httpmock.NewStringResponder(204, ""))
+
+	assert.NoError(t, api.DeleteFile(123))
+	assert.Equal(t, 1, transport.GetTotalCallCount())
+}
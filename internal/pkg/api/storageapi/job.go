@@ -22,25 +22,35 @@ func (a *Api) GetJob(jobId int) (*model.Job, error) {
 func (a *Api) GetJobRequest(jobId int) *client.Request {
 	job := &model.Job{}
 	return a.
-		NewRequest(resty.MethodGet, "jobs/{jobId}").
+		NewBranchRequest(resty.MethodGet, "jobs/{jobId}").
 		SetPathParam("jobId", cast.ToString(jobId)).
 		SetResult(job).OnResponse(func(response *client.Response) {
 	})
 }
 
-// nolint: unused
+// WaitForJob polls the job until it is finished.
+func (a *Api) WaitForJob(jobId int) (*model.Job, error) {
+	job := &model.Job{}
+	request := a.GetJobRequest(jobId).SetResult(job)
+	request.OnSuccess(waitForJob(a, request, job, nil))
+	if err := request.Send().Response.Err(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
 func waitForJob(a *Api, parentRequest *client.Request, job *model.Job, onJobSuccess client.ResponseCallback) client.ResponseCallback {
 	// Check job
 	backoff := newBackoff()
 	var checkJobStatus client.ResponseCallback
 	checkJobStatus = func(response *client.Response) {
 		// Check status
-		if job.Status == "success" {
+		if job.Status == model.JobStatusSuccess {
 			if onJobSuccess != nil {
 				onJobSuccess(response)
 			}
 			return
-		} else if job.Status == "error" {
+		} else if job.Status == model.JobStatusError {
 			err := fmt.Errorf("job failed: %v", job.Error.Message)
 			response.SetErr(err)
 			return
@@ -14,12 +14,25 @@ func (a *Api) TableExists(tableId string) bool {
 	return response.Response.StatusCode() == http.StatusOK
 }
 
+func (a *Api) GetTable(tableId string) (*model.Table, error) {
+	response := a.GetTableRequest(tableId).Send().Response
+	if response.HasResult() {
+		return response.Result().(*model.Table), nil
+	}
+	return nil, response.Err()
+}
+
 func (a *Api) GetTableRequest(tableId string) *client.Request {
-	return a.NewRequest(resty.MethodGet, fmt.Sprintf("tables/%s", tableId))
+	table := &model.Table{}
+	return a.
+		NewBranchRequest(resty.MethodGet, fmt.Sprintf("tables/%s", tableId)).
+		SetResult(table)
 }
 
-func (a *Api) ImportTableAsync(tableId string, fileId string, incremental bool) (model.Job, error) {
-	response := a.ImportTableAsyncRequest(tableId, fileId, incremental).Send().Response
+// ImportTableAsync imports the file to the table. It doesn't wait for the job, see GetJob.
+// Columns must be set for a sliced file, the slices have no header.
+func (a *Api) ImportTableAsync(tableId string, fileId string, incremental bool, columns []string) (model.Job, error) {
+	response := a.ImportTableAsyncRequest(tableId, fileId, incremental, columns).Send().Response
 
 	if response.HasResult() {
 		return *response.Result().(*model.Job), nil
@@ -27,7 +40,7 @@ func (a *Api) ImportTableAsync(tableId string, fileId string, incremental bool)
 	return model.Job{}, response.Err()
 }
 
-func (a *Api) ImportTableAsyncRequest(tableId string, fileId string, incremental bool) *client.Request {
+func (a *Api) ImportTableAsyncRequest(tableId string, fileId string, incremental bool, columns []string) *client.Request {
 	job := &model.Job{}
 	body := map[string]string{
 		"dataFileId": fileId,
@@ -35,11 +48,68 @@ func (a *Api) ImportTableAsyncRequest(tableId string, fileId string, incremental
 	if incremental {
 		body["incremental"] = "1"
 	}
-	request := a.
-		NewRequest(resty.MethodPost, fmt.Sprintf("tables/%s/import-async", tableId)).
+	for i, column := range columns {
+		body[fmt.Sprintf("columns[%d]", i)] = column
+	}
+	return a.
+		NewBranchRequest(resty.MethodPost, fmt.Sprintf("tables/%s/import-async", tableId)).
 		SetFormBody(body).
 		SetResult(job)
+}
+
+func (a *Api) AddColumnAsync(tableId string, name string) (model.Job, error) {
+	response := a.AddColumnAsyncRequest(tableId, name).Send().Response
+
+	if response.HasResult() {
+		return *response.Result().(*model.Job), nil
+	}
+	return model.Job{}, response.Err()
+}
+
+func (a *Api) AddColumnAsyncRequest(tableId string, name string) *client.Request {
+	job := &model.Job{}
+	request := a.
+		NewBranchRequest(resty.MethodPost, fmt.Sprintf("tables/%s/columns", tableId)).
+		SetFormBody(map[string]string{"name": name}).
+		SetResult(job)
 	request.
 		OnSuccess(waitForJob(a, request, job, nil))
 	return request
 }
+
+func (a *Api) CreateTableDefinitionAsync(bucketId string, definition model.TableDefinition) (model.Job, error) {
+	response := a.CreateTableDefinitionAsyncRequest(bucketId, definition).Send().Response
+
+	if response.HasResult() {
+		return *response.Result().(*model.Job), nil
+	}
+	return model.Job{}, response.Err()
+}
+
+// CreateTableDefinitionAsyncRequest https://keboola.docs.apiary.io/#reference/tables/create-table-definition/create-new-table-definition
+func (a *Api) CreateTableDefinitionAsyncRequest(bucketId string, definition model.TableDefinition) *client.Request {
+	job := &model.Job{}
+	request := a.
+		NewBranchRequest(resty.MethodPost, fmt.Sprintf("buckets/%s/tables-definition", bucketId)).
+		SetJsonBody(definition).
+		SetResult(job)
+	request.
+		OnSuccess(waitForJob(a, request, job, nil))
+	return request
+}
+
+func (a *Api) AddTableMetadata(tableId string, provider string, metadata []model.Metadata) error {
+	return a.AddTableMetadataRequest(tableId, provider, metadata).Send().Response.Err()
+}
+
+// AddTableMetadataRequest https://keboola.docs.apiary.io/#reference/metadata/table-metadata/create-or-update
+func (a *Api) AddTableMetadataRequest(tableId string, provider string, metadata []model.Metadata) *client.Request {
+	body := map[string]string{"provider": provider}
+	for i, item := range metadata {
+		body[fmt.Sprintf("metadata[%d][key]", i)] = item.Key
+		body[fmt.Sprintf("metadata[%d][value]", i)] = item.Value
+	}
+	return a.
+		NewBranchRequest(resty.MethodPost, fmt.Sprintf("tables/%s/metadata", tableId)).
+		SetFormBody(body)
+}
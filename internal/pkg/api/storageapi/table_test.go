@@ -1,14 +1,23 @@
 package storageapi_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"net/http"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jarcoal/httpmock"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/env"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/s3"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testapi"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testproject"
 	"github.com/stretchr/testify/assert"
 )
@@ -21,12 +30,10 @@ func TestPostCreateTable(t *testing.T) {
 	response, err := api.CreateFileResource("tmpfile")
 	assert.NoError(t, err)
 
-	err = os.WriteFile("/tmp/dat1.csv", []byte("col1,col2,col3\ntest1,test2,test3\n"), 0o666)
-	assert.NoError(t, err)
 	assert.NotNil(t, response.Id)
 	fileId := response.Id
 
-	err = s3.UploadFileToS3("/tmp/dat1.csv", response)
+	err = s3.UploadToS3(context.Background(), strings.NewReader("col1,col2,col3\ntest1,test2,test3\n"), response)
 	assert.NoError(t, err)
 
 	bucketName := fmt.Sprintf("test%d", int(time.Now().UnixNano()))
@@ -41,10 +48,150 @@ func TestPostCreateTable(t *testing.T) {
 	assert.True(t, api.BucketExists(bucket.Id))
 
 	tableId := fmt.Sprintf("%s.%s", bucket.Id, tableName)
-	_, err = api.CreateTableAsync(tableId, tableName, strconv.Itoa(fileId))
+	job, err := api.CreateTableAsync(tableId, tableName, strconv.Itoa(fileId), nil)
+	assert.NoError(t, err)
+	_, err = api.WaitForJob(job.Id)
 	assert.NoError(t, err)
 	assert.True(t, api.TableExists(fmt.Sprintf("in.c-%s.%s", bucketName, tableName)))
 
-	_, err = api.ImportTableAsync(tableId, strconv.Itoa(fileId), false)
+	job, err = api.ImportTableAsync(tableId, strconv.Itoa(fileId), false, nil)
+	assert.NoError(t, err)
+	_, err = api.WaitForJob(job.Id)
+	assert.NoError(t, err)
+}
+
+func TestAddColumnAsync(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", `=~/tables/in.c-bucket.table/columns$`, func(req *http.Request) (*http.Response, error) {
+		assert.NoError(t, req.ParseForm())
+		assert.Equal(t, "customer__name", req.PostForm.Get("name"))
+		return httpmock.NewJsonResponse(202, map[string]interface{}{"id": 123, "status": "waiting"})
+	})
+	transport.RegisterResponder("GET", `=~/jobs/123$`, httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{"id": 123, "status": "success"}))
+
+	job, err := api.AddColumnAsync("in.c-bucket.table", "customer__name")
+	assert.NoError(t, err)
+	assert.Equal(t, 123, job.Id)
+	assert.Equal(t, "success", job.Status)
+}
+
+func TestGetTable(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("GET", `=~/tables/in.c-bucket.table$`, httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+		"id":         "in.c-bucket.table",
+		"name":       "table",
+		"columns":    []string{"id", "timestamp", "body"},
+		"primaryKey": []string{"id"},
+	}))
+	transport.RegisterResponder("GET", `=~/tables/in.c-bucket.missing$`, httpmock.NewJsonResponderOrPanic(404, map[string]interface{}{
+		"error": "The table \"missing\" was not found in the bucket \"in.c-bucket\"",
+		"code":  "storage.tables.notFound",
+	}))
+
+	table, err := api.GetTable("in.c-bucket.table")
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Table{Id: "in.c-bucket.table", Name: "table", Columns: []string{"id", "timestamp", "body"}, PrimaryKey: []string{"id"}}, table)
+
+	_, err = api.GetTable("in.c-bucket.missing")
+	var errWithResponse client.ErrorWithResponse
+	assert.True(t, errors.As(err, &errWithResponse))
+	assert.True(t, errWithResponse.IsNotFound())
+}
+
+func TestCreateTableAsyncPrimaryKey(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", `=~/buckets/in.c-bucket/tables-async$`, func(req *http.Request) (*http.Response, error) {
+		assert.NoError(t, req.ParseForm())
+		assert.Equal(t, "table", req.PostForm.Get("name"))
+		assert.Equal(t, "456", req.PostForm.Get("dataFileId"))
+		assert.Equal(t, "id,type", req.PostForm.Get("primaryKey"))
+		return httpmock.NewJsonResponse(202, map[string]interface{}{"id": 123, "status": "success"})
+	})
+
+	job, err := api.CreateTableAsync("in.c-bucket", "table", "456", []string{"id", "type"})
+	assert.NoError(t, err)
+	assert.Equal(t, 123, job.Id)
+}
+
+func TestCreateTableDefinitionAsync(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", `=~/buckets/in.c-bucket/tables-definition$`, func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		assert.JSONEq(t, `{
+			"name": "table",
+			"primaryKeysNames": ["id"],
+			"columns": [
+				{"name": "id", "definition": {"type": "NUMBER", "length": "38,0", "nullable": false}},
+				{"name": "body", "basetype": "STRING"}
+			]
+		}`, string(body))
+		return httpmock.NewJsonResponse(202, map[string]interface{}{"id": 123, "status": "success"})
+	})
+
+	definition := model.TableDefinition{
+		Name:       "table",
+		PrimaryKey: []string{"id"},
+		Columns: []model.ColumnDefinition{
+			{Name: "id", Definition: &model.ColumnNativeType{Type: "NUMBER", Length: "38,0", Nullable: false}},
+			{Name: "body", BaseType: "STRING"},
+		},
+	}
+	job, err := api.CreateTableDefinitionAsync("in.c-bucket", definition)
+	assert.NoError(t, err)
+	assert.Equal(t, 123, job.Id)
+}
+
+func TestAddTableMetadata(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", `=~/tables/in.c-bucket.table/metadata$`, func(req *http.Request) (*http.Response, error) {
+		assert.NoError(t, req.ParseForm())
+		assert.Equal(t, "webhooks", req.PostForm.Get("provider"))
+		assert.Equal(t, "KBC.description", req.PostForm.Get("metadata[0][key]"))
+		assert.Equal(t, "Orders", req.PostForm.Get("metadata[0][value]"))
+		return httpmock.NewJsonResponse(201, []interface{}{})
+	})
+
+	err := api.AddTableMetadata("in.c-bucket.table", "webhooks", []model.Metadata{{Key: "KBC.description", Value: "Orders"}})
+	assert.NoError(t, err)
+}
+
+func TestImportTableAsyncColumns(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", `=~/tables/in.c-bucket.table/import-async$`, func(req *http.Request) (*http.Response, error) {
+		assert.NoError(t, req.ParseForm())
+		assert.Equal(t, "456", req.PostForm.Get("dataFileId"))
+		assert.Equal(t, "1", req.PostForm.Get("incremental"))
+		assert.Equal(t, "timestamp", req.PostForm.Get("columns[0]"))
+		assert.Equal(t, "body", req.PostForm.Get("columns[1]"))
+		return httpmock.NewJsonResponse(202, map[string]interface{}{"id": 123, "status": "success"})
+	})
+
+	job, err := api.ImportTableAsync("in.c-bucket.table", "456", true, []string{"timestamp", "body"})
+	assert.NoError(t, err)
+	assert.Equal(t, 123, job.Id)
+}
+
+func TestWaitForJob(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", `=~/tables/in.c-bucket.table/import-async$`, httpmock.NewJsonResponderOrPanic(202, map[string]interface{}{"id": 123, "status": "waiting"}))
+	transport.RegisterResponder("GET", `=~/jobs/123$`, httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{"id": 123, "status": "success"}))
+
+	// Import doesn't wait for the job
+	job, err := api.ImportTableAsync("in.c-bucket.table", "456", false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "waiting", job.Status)
+	assert.Equal(t, 0, transport.GetCallCountInfo()["GET =~/jobs/123$"])
+
+	finished, err := api.WaitForJob(job.Id)
 	assert.NoError(t, err)
+	assert.Equal(t, "success", finished.Status)
 }
@@ -8,9 +8,10 @@ import (
 	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
 )
 
+// WithToken returns a copy of the API, the token is sent with each request.
+// The underlying client is shared, so the token cannot be set as a client header.
 func (a Api) WithToken(token model.Token) *Api {
 	a.token = &token
-	a.client.SetHeader("X-StorageApi-Token", token.Token)
 	return &a
 }
 
@@ -0,0 +1,25 @@
+package storageapi_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTokenIsolated(t *testing.T) {
+	t.Parallel()
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("GET", `=~/buckets/`, func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(200, req.Header.Get("X-StorageApi-Token")), nil
+	})
+
+	api1 := api.WithToken(model.Token{Token: "token1"})
+	api2 := api.WithToken(model.Token{Token: "token2"})
+	assert.Equal(t, "token2", api2.GetBucketRequest("in.c-bucket").Send().Response.String())
+	assert.Equal(t, "token1", api1.GetBucketRequest("in.c-bucket").Send().Response.String())
+}
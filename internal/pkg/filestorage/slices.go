@@ -0,0 +1,71 @@
+package filestorage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+// ManifestName is the suffix of the manifest file of a sliced file resource.
+const ManifestName = "manifest"
+
+// Manifest lists slices of a sliced file, see https://developers.keboola.com/integrate/storage/api/import-export/#upload-sliced-files.
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+type ManifestEntry struct {
+	Url       string `json:"url"`
+	Mandatory bool   `json:"mandatory"`
+}
+
+// UploadSlice uploads content of the reader as a slice of the sliced file resource.
+func UploadSlice(ctx context.Context, reader io.Reader, resource model.FileResource, sliceName string) error {
+	return Upload(ctx, reader, sliceResource(resource, sliceName))
+}
+
+// UploadManifest uploads the manifest of the uploaded slices, it must be uploaded after all slices.
+func UploadManifest(ctx context.Context, resource model.FileResource, sliceNames []string) error {
+	manifest := Manifest{Entries: make([]ManifestEntry, 0, len(sliceNames))}
+	for _, sliceName := range sliceNames {
+		sliceUrl, err := SliceUrl(resource, sliceName)
+		if err != nil {
+			return err
+		}
+		manifest.Entries = append(manifest.Entries, ManifestEntry{Url: sliceUrl, Mandatory: true})
+	}
+
+	content, err := json.Encode(manifest, false)
+	if err != nil {
+		return err
+	}
+	return UploadSlice(ctx, bytes.NewReader(content), resource, ManifestName)
+}
+
+// SliceUrl returns URL of the slice, as it is expected in the manifest.
+func SliceUrl(resource model.FileResource, sliceName string) (string, error) {
+	switch resource.Provider {
+	case model.FileProviderAws:
+		return fmt.Sprintf("s3://%s/%s%s", resource.UploadParams.Bucket, resource.UploadParams.Key, sliceName), nil
+	case model.FileProviderAzure:
+		params := resource.AbsUploadParams
+		return fmt.Sprintf("azure://%s.blob.core.windows.net/%s/%s%s", params.AccountName, params.Container, params.BlobName, sliceName), nil
+	case model.FileProviderGcp:
+		return fmt.Sprintf("gs://%s/%s%s", resource.GcsUploadParams.Bucket, resource.GcsUploadParams.Key, sliceName), nil
+	default:
+		return "", fmt.Errorf(`file storage provider "%s" is not supported`, resource.Provider)
+	}
+}
+
+// sliceResource returns a copy of the file resource, which targets the slice.
+// Slices are stored next to each other, the key of the sliced file resource is their common prefix.
+func sliceResource(resource model.FileResource, sliceName string) model.FileResource {
+	resource.UploadParams.Key += sliceName
+	resource.AbsUploadParams.BlobName += sliceName
+	resource.GcsUploadParams.Key += sliceName
+	return resource
+}
@@ -0,0 +1,45 @@
+package filestorage
+
+import (
+	"testing"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSliceUrl(t *testing.T) {
+	t.Parallel()
+	resource := model.FileResource{Provider: model.FileProviderAws}
+	resource.UploadParams.Bucket = "kbc-files"
+	resource.UploadParams.Key = "exp-15/123.webhook.csv.gz"
+	sliceUrl, err := SliceUrl(resource, "part0001.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3://kbc-files/exp-15/123.webhook.csv.gzpart0001.csv.gz", sliceUrl)
+
+	resource = model.FileResource{Provider: model.FileProviderAzure}
+	resource.AbsUploadParams.AccountName = "kbcfiles"
+	resource.AbsUploadParams.Container = "exp-15"
+	resource.AbsUploadParams.BlobName = "123.webhook.csv.gz"
+	sliceUrl, err = SliceUrl(resource, "part0001.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "azure://kbcfiles.blob.core.windows.net/exp-15/123.webhook.csv.gzpart0001.csv.gz", sliceUrl)
+
+	resource = model.FileResource{Provider: model.FileProviderGcp}
+	resource.GcsUploadParams.Bucket = "kbc-files"
+	resource.GcsUploadParams.Key = "exp-15/123.webhook.csv.gz"
+	sliceUrl, err = SliceUrl(resource, "part0001.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "gs://kbc-files/exp-15/123.webhook.csv.gzpart0001.csv.gz", sliceUrl)
+
+	_, err = SliceUrl(model.FileResource{Provider: "ftp"}, "part0001.csv.gz")
+	assert.EqualError(t, err, `file storage provider "ftp" is not supported`)
+}
+
+func TestSliceResource(t *testing.T) {
+	t.Parallel()
+	resource := model.FileResource{Provider: model.FileProviderAws}
+	resource.UploadParams.Key = "exp-15/123.webhook.csv.gz"
+	slice := sliceResource(resource, ManifestName)
+	assert.Equal(t, "exp-15/123.webhook.csv.gzmanifest", slice.UploadParams.Key)
+	assert.Equal(t, "exp-15/123.webhook.csv.gz", resource.UploadParams.Key)
+}
@@ -0,0 +1,40 @@
+package filestorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/abs"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/gcs"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/s3"
+)
+
+const (
+	// MinTimeout of an upload, regardless of the size.
+	MinTimeout = 30 * time.Second
+	// MinThroughput in bytes per second, it is used to scale the timeout by the size.
+	MinThroughput = 256 * 1024
+)
+
+// Timeout returns the upload timeout scaled by the expected size in bytes.
+func Timeout(size uint64) time.Duration {
+	return MinTimeout + time.Duration(size/MinThroughput)*time.Second
+}
+
+// Upload uploads content of the reader to the prepared file resource.
+// The backend is selected by the provider of the stack: AWS S3, Azure Blob Storage or Google Cloud Storage.
+func Upload(ctx context.Context, reader io.Reader, resource model.FileResource) error {
+	switch resource.Provider {
+	case model.FileProviderAws:
+		return s3.UploadToS3(ctx, reader, resource)
+	case model.FileProviderAzure:
+		return abs.Upload(ctx, reader, resource)
+	case model.FileProviderGcp:
+		return gcs.Upload(ctx, reader, resource)
+	default:
+		return fmt.Errorf(`file storage provider "%s" is not supported`, resource.Provider)
+	}
+}
@@ -0,0 +1,23 @@
+package filestorage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadUnsupportedProvider(t *testing.T) {
+	t.Parallel()
+	err := Upload(context.Background(), strings.NewReader("foo"), model.FileResource{Provider: "ftp"})
+	assert.EqualError(t, err, `file storage provider "ftp" is not supported`)
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, MinTimeout, Timeout(0))
+	assert.Equal(t, MinTimeout+400*time.Second, Timeout(100*1024*1024))
+}
@@ -0,0 +1,115 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+const (
+	DefaultUrl = "https://storage.googleapis.com"
+	// ChunkSize of the resumable upload, it must be a multiple of 256 KiB.
+	ChunkSize = 8 * 1024 * 1024
+	// PartRetries is the maximum number of retries of one chunk.
+	PartRetries = 3
+)
+
+// client doesn't follow the 308 "Resume Incomplete" response of the resumable upload.
+var client = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+// Upload uploads content of the reader to the prepared file resource in Google Cloud Storage.
+func Upload(ctx context.Context, reader io.Reader, resource model.FileResource) error {
+	return UploadTo(ctx, DefaultUrl, reader, resource)
+}
+
+// UploadTo uploads content of the reader to the GCS API at the baseUrl, for example to an emulator.
+// The reader is consumed in chunks by the resumable upload, so the content size doesn't have to be known.
+// Each chunk is retried separately, see https://cloud.google.com/storage/docs/performing-resumable-uploads#chunked-upload.
+// The upload is aborted when the context is done.
+func UploadTo(ctx context.Context, baseUrl string, reader io.Reader, resource model.FileResource) error {
+	params := resource.GcsUploadParams
+	startUrl := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=resumable&name=%s", strings.TrimSuffix(baseUrl, "/"), url.PathEscape(params.Bucket), url.QueryEscape(params.Key))
+
+	// Start the resumable upload
+	tokenType := params.TokenType
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+	resp, err := send(ctx, http.MethodPost, startUrl, nil, map[string]string{"Authorization": tokenType + " " + params.AccessToken}, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return fmt.Errorf(`cannot start upload: %w`, err)
+	}
+	sessionUrl := resp.Header.Get("Location")
+	if sessionUrl == "" {
+		return fmt.Errorf(`cannot start upload: session URL is missing`)
+	}
+
+	// Upload chunks, the total size is sent with the last chunk
+	buffer := make([]byte, ChunkSize)
+	for offset := 0; ; {
+		n, readErr := io.ReadFull(reader, buffer)
+		last := readErr == io.EOF || readErr == io.ErrUnexpectedEOF
+		if readErr != nil && !last {
+			return readErr
+		}
+
+		total := "*"
+		if last {
+			total = fmt.Sprintf("%d", offset+n)
+		}
+		contentRange := fmt.Sprintf("bytes */%s", total)
+		if n > 0 {
+			contentRange = fmt.Sprintf("bytes %d-%d/%s", offset, offset+n-1, total)
+		}
+		expected := []int{http.StatusPermanentRedirect}
+		if last {
+			expected = []int{http.StatusOK, http.StatusCreated}
+		}
+
+		chunk := buffer[:n]
+		err := retry.Do(func() error {
+			_, err := send(ctx, http.MethodPut, sessionUrl, bytes.NewReader(chunk), map[string]string{"Content-Range": contentRange}, expected...)
+			return err
+		}, retry.Context(ctx), retry.Attempts(PartRetries+1), retry.Delay(500*time.Millisecond), retry.LastErrorOnly(true))
+		if err != nil {
+			return fmt.Errorf(`cannot upload chunk "%s": %w`, contentRange, err)
+		}
+
+		offset += n
+		if last {
+			return nil
+		}
+	}
+}
+
+func send(ctx context.Context, method, reqUrl string, body io.Reader, headers map[string]string, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	msg, _ := io.ReadAll(resp.Body)
+	return nil, fmt.Errorf(`%s "%s" returned http code %d: %s`, method, reqUrl, resp.StatusCode, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,111 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpload(t *testing.T) {
+	t.Parallel()
+	lock := &sync.Mutex{}
+	var ranges []string
+	var body bytes.Buffer
+	failures := 1
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch r.Method {
+		case http.MethodPost:
+			assert.Equal(t, "/upload/storage/v1/b/bucket/o", r.URL.Path)
+			assert.Equal(t, "resumable", r.URL.Query().Get("uploadType"))
+			assert.Equal(t, "exp/file.csv", r.URL.Query().Get("name"))
+			assert.Equal(t, "Bearer my-token", r.Header.Get("Authorization"))
+			w.Header().Set("Location", server.URL+"/session")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodPut:
+			assert.Equal(t, "/session", r.URL.Path)
+			data, _ := io.ReadAll(r.Body)
+			// The first chunk fails once, it is retried
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			contentRange := r.Header.Get("Content-Range")
+			ranges = append(ranges, contentRange)
+			body.Write(data)
+			if strings.HasSuffix(contentRange, "/*") {
+				w.WriteHeader(http.StatusPermanentRedirect)
+			} else {
+				w.WriteHeader(http.StatusOK)
+			}
+		}
+	}))
+	defer server.Close()
+
+	content := strings.Repeat("x", ChunkSize+10)
+	assert.NoError(t, UploadTo(context.Background(), server.URL, strings.NewReader(content), newResource("bucket")))
+	assert.Equal(t, []string{
+		fmt.Sprintf("bytes 0-%d/*", ChunkSize-1),
+		fmt.Sprintf("bytes %d-%d/%d", ChunkSize, ChunkSize+9, ChunkSize+10),
+	}, ranges)
+	assert.Equal(t, content, body.String())
+}
+
+func TestUploadError(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("invalid token"))
+	}))
+	defer server.Close()
+
+	err := UploadTo(context.Background(), server.URL, strings.NewReader("foo,bar\n"), newResource("bucket"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "returned http code 401: invalid token")
+}
+
+// TestUploadFakeGcsServer runs against the fake-gcs-server emulator, for example "http://127.0.0.1:4443".
+func TestUploadFakeGcsServer(t *testing.T) {
+	t.Parallel()
+	baseUrl := os.Getenv("TEST_FAKE_GCS_URL")
+	if baseUrl == "" {
+		t.Skip("TEST_FAKE_GCS_URL is not set")
+	}
+
+	bucket := fmt.Sprintf("test%d", time.Now().UnixNano())
+	resp, err := http.Post(baseUrl+"/storage/v1/b", "application/json", bytes.NewReader([]byte(fmt.Sprintf(`{"name":"%s"}`, bucket)))) // nolint:gosec // test URL
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	assert.NoError(t, UploadTo(context.Background(), baseUrl, strings.NewReader("foo,bar\n"), newResource(bucket)))
+
+	resp, err = http.Get(fmt.Sprintf("%s/storage/v1/b/%s/o/exp%%2Ffile.csv?alt=media", baseUrl, bucket)) // nolint:gosec // test URL
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo,bar\n", string(data))
+}
+
+func newResource(bucket string) model.FileResource {
+	resource := model.FileResource{Provider: model.FileProviderGcp}
+	resource.GcsUploadParams.Bucket = bucket
+	resource.GcsUploadParams.Key = "exp/file.csv"
+	resource.GcsUploadParams.AccessToken = "my-token"
+	resource.GcsUploadParams.TokenType = "Bearer"
+	return resource
+}
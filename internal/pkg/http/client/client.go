@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -119,9 +120,41 @@ func createHttpClient(logger *Logger) *resty.Client {
 	r.SetRetryMaxWaitTime(RetryWaitTimeMax)
 	r.SetTransport(createTransport())
 	r.AddRetryCondition(createRetry())
+	r.SetRetryAfter(func(_ *resty.Client, response *resty.Response) (time.Duration, error) {
+		// The delay is limited by RetryWaitTimeMax, a longer delay must be handled by the caller
+		return RetryAfter(response), nil
+	})
 	return r
 }
 
+// RetryAfter returns the delay from the "Retry-After" header, in seconds or as a HTTP date, or 0 if it is not set.
+func RetryAfter(response *resty.Response) time.Duration {
+	if response == nil || response.RawResponse == nil {
+		return 0
+	}
+	value := strings.TrimSpace(response.Header().Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// IsThrottled returns true for HTTP status codes, which mean that the client should slow down.
+func IsThrottled(httpStatus int) bool {
+	return httpStatus == http.StatusTooManyRequests || httpStatus == http.StatusServiceUnavailable
+}
+
 // createRetry - retry on defined network and HTTP errors.
 func createRetry() func(response *resty.Response, err error) bool {
 	return func(response *resty.Response, err error) bool {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
@@ -84,6 +85,41 @@ func TestRetry(t *testing.T) {
 	assert.Regexp(t, testhelper.WildcardToRegexp(expected), logs)
 }
 
+func TestRetryAfterHeader(t *testing.T) {
+	t.Parallel()
+	c, httpTransport, _ := getMockedClientAndLogs(t, false)
+
+	// Mocked response, the delay is limited by the max wait time
+	httpTransport.RegisterResponder("GET", `=~.+`, func(req *http.Request) (*http.Response, error) {
+		response := httpmock.NewStringResponse(429, `test`)
+		response.Header.Set("Retry-After", "60")
+		return response, nil
+	})
+
+	// Get
+	start := time.Now()
+	response := c.NewRequest(resty.MethodGet, "https://example.com").Send().Response
+	assert.Error(t, response.Err())
+	assert.Equal(t, 1+c.resty.RetryCount, httpTransport.GetCallCountInfo()["GET https://example.com"])
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 60*time.Second, RetryAfter(response.Response))
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+	newResponse := func(value string) *resty.Response {
+		return &resty.Response{RawResponse: &http.Response{Header: http.Header{"Retry-After": []string{value}}}}
+	}
+	assert.Equal(t, time.Duration(0), RetryAfter(nil))
+	assert.Equal(t, time.Duration(0), RetryAfter(newResponse("")))
+	assert.Equal(t, time.Duration(0), RetryAfter(newResponse("foo")))
+	assert.Equal(t, time.Duration(0), RetryAfter(newResponse("-5")))
+	assert.Equal(t, 30*time.Second, RetryAfter(newResponse("30")))
+	delay := RetryAfter(newResponse(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)))
+	assert.Greater(t, delay, 50*time.Second)
+	assert.LessOrEqual(t, delay, time.Minute)
+}
+
 func TestDoNotRetry(t *testing.T) {
 	t.Parallel()
 	c, httpTransport, logger := getMockedClientAndLogs(t, false)
@@ -1,6 +1,10 @@
 package client
 
-import "github.com/go-resty/resty/v2"
+import (
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
 
 type ErrorWithResponse interface {
 	SetResponse(response *resty.Response)
@@ -9,4 +13,6 @@ type ErrorWithResponse interface {
 	IsUnauthorized() bool
 	IsForbidden() bool
 	IsNotFound() bool
+	IsThrottled() bool
+	RetryAfter() time.Duration
 }
@@ -97,7 +97,7 @@ func (r *Request) SetFormBody(body map[string]string) *Request {
 	return r
 }
 
-func (r *Request) SetJsonBody(body map[string]string) *Request {
+func (r *Request) SetJsonBody(body interface{}) *Request {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 )
 
 type RawMessage = json.RawMessage
@@ -52,6 +53,23 @@ func Decode(data []byte, m interface{}) error {
 	return nil
 }
 
+// DecodeUseNumber is Decode, but numbers are decoded as json.Number, so large integers are not rounded.
+// Data after the first JSON value are rejected, as by Decode.
+func DecodeUseNumber(data []byte, m interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(m); errors.Is(err, io.EOF) {
+		return fmt.Errorf(`empty, please use "{}" for an empty JSON`)
+	} else if err != nil {
+		return processJsonDecodeError(data, err)
+	}
+	offset := decoder.InputOffset()
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid data after top-level value, offset: %d", offset)
+	}
+	return nil
+}
+
 func MustDecode(data []byte, m interface{}) {
 	if err := Decode(data, m); err != nil {
 		panic(err)
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	BatchStatusImporting = "importing"
+	BatchStatusImported  = "imported"
+	BatchStatusFailed    = "failed"
+	// MaxImportAttempts is the max number of failed imports of a row.
+	// Then the row is not returned to the buffer, it stays in the failed batch until the ReceiptRetention.
+	MaxImportAttempts = 5
+	// RetryBackoff is the delay of the import after the first failed import, it is doubled after each next failure.
+	RetryBackoff    = time.Minute
+	MaxRetryBackoff = time.Hour
+)
+
+// RetryDelay returns the delay of the next import of rows, which failed the attempts times.
+func RetryDelay(attempts uint) time.Duration {
+	delay := RetryBackoff
+	for i := uint(1); i < attempts && delay < MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > MaxRetryBackoff {
+		return MaxRetryBackoff
+	}
+	return delay
+}
+
+// Batch of rows fetched from the buffer and imported to the TableId by one Storage job.
+type Batch struct {
+	Id      string `gorm:"type:CHAR(21);primaryKey"`
+	Webhook uint32 `gorm:"not null;index"`
+	TableId string `gorm:"type:VARCHAR(1000);not null;default:''"`
+	Status  string `gorm:"type:VARCHAR(20);not null"`
+	// FetchId is shared by the batches created by one fetch of the webhook buffer, they are one import of the webhook, see Trigger
+	FetchId string `gorm:"type:CHAR(21);not null;default:'';index"`
+	// Storage job of the import, it is persisted when the job is created and tracked until it is finished
+	JobId int `gorm:"not null;default:0"`
+	// MergedTo is ID of the first batch imported by the same job, it is empty for the first batch.
+	// Batches of webhooks writing to the same table are merged to one CSV file.
+	MergedTo string `gorm:"type:CHAR(21);not null;default:''"`
+	// ImportedRows reported by the finished job, see Job.Results, it is the total of all merged batches
+	ImportedRows uint64 `gorm:"not null;default:0"`
+	// Size of the rows, it is used to estimate the upload timeout
+	Size       uint64    `gorm:"not null;default:0"`
+	Error      string    `gorm:"type:TEXT"`
+	CreatedAt  time.Time `gorm:"not null;index"`
+	FinishedAt *time.Time
+	// Result of the job created after the import, see Trigger
+	TriggerStatus string `gorm:"type:VARCHAR(20);not null;default:''"`
+	TriggerJobId  string `gorm:"type:VARCHAR(50);not null;default:''"`
+	TriggerError  string `gorm:"type:TEXT"`
+	// Columns of the CSV file, see Webhook.CsvHeader.
+	// Table columns missing in the rows can be appended, they are written with empty values.
+	Columns []string `gorm:"-"`
+}
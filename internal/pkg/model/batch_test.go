@@ -0,0 +1,18 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, time.Minute, RetryDelay(0))
+	assert.Equal(t, time.Minute, RetryDelay(1))
+	assert.Equal(t, 2*time.Minute, RetryDelay(2))
+	assert.Equal(t, 8*time.Minute, RetryDelay(4))
+	assert.Equal(t, MaxRetryBackoff, RetryDelay(10))
+	assert.Equal(t, MaxRetryBackoff, RetryDelay(1000))
+}
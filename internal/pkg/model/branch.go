@@ -0,0 +1,8 @@
+package model
+
+// Branch - Storage API development branch.
+type Branch struct {
+	Id        int    `json:"id" validate:"required"`
+	Name      string `json:"name" validate:"required"`
+	IsDefault bool   `json:"isDefault"`
+}
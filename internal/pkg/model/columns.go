@@ -0,0 +1,115 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+)
+
+const (
+	MetadataProvider        = "keboola.webhooks"
+	MetadataDescriptionKey  = "KBC.description"
+	MetadataHashKey         = "KBC.webhooks.hash"
+	MetadataRegisteredByKey = "KBC.webhooks.registeredBy"
+	DefaultColumnBaseType   = "STRING"
+)
+
+// ColumnType declares a native type of the column, it is used when the table is created.
+type ColumnType struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Length   string `json:"length,omitempty"`
+	Nullable bool   `json:"nullable"`
+}
+
+// ColumnTypes are stored in the DB as a JSON array.
+type ColumnTypes []ColumnType
+
+func NewColumnTypes(columns []*webhooks.ColumnType) (ColumnTypes, error) {
+	out := make(ColumnTypes, 0, len(columns))
+	seen := make(map[string]bool)
+	for _, column := range columns {
+		if column.Name == "" || column.Type == "" {
+			return nil, fmt.Errorf(`column name and type must be set`)
+		}
+		if seen[strings.ToLower(column.Name)] {
+			return nil, fmt.Errorf(`column "%s" is defined multiple times`, column.Name)
+		}
+		seen[strings.ToLower(column.Name)] = true
+
+		v := ColumnType{Name: column.Name, Type: strings.ToUpper(column.Type), Nullable: true}
+		if column.Length != nil {
+			v.Length = *column.Length
+		}
+		if column.Nullable != nil {
+			v.Nullable = *column.Nullable
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (v ColumnTypes) Payload() []*webhooks.ColumnType {
+	out := make([]*webhooks.ColumnType, 0, len(v))
+	for _, column := range v {
+		column := column
+		item := &webhooks.ColumnType{Name: column.Name, Type: column.Type, Nullable: &column.Nullable}
+		if column.Length != "" {
+			item.Length = &column.Length
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// Value implements driver.Valuer interface.
+func (v ColumnTypes) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return "", nil
+	}
+	return json.EncodeString(v, false)
+}
+
+// Scan implements sql.Scanner interface.
+func (v *ColumnTypes) Scan(value interface{}) error {
+	*v = nil
+	return scanJson(value, v)
+}
+
+// TableDefinition returns definition of a new table with the columns.
+// Columns without a declared type are created with the "STRING" base type.
+func (v *Webhook) TableDefinition(tableName string, columns []string) TableDefinition {
+	types := make(map[string]ColumnType)
+	for _, column := range v.ColumnTypes {
+		types[strings.ToLower(column.Name)] = column
+	}
+
+	definition := TableDefinition{Name: tableName}
+	if v.CreatePrimaryKey {
+		definition.PrimaryKey = v.PrimaryKeySlice()
+	}
+	for _, column := range columns {
+		if t, found := types[strings.ToLower(column)]; found {
+			nativeType := &ColumnNativeType{Type: t.Type, Length: t.Length, Nullable: t.Nullable}
+			definition.Columns = append(definition.Columns, ColumnDefinition{Name: column, Definition: nativeType})
+		} else {
+			definition.Columns = append(definition.Columns, ColumnDefinition{Name: column, BaseType: DefaultColumnBaseType})
+		}
+	}
+	return definition
+}
+
+// TableMetadata returns metadata of a table created by the webhook.
+func (v *Webhook) TableMetadata() []Metadata {
+	metadata := []Metadata{{Key: MetadataHashKey, Value: string(v.Hash)}}
+	if v.Description != "" {
+		metadata = append(metadata, Metadata{Key: MetadataDescriptionKey, Value: v.Description})
+	}
+	if v.RegisteredBy != "" {
+		metadata = append(metadata, Metadata{Key: MetadataRegisteredByKey, Value: v.RegisteredBy})
+	}
+	return metadata
+}
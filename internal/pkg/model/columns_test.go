@@ -0,0 +1,63 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+)
+
+func TestNewColumnTypes(t *testing.T) {
+	t.Parallel()
+	length := "38,0"
+	notNull := false
+	columnTypes, err := NewColumnTypes([]*webhooks.ColumnType{
+		{Name: "id", Type: "numeric", Length: &length, Nullable: &notNull},
+		{Name: "name", Type: "varchar"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ColumnTypes{
+		{Name: "id", Type: "NUMERIC", Length: "38,0", Nullable: false},
+		{Name: "name", Type: "VARCHAR", Nullable: true},
+	}, columnTypes)
+
+	_, err = NewColumnTypes([]*webhooks.ColumnType{{Name: "id", Type: "INT"}, {Name: "ID", Type: "INT"}})
+	assert.EqualError(t, err, `column "ID" is defined multiple times`)
+	_, err = NewColumnTypes([]*webhooks.ColumnType{{Name: "id"}})
+	assert.EqualError(t, err, `column name and type must be set`)
+}
+
+func TestWebhookTableDefinition(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{
+		PrimaryKey:  "id",
+		ColumnTypes: ColumnTypes{{Name: "ID", Type: "INTEGER", Nullable: false}},
+	}
+	expected := TableDefinition{
+		Name: "events",
+		Columns: []ColumnDefinition{
+			{Name: "id", Definition: &ColumnNativeType{Type: "INTEGER"}},
+			{Name: "body", BaseType: DefaultColumnBaseType},
+		},
+	}
+	assert.Equal(t, expected, webhook.TableDefinition("events", []string{"id", "body"}))
+
+	webhook.CreatePrimaryKey = true
+	expected.PrimaryKey = []string{"id"}
+	assert.Equal(t, expected, webhook.TableDefinition("events", []string{"id", "body"}))
+}
+
+func TestWebhookTableMetadata(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{Hash: "abc"}
+	assert.Equal(t, []Metadata{{Key: MetadataHashKey, Value: "abc"}}, webhook.TableMetadata())
+
+	webhook.Description = "Orders from the shop"
+	webhook.RegisteredBy = "john@example.com"
+	assert.Equal(t, []Metadata{
+		{Key: MetadataHashKey, Value: "abc"},
+		{Key: MetadataDescriptionKey, Value: "Orders from the shop"},
+		{Key: MetadataRegisteredByKey, Value: "john@example.com"},
+	}, webhook.TableMetadata())
+}
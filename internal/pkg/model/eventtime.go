@@ -0,0 +1,130 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/payload"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+)
+
+const (
+	EventTimeSourceHeader   = "header"
+	EventTimeSourceJsonPath = "jsonPath"
+	EventTimeSourceNone     = "none"
+	EventTimeFormatRfc3339  = "rfc3339"
+	EventTimeFormatUnix     = "unix"
+	EventTimeFormatUnixMs   = "unixMs"
+)
+
+// Event time is stored in the DATETIME column, so it must be in the range supported by MySQL.
+var (
+	MinEventTime           = time.Date(1000, 1, 1, 0, 0, 0, 0, time.UTC)
+	MaxEventTime           = time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC) // exclusive
+	errEventTimeOutOfRange = errors.New("out of range")
+)
+
+// EventTime defines where is the time of the event in the request.
+// Empty Source means that the receive time is used as the event time.
+type EventTime struct {
+	Source string `gorm:"type:VARCHAR(10);not null;default:''"`
+	Key    string `gorm:"type:VARCHAR(255);not null;default:''"`
+	Format string `gorm:"type:VARCHAR(10);not null;default:''"`
+}
+
+func NewEventTime(source, key string, format *string) (EventTime, error) {
+	v := EventTime{Source: source, Key: key, Format: EventTimeFormatRfc3339}
+	switch source {
+	case "", EventTimeSourceNone:
+		return EventTime{}, nil
+	case EventTimeSourceHeader, EventTimeSourceJsonPath:
+		if key == "" {
+			return v, fmt.Errorf(`event time key must be set for source "%s"`, source)
+		}
+	default:
+		return v, fmt.Errorf(`event time source "%s" is not supported, allowed values: %s, %s`, source, EventTimeSourceHeader, EventTimeSourceJsonPath)
+	}
+
+	if format != nil {
+		switch *format {
+		case EventTimeFormatRfc3339, EventTimeFormatUnix, EventTimeFormatUnixMs:
+			v.Format = *format
+		default:
+			return v, fmt.Errorf(`event time format "%s" is not supported, allowed values: %s, %s, %s`, *format, EventTimeFormatRfc3339, EventTimeFormatUnix, EventTimeFormatUnixMs)
+		}
+	}
+	return v, nil
+}
+
+func (v EventTime) Enabled() bool {
+	return v.Source != ""
+}
+
+// TimeOf returns the event time from the request, found is false if the value is not present.
+func (v EventTime) TimeOf(headers http.Header, body string) (value time.Time, found bool, err error) {
+	var str string
+	switch v.Source {
+	case EventTimeSourceHeader:
+		str = headers.Get(v.Key)
+	case EventTimeSourceJsonPath:
+		str, _, err = payload.JsonPathString(body, v.Key)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf(`cannot get event time "%s": %w`, v.Key, err)
+		}
+	default:
+		return time.Time{}, false, nil
+	}
+
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return time.Time{}, false, nil
+	}
+
+	value, err = v.parse(str)
+	if errors.Is(err, errEventTimeOutOfRange) {
+		return time.Time{}, false, fmt.Errorf(`event time "%s" must be between years %d and %d`, str, MinEventTime.Year(), MaxEventTime.Year()-1)
+	} else if err != nil {
+		return time.Time{}, false, fmt.Errorf(`event time "%s" is not in format "%s"`, str, v.Format)
+	}
+	return value, true, nil
+}
+
+func (v EventTime) parse(str string) (time.Time, error) {
+	switch v.Format {
+	case EventTimeFormatUnix, EventTimeFormatUnixMs:
+		number, err := strconv.ParseFloat(str, 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return time.Time{}, fmt.Errorf("invalid number")
+		}
+		if v.Format == EventTimeFormatUnix {
+			number *= 1000
+		}
+		// Check the range before the conversion, a big number overflows int64
+		number = math.Round(number)
+		if number < float64(MinEventTime.UnixMilli()) || number >= float64(MaxEventTime.UnixMilli()) {
+			return time.Time{}, errEventTimeOutOfRange
+		}
+		return time.UnixMilli(int64(number)).UTC(), nil
+	default:
+		value, err := time.Parse(time.RFC3339, str)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if value.Before(MinEventTime) || !value.Before(MaxEventTime) {
+			return time.Time{}, errEventTimeOutOfRange
+		}
+		return value, nil
+	}
+}
+
+func (v EventTime) Payload() *webhooks.EventTime {
+	if !v.Enabled() {
+		return nil
+	}
+	return &webhooks.EventTime{Source: v.Source, Key: &v.Key, Format: &v.Format}
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEventTime(t *testing.T) {
+	t.Parallel()
+	v, err := NewEventTime("jsonPath", "data.created", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, EventTime{Source: "jsonPath", Key: "data.created", Format: EventTimeFormatRfc3339}, v)
+	assert.True(t, v.Enabled())
+
+	format := "unixMs"
+	v, err = NewEventTime("header", "X-Event-Time", &format)
+	assert.NoError(t, err)
+	assert.Equal(t, EventTime{Source: "header", Key: "X-Event-Time", Format: EventTimeFormatUnixMs}, v)
+
+	v, err = NewEventTime("none", "", nil)
+	assert.NoError(t, err)
+	assert.False(t, v.Enabled())
+}
+
+func TestNewEventTimeInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := NewEventTime("header", "", nil)
+	assert.EqualError(t, err, `event time key must be set for source "header"`)
+
+	_, err = NewEventTime("bodyHash", "foo", nil)
+	assert.Contains(t, err.Error(), `event time source "bodyHash" is not supported`)
+
+	format := "iso"
+	_, err = NewEventTime("jsonPath", "time", &format)
+	assert.Contains(t, err.Error(), `event time format "iso" is not supported`)
+}
+
+func TestEventTimeOf(t *testing.T) {
+	t.Parallel()
+	headers := http.Header{}
+	headers.Set("X-Event-Time", "2022-03-10T13:00:00+01:00")
+	body := `{"created": 1646913600, "createdMs": 1646913600500, "date": "yesterday"}`
+	expected := time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	value, found, err := EventTime{Source: "header", Key: "X-Event-Time", Format: "rfc3339"}.TimeOf(headers, body)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, expected.Equal(value))
+
+	value, found, err = EventTime{Source: "jsonPath", Key: "created", Format: "unix"}.TimeOf(headers, body)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, expected, value)
+
+	value, found, err = EventTime{Source: "jsonPath", Key: "createdMs", Format: "unixMs"}.TimeOf(headers, body)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, expected.Add(500*time.Millisecond), value)
+
+	_, found, err = EventTime{Source: "jsonPath", Key: "missing", Format: "unix"}.TimeOf(headers, body)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, _, err = EventTime{Source: "jsonPath", Key: "date", Format: "rfc3339"}.TimeOf(headers, body)
+	assert.EqualError(t, err, `event time "yesterday" is not in format "rfc3339"`)
+}
+
+func TestEventTimeOfOutOfRange(t *testing.T) {
+	t.Parallel()
+	body := `{"big": 1e20, "negative": -40000000000, "max": 253402300799, "future": "10000-01-01T00:00:00Z", "past": "0999-12-31T23:59:59Z", "last": "9999-12-31T23:59:59Z"}`
+
+	// Unix timestamps
+	_, _, err := EventTime{Source: "jsonPath", Key: "big", Format: "unix"}.TimeOf(nil, body)
+	assert.EqualError(t, err, `event time "1e20" must be between years 1000 and 9999`)
+	_, _, err = EventTime{Source: "jsonPath", Key: "big", Format: "unixMs"}.TimeOf(nil, body)
+	assert.EqualError(t, err, `event time "1e20" must be between years 1000 and 9999`)
+	_, _, err = EventTime{Source: "jsonPath", Key: "negative", Format: "unix"}.TimeOf(nil, body)
+	assert.EqualError(t, err, `event time "-40000000000" must be between years 1000 and 9999`)
+	value, found, err := EventTime{Source: "jsonPath", Key: "max", Format: "unix"}.TimeOf(nil, body)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC), value)
+
+	// RFC3339
+	_, _, err = EventTime{Source: "jsonPath", Key: "future", Format: "rfc3339"}.TimeOf(nil, body)
+	assert.EqualError(t, err, `event time "10000-01-01T00:00:00Z" is not in format "rfc3339"`)
+	_, _, err = EventTime{Source: "jsonPath", Key: "past", Format: "rfc3339"}.TimeOf(nil, body)
+	assert.EqualError(t, err, `event time "0999-12-31T23:59:59Z" must be between years 1000 and 9999`)
+	value, found, err = EventTime{Source: "jsonPath", Key: "last", Format: "rfc3339"}.TimeOf(nil, body)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC), value)
+}
@@ -1,5 +1,11 @@
 package model
 
+const (
+	FileProviderAws   = "aws"
+	FileProviderAzure = "azure"
+	FileProviderGcp   = "gcp"
+)
+
 // FileResource .
 type FileResource struct {
 	Id           int    `json:"id" validate:"required"`
@@ -7,6 +13,7 @@ type FileResource struct {
 	Url          string `json:"url" validate:"required"`
 	Provider     string `json:"provider" validate:"required"`
 	Region       string `json:"region" validate:"required"`
+	IsSliced     bool   `json:"isSliced"`
 	UploadParams struct {
 		Key         string `json:"key" validate:"required"`
 		Bucket      string `json:"bucket" validate:"required"`
@@ -18,4 +25,22 @@ type FileResource struct {
 			Expiration      string `json:"expiration" validate:"required"`
 		}
 	}
+	// AbsUploadParams are set if the Provider is "azure"
+	AbsUploadParams struct {
+		BlobName    string `json:"blobName"`
+		AccountName string `json:"accountName"`
+		Container   string `json:"container"`
+		Credentials struct {
+			SASConnectionString string `json:"SASConnectionString"`
+			Expiration          string `json:"expiration"`
+		} `json:"absCredentials"`
+	} `json:"absUploadParams"`
+	// GcsUploadParams are set if the Provider is "gcp"
+	GcsUploadParams struct {
+		ProjectId   string `json:"projectId"`
+		Bucket      string `json:"bucket"`
+		Key         string `json:"key"`
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	} `json:"gcsUploadParams"`
 }
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/rand"
+	"net/http"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+)
+
+const (
+	DropRuleSourceHeader   = RouteSourceHeader
+	DropRuleSourceJsonPath = RouteSourceJsonPath
+	DefaultSampleRate      = 1.0
+)
+
+// DropRule drops the event, if the header or the JSON path value is equal to the Value.
+type DropRule struct {
+	Source string `json:"source"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+}
+
+// DropRules are stored in the DB as a JSON array.
+type DropRules []DropRule
+
+func NewDropRule(source, key, value string) (DropRule, error) {
+	v := DropRule{Source: source, Key: key, Value: value}
+	if source != DropRuleSourceHeader && source != DropRuleSourceJsonPath {
+		return v, fmt.Errorf(`drop rule source "%s" is not supported, allowed values: %s, %s`, source, DropRuleSourceHeader, DropRuleSourceJsonPath)
+	}
+	if key == "" {
+		return v, fmt.Errorf(`drop rule key must be set`)
+	}
+	return v, nil
+}
+
+func (v DropRule) Matches(headers http.Header, body string) bool {
+	return matchesValue(v.Source, v.Key, v.Value, headers, body)
+}
+
+// Matches returns true if any rule matches the event.
+func (v DropRules) Matches(headers http.Header, body string) bool {
+	for _, rule := range v {
+		if rule.Matches(headers, body) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v DropRules) Payload() []*webhooks.DropRule {
+	out := make([]*webhooks.DropRule, 0, len(v))
+	for _, rule := range v {
+		out = append(out, &webhooks.DropRule{Source: rule.Source, Key: rule.Key, Value: rule.Value})
+	}
+	return out
+}
+
+// Value implements driver.Valuer interface.
+func (v DropRules) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return "", nil
+	}
+	return json.EncodeString(v, false)
+}
+
+// Scan implements sql.Scanner interface.
+func (v *DropRules) Scan(value interface{}) error {
+	*v = nil
+	return scanJson(value, v)
+}
+
+func (v *Webhook) SetSampleRate(rate float64) error {
+	if rate <= 0 || rate > 1 {
+		return fmt.Errorf(`sample rate must be greater than 0 and less than or equal to 1, found "%v"`, rate)
+	}
+	v.SampleRate = rate
+	return nil
+}
+
+// Drops returns true if the event should not be stored, because it matches a drop rule or it is not sampled.
+func (v *Webhook) Drops(headers http.Header, body string) bool {
+	if v.DropRules.Matches(headers, body) {
+		return true
+	}
+	return v.SampleRate > 0 && v.SampleRate < 1 && rand.Float64() >= v.SampleRate // nolint:gosec // sampling does not need a secure random
+}
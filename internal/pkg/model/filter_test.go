@@ -0,0 +1,57 @@
+package model
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDropRuleInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := NewDropRule("bodyHash", "foo", "bar")
+	assert.Contains(t, err.Error(), `drop rule source "bodyHash" is not supported`)
+
+	_, err = NewDropRule("jsonPath", "", "ping")
+	assert.EqualError(t, err, `drop rule key must be set`)
+}
+
+func TestWebhookSetSampleRate(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{}
+	assert.NoError(t, webhook.SetSampleRate(0.25))
+	assert.Equal(t, 0.25, webhook.SampleRate)
+	assert.EqualError(t, webhook.SetSampleRate(0), `sample rate must be greater than 0 and less than or equal to 1, found "0"`)
+	assert.EqualError(t, webhook.SetSampleRate(1.5), `sample rate must be greater than 0 and less than or equal to 1, found "1.5"`)
+}
+
+func TestWebhookDrops(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{
+		SampleRate: 1,
+		DropRules: DropRules{
+			{Source: "header", Key: "X-GitHub-Event", Value: "ping"},
+			{Source: "jsonPath", Key: "type", Value: "charge.updated"},
+		},
+	}
+
+	headers := http.Header{}
+	headers.Set("X-GitHub-Event", "ping")
+	assert.True(t, webhook.Drops(headers, `{}`))
+	assert.True(t, webhook.Drops(http.Header{}, `{"type": "charge.updated"}`))
+	assert.False(t, webhook.Drops(http.Header{}, `{"type": "charge.succeeded"}`))
+
+	// Sampling
+	webhook = &Webhook{SampleRate: 0.5}
+	dropped := 0
+	for i := 0; i < 1000; i++ {
+		if webhook.Drops(http.Header{}, `{}`) {
+			dropped++
+		}
+	}
+	assert.Greater(t, dropped, 350)
+	assert.Less(t, dropped, 650)
+
+	// Zero sample rate, webhook created before sampling was introduced
+	assert.False(t, (&Webhook{}).Drops(http.Header{}, `{}`))
+}
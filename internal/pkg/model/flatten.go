@@ -0,0 +1,83 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/payload"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/orderedmap"
+)
+
+// FlattenColumns are columns of the flattened body per target table, see Webhook.Flatten.
+// The column order is stable, new columns are appended in the order of appearance.
+// Columns are stored in the DB as a JSON object.
+type FlattenColumns map[string][]string
+
+// Add appends the columns which are not present yet, the added columns are returned.
+func (v FlattenColumns) Add(tableId string, columns []string) (added []string) {
+	exists := make(map[string]bool)
+	for _, column := range v[tableId] {
+		exists[column] = true
+	}
+	for _, column := range columns {
+		if !exists[column] {
+			exists[column] = true
+			added = append(added, column)
+		}
+	}
+	if len(added) > 0 {
+		v[tableId] = append(v[tableId], added...)
+	}
+	return added
+}
+
+// FlattenColumnsOf returns the flattened body columns of the target table, or nil if the flatten mode is disabled.
+func (v *Webhook) FlattenColumnsOf(tableId string) []string {
+	if !v.Flatten {
+		return nil
+	}
+	return v.FlattenColumns[tableId]
+}
+
+// Value implements driver.Valuer interface.
+func (v FlattenColumns) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return "", nil
+	}
+	return json.EncodeString(v, false)
+}
+
+// Scan implements sql.Scanner interface.
+func (v *FlattenColumns) Scan(value interface{}) error {
+	*v = make(FlattenColumns)
+	return scanJson(value, v)
+}
+
+// Flatten sets the flattened body, see payload.Flatten.
+// A column with the same name as a fixed column, for example "timestamp", gets the "body__" prefix.
+func (r *Row) Flatten(webhook *Webhook) error {
+	flat, err := payload.Flatten(r.Body)
+	if err != nil {
+		return err
+	}
+
+	fixed := make(map[string]bool)
+	for _, column := range webhook.CsvHeader(nil) {
+		fixed[column] = true
+	}
+
+	r.Flattened = orderedmap.New()
+	for _, column := range flat.Keys() {
+		value := flat.GetOrNil(column)
+		if fixed[column] {
+			renamed := "body" + payload.FlattenSeparator + column
+			if _, found := flat.Get(renamed); found {
+				return fmt.Errorf(`keys "%s" and "%s" are both flattened to column "%s"`, column, renamed, renamed)
+			}
+			column = renamed
+		}
+		r.Flattened.Set(column, value)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenColumnsAdd(t *testing.T) {
+	t.Parallel()
+	columns := make(FlattenColumns)
+	assert.Equal(t, []string{"id", "name"}, columns.Add("in.c-bucket.table", []string{"id", "name"}))
+	assert.Equal(t, []string{"email"}, columns.Add("in.c-bucket.table", []string{"email", "id"}))
+	assert.Empty(t, columns.Add("in.c-bucket.table", []string{"name"}))
+	assert.Equal(t, []string{"id", "name", "email"}, columns["in.c-bucket.table"])
+
+	value, err := columns.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"in.c-bucket.table":["id","name","email"]}`, value)
+
+	var scanned FlattenColumns
+	assert.NoError(t, scanned.Scan([]byte(value.(string))))
+	assert.Equal(t, columns, scanned)
+}
+
+func TestWebhookCsvFlatten(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{Flatten: true}
+	row := &Row{
+		Time:    time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC),
+		Headers: `{}`,
+		Body:    `{"id": 1, "timestamp": "x", "customer": {"name": "John"}}`,
+	}
+	assert.NoError(t, row.Flatten(webhook))
+	assert.Equal(t, []string{"id", "body__timestamp", "customer__name"}, row.Flattened.Keys())
+
+	columns := []string{"customer__name", "email", "id", "body__timestamp"}
+	assert.Equal(t, []string{"timestamp", "headers", "customer__name", "email", "id", "body__timestamp"}, webhook.CsvHeader(columns))
+	assert.Equal(t, []string{"2022-03-10T12:00:00Z", `{}`, "John", "", "1", "x"}, row.CsvRow(webhook, columns))
+
+	row.Body = `{"timestamp": "x", "body__timestamp": "y"}`
+	assert.EqualError(t, row.Flatten(webhook), `keys "timestamp" and "body__timestamp" are both flattened to column "body__timestamp"`)
+
+	row.Body = `"foo"`
+	assert.EqualError(t, row.Flatten(webhook), "body is not a JSON object")
+}
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/payload"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+)
+
+const (
+	IdempotencySourceHeader   = "header"
+	IdempotencySourceJsonPath = "jsonPath"
+	IdempotencySourceBodyHash = "bodyHash"
+	IdempotencySourceNone     = "none"
+	DefaultIdempotencyWindow  = 24 * time.Hour
+	MaxIdempotencyWindow      = ReceiptRetention
+)
+
+// Idempotency defines how to detect a repeated delivery of the same event.
+// Empty Source means that duplicates are not detected.
+type Idempotency struct {
+	Source string        `gorm:"type:VARCHAR(10);not null;default:''"`
+	Key    string        `gorm:"type:VARCHAR(255);not null;default:''"`
+	Window time.Duration `gorm:"not null;default:0"`
+}
+
+func NewIdempotency(source, key string, window *string) (Idempotency, error) {
+	v := Idempotency{Source: source, Key: key, Window: DefaultIdempotencyWindow}
+	switch source {
+	case "", IdempotencySourceNone:
+		return Idempotency{}, nil
+	case IdempotencySourceHeader, IdempotencySourceJsonPath:
+		if key == "" {
+			return v, fmt.Errorf(`idempotency key must be set for source "%s"`, source)
+		}
+	case IdempotencySourceBodyHash:
+		v.Key = ""
+	default:
+		return v, fmt.Errorf(`idempotency source "%s" is not supported, allowed values: %s, %s, %s`, source, IdempotencySourceHeader, IdempotencySourceJsonPath, IdempotencySourceBodyHash)
+	}
+
+	if window != nil {
+		duration, err := time.ParseDuration(*window)
+		if err != nil {
+			return v, errors.New("invalid idempotency window value. use format Xs|m|h")
+		}
+		if duration <= 0 || duration > MaxIdempotencyWindow {
+			return v, fmt.Errorf("idempotency window must be between 0 and %s", MaxIdempotencyWindow)
+		}
+		v.Window = duration
+	}
+	return v, nil
+}
+
+func (v Idempotency) Enabled() bool {
+	return v.Source != ""
+}
+
+// KeyOf returns the idempotency key of the delivery, empty string if the key is not present.
+// The key is a SHA-256 hash, so it has a fixed length regardless of the header or body value, see Receipt.IdempotencyKey.
+func (v Idempotency) KeyOf(headers http.Header, body string) (string, error) {
+	switch v.Source {
+	case IdempotencySourceHeader:
+		return hashKey(headers.Get(v.Key)), nil
+	case IdempotencySourceJsonPath:
+		value, _, err := payload.JsonPathString(body, v.Key)
+		if err != nil {
+			return "", fmt.Errorf(`cannot get idempotency key "%s": %w`, v.Key, err)
+		}
+		return hashKey(value), nil
+	case IdempotencySourceBodyHash:
+		return hashKey(body), nil
+	default:
+		return "", nil
+	}
+}
+
+// hashKey returns SHA-256 of the value in hex, empty value means no key.
+func hashKey(value string) string {
+	if value == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+func (v Idempotency) Payload() *webhooks.Idempotency {
+	if !v.Enabled() {
+		return nil
+	}
+	window := v.Window.String()
+	out := &webhooks.Idempotency{Source: v.Source, Window: &window}
+	if v.Key != "" {
+		out.Key = &v.Key
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIdempotency(t *testing.T) {
+	t.Parallel()
+	v, err := NewIdempotency("header", "X-GitHub-Delivery", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Idempotency{Source: "header", Key: "X-GitHub-Delivery", Window: DefaultIdempotencyWindow}, v)
+	assert.True(t, v.Enabled())
+
+	window := "1h"
+	v, err = NewIdempotency("bodyHash", "ignored", &window)
+	assert.NoError(t, err)
+	assert.Equal(t, Idempotency{Source: "bodyHash", Window: time.Hour}, v)
+
+	v, err = NewIdempotency("none", "", nil)
+	assert.NoError(t, err)
+	assert.False(t, v.Enabled())
+}
+
+func TestNewIdempotencyInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := NewIdempotency("jsonPath", "", nil)
+	assert.EqualError(t, err, `idempotency key must be set for source "jsonPath"`)
+
+	_, err = NewIdempotency("cookie", "foo", nil)
+	assert.Contains(t, err.Error(), `idempotency source "cookie" is not supported`)
+
+	window := "10d"
+	_, err = NewIdempotency("bodyHash", "", &window)
+	assert.EqualError(t, err, "invalid idempotency window value. use format Xs|m|h")
+
+	window = "200h"
+	_, err = NewIdempotency("bodyHash", "", &window)
+	assert.EqualError(t, err, "idempotency window must be between 0 and 168h0m0s")
+}
+
+func TestIdempotencyKeyOf(t *testing.T) {
+	t.Parallel()
+	headers := http.Header{}
+	headers.Set("Idempotency-Key", "abc")
+	body := `{"event": {"id": "evt_1"}}`
+
+	key, err := Idempotency{Source: "header", Key: "Idempotency-Key"}.KeyOf(headers, body)
+	assert.NoError(t, err)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", key) // sha256("abc")
+
+	key, err = Idempotency{Source: "jsonPath", Key: "event.id"}.KeyOf(headers, body)
+	assert.NoError(t, err)
+	assert.Len(t, key, 64)
+	assert.NotEqual(t, "evt_1", key)
+
+	key, err = Idempotency{Source: "bodyHash"}.KeyOf(headers, body)
+	assert.NoError(t, err)
+	assert.Len(t, key, 64)
+
+	// Missing header is not hashed
+	key, err = Idempotency{Source: "header", Key: "X-Missing"}.KeyOf(headers, body)
+	assert.NoError(t, err)
+	assert.Equal(t, "", key)
+
+	// Long header has the same length as a short one
+	headers.Set("Idempotency-Key", strings.Repeat("x", 1000))
+	key, err = Idempotency{Source: "header", Key: "Idempotency-Key"}.KeyOf(headers, body)
+	assert.NoError(t, err)
+	assert.Len(t, key, 64)
+
+	key, err = Idempotency{}.KeyOf(headers, body)
+	assert.NoError(t, err)
+	assert.Equal(t, "", key)
+}
@@ -1,14 +1,69 @@
 package model
 
+import (
+	"fmt"
+
+	"github.com/spf13/cast"
+)
+
+const (
+	JobStatusWaiting    = "waiting"
+	JobStatusProcessing = "processing"
+	JobStatusSuccess    = "success"
+	JobStatusError      = "error"
+	// JobOperationTableCreate is the operation of a job created by the table create from a file.
+	JobOperationTableCreate = "tableCreate"
+)
+
 type JobError struct {
 	Message string `json:"message" validate:"required"`
 }
 
 // Job - Storage API job.
 type Job struct {
-	Id      int                    `json:"id" validate:"required"`
-	Error   JobError               `json:"error" validate:"required"`
-	Status  string                 `json:"status" validate:"required"`
-	Url     string                 `json:"url" validate:"required"`
-	Results map[string]interface{} `json:"results"`
+	Id            int                    `json:"id" validate:"required"`
+	Error         JobError               `json:"error" validate:"required"`
+	Status        string                 `json:"status" validate:"required"`
+	OperationName string                 `json:"operationName"`
+	Url           string                 `json:"url" validate:"required"`
+	Results       map[string]interface{} `json:"results"`
+}
+
+// IsFinished returns true if the job ended with success or error.
+func (j *Job) IsFinished() bool {
+	return j.Status == JobStatusSuccess || j.Status == JobStatusError
+}
+
+// Err returns error of a failed job.
+func (j *Job) Err() error {
+	if j.Status == JobStatusError {
+		return fmt.Errorf("job %d failed: %s", j.Id, j.Error.Message)
+	}
+	return nil
+}
+
+// ImportedRowsCount returns count of rows imported by a table import or create job.
+func (j *Job) ImportedRowsCount() uint64 {
+	return cast.ToUint64(j.Results["importedRowsCount"])
+}
+
+// Warnings returns warnings of a table import or create job, for example about ignored columns.
+func (j *Job) Warnings() []string {
+	var warnings []string
+	items, _ := j.Results["warnings"].([]interface{})
+	for _, item := range items {
+		if warning, ok := item.(map[string]interface{}); ok {
+			warnings = append(warnings, cast.ToString(warning["message"]))
+		} else {
+			warnings = append(warnings, cast.ToString(item))
+		}
+	}
+	return warnings
+}
+
+// QueueJob - Queue API job, for example a flow run.
+type QueueJob struct {
+	Id     string `json:"id" validate:"required"`
+	Status string `json:"status" validate:"required"`
+	Url    string `json:"url"`
 }
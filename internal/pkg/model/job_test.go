@@ -0,0 +1,40 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobResults(t *testing.T) {
+	t.Parallel()
+	job := &Job{}
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"id": 123,
+		"status": "success",
+		"operationName": "tableImport",
+		"results": {
+			"importedRowsCount": 1500,
+			"warnings": [{"message": "Column \"foo\" was ignored."}]
+		}
+	}`), job))
+	assert.True(t, job.IsFinished())
+	assert.NoError(t, job.Err())
+	assert.Equal(t, uint64(1500), job.ImportedRowsCount())
+	assert.Equal(t, []string{`Column "foo" was ignored.`}, job.Warnings())
+}
+
+func TestJobErr(t *testing.T) {
+	t.Parallel()
+	job := &Job{Id: 123, Status: JobStatusProcessing}
+	assert.False(t, job.IsFinished())
+	assert.NoError(t, job.Err())
+
+	job.Status = JobStatusError
+	job.Error.Message = "Some columns are missing in the csv file."
+	assert.True(t, job.IsFinished())
+	assert.EqualError(t, job.Err(), "job 123 failed: Some columns are missing in the csv file.")
+	assert.Equal(t, uint64(0), job.ImportedRowsCount())
+	assert.Empty(t, job.Warnings())
+}
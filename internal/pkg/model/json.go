@@ -0,0 +1,26 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+)
+
+// scanJson decodes a JSON value stored in the DB, empty value is skipped.
+func scanJson(value interface{}, target interface{}) error {
+	var str string
+	switch value := value.(type) {
+	case nil:
+	case []byte:
+		str = string(value)
+	case string:
+		str = value
+	default:
+		return fmt.Errorf(`cannot scan JSON value from "%T"`, value)
+	}
+
+	if str == "" {
+		return nil
+	}
+	return json.DecodeString(str, target)
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+// JobTrackerLease is held by the replica tracking Storage jobs.
+const JobTrackerLease = "job-tracker"
+
+// Lease is a lock stored in the database, so it is shared by all API replicas.
+// The owner renews the lease by a heartbeat, an expired lease can be acquired by another owner.
+type Lease struct {
+	Name        string    `gorm:"type:VARCHAR(255);primaryKey"`
+	Owner       string    `gorm:"type:VARCHAR(255);not null"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	HeartbeatAt time.Time `gorm:"not null"`
+}
+
+// ImportLeasePrefix is the prefix of the lease held by the import of a webhook, see ImportLease.
+const ImportLeasePrefix = "import/"
+
+// ImportLease returns name of the lease held by the import of the webhook.
+func ImportLease(hash WebhookHash) string {
+	return ImportLeasePrefix + string(hash)
+}
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/payload"
+)
+
+const (
+	LoadTypeAppend  = "append"
+	LoadTypeUpsert  = "upsert"
+	LoadTypeReplace = "replace"
+)
+
+// PrimaryKeySlice returns the primary key columns of the webhook table.
+func (v *Webhook) PrimaryKeySlice() []string {
+	if v.PrimaryKey == "" {
+		return nil
+	}
+	return strings.Split(v.PrimaryKey, ",")
+}
+
+// SetPrimaryKey sets the primary key columns, empty slice removes the primary key.
+func (v *Webhook) SetPrimaryKey(columns []string) error {
+	var out []string
+	seen := make(map[string]bool)
+	for _, column := range columns {
+		column = strings.TrimSpace(column)
+		if column == "" || strings.Contains(column, ",") {
+			return fmt.Errorf(`primary key column "%s" is not valid`, column)
+		}
+		if !seen[strings.ToLower(column)] {
+			seen[strings.ToLower(column)] = true
+			out = append(out, column)
+		}
+	}
+	v.PrimaryKey = strings.Join(out, ",")
+	return nil
+}
+
+func (v *Webhook) SetLoadType(loadType string) error {
+	if loadType != LoadTypeAppend && loadType != LoadTypeUpsert && loadType != LoadTypeReplace {
+		return fmt.Errorf(`load type "%s" is not supported, allowed values: %s, %s, %s`, loadType, LoadTypeAppend, LoadTypeUpsert, LoadTypeReplace)
+	}
+	v.LoadType = loadType
+	return nil
+}
+
+// ValidateLoad checks that the load options are consistent.
+func (v *Webhook) ValidateLoad() error {
+	if v.LoadType == LoadTypeUpsert && v.PrimaryKey == "" {
+		return fmt.Errorf(`load type "%s" requires the primary key`, LoadTypeUpsert)
+	}
+	if v.CreatePrimaryKey && v.PrimaryKey == "" {
+		return fmt.Errorf(`the table cannot be created with the primary key, the primary key is not set`)
+	}
+	return v.validatePrimaryKeyColumns()
+}
+
+// validatePrimaryKeyColumns checks that the primary key columns can be present in the CSV file, see Webhook.CsvHeader.
+// In the flatten mode, a column can be any flattened key, otherwise only the fixed columns are written.
+func (v *Webhook) validatePrimaryKeyColumns() error {
+	fixed := make(map[string]bool)
+	for _, column := range v.CsvHeader(nil) {
+		fixed[strings.ToLower(column)] = true
+	}
+	for _, column := range v.PrimaryKeySlice() {
+		switch {
+		case fixed[strings.ToLower(column)]:
+			continue
+		case !v.Flatten:
+			return fmt.Errorf(`primary key column "%s" is not written by the webhook, allowed columns: "%s", or enable the flatten mode`, column, strings.Join(v.CsvHeader(nil), `", "`))
+		case payload.ColumnName(column) != column:
+			return fmt.Errorf(`primary key column "%s" cannot be a flattened column, allowed characters: a-z, A-Z, 0-9, "_"`, column)
+		}
+	}
+	return nil
+}
+
+// Incremental returns false if the table content should be replaced by the import.
+func (v *Webhook) Incremental() bool {
+	return v.LoadType != LoadTypeReplace
+}
+
+// SamePrimaryKey returns true if the table primary key is equal to the webhook primary key, column names are case-insensitive.
+func (v *Webhook) SamePrimaryKey(tablePrimaryKey []string) bool {
+	primaryKey := v.PrimaryKeySlice()
+	if len(primaryKey) != len(tablePrimaryKey) {
+		return false
+	}
+	columns := make(map[string]bool)
+	for _, column := range tablePrimaryKey {
+		columns[strings.ToLower(column)] = true
+	}
+	for _, column := range primaryKey {
+		if !columns[strings.ToLower(column)] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookSetPrimaryKey(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{}
+	assert.NoError(t, webhook.SetPrimaryKey([]string{"id", " type", "ID"}))
+	assert.Equal(t, "id,type", webhook.PrimaryKey)
+	assert.Equal(t, []string{"id", "type"}, webhook.PrimaryKeySlice())
+
+	assert.NoError(t, webhook.SetPrimaryKey([]string{}))
+	assert.Nil(t, webhook.PrimaryKeySlice())
+
+	assert.EqualError(t, webhook.SetPrimaryKey([]string{"a,b"}), `primary key column "a,b" is not valid`)
+}
+
+func TestWebhookLoadType(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{}
+	assert.NoError(t, webhook.SetLoadType(LoadTypeReplace))
+	assert.False(t, webhook.Incremental())
+	assert.Contains(t, webhook.SetLoadType("merge").Error(), `load type "merge" is not supported`)
+
+	assert.NoError(t, webhook.SetLoadType(LoadTypeUpsert))
+	assert.True(t, webhook.Incremental())
+	assert.EqualError(t, webhook.ValidateLoad(), `load type "upsert" requires the primary key`)
+
+	webhook.PrimaryKey = "id,type"
+	webhook.Flatten = true
+	assert.NoError(t, webhook.ValidateLoad())
+	assert.True(t, webhook.SamePrimaryKey([]string{"TYPE", "id"}))
+	assert.False(t, webhook.SamePrimaryKey([]string{"id"}))
+}
+
+func TestWebhookValidatePrimaryKeyColumns(t *testing.T) {
+	t.Parallel()
+
+	// Only the fixed columns are written without the flatten mode
+	webhook := &Webhook{LoadType: LoadTypeUpsert, PrimaryKey: "id"}
+	assert.EqualError(t, webhook.ValidateLoad(), `primary key column "id" is not written by the webhook, allowed columns: "timestamp", "headers", "body", or enable the flatten mode`)
+
+	webhook.CloudEvents = true
+	webhook.PrimaryKey = "EVENT_ID"
+	assert.NoError(t, webhook.ValidateLoad())
+
+	// A flattened key can be the primary key
+	webhook.Flatten = true
+	webhook.PrimaryKey = "id,customer__id"
+	assert.NoError(t, webhook.ValidateLoad())
+
+	webhook.PrimaryKey = "customer.id"
+	assert.EqualError(t, webhook.ValidateLoad(), `primary key column "customer.id" cannot be a flattened column, allowed characters: a-z, A-Z, 0-9, "_"`)
+}
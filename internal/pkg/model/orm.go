@@ -2,32 +2,209 @@ package model
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/orderedmap"
+)
+
+const (
+	ResponseJson   = "json"
+	ResponsePixel  = "pixel"
+	BodyFormatAuto = "auto"
+	BodyFormatXml  = "xml"
 )
 
+var AllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch}
+
 type WebhookHash string
 
 type Webhook struct {
-	Id         uint32      `gorm:"primaryKey;autoIncrement"`
-	Hash       WebhookHash `gorm:"type:CHAR(21);index;not null"`
-	ProjectId  uint32
-	Token      string `gorm:"type:VARCHAR(255);not null"`
-	TableId    string `gorm:"type:VARCHAR(1000);not null"`
-	Size       uint64
-	ImportedAt time.Time  `gorm:"not null"`
-	Conditions Conditions `gorm:"embedded;embeddedPrefix:condition_"`
-	Data       []Row      `gorm:"foreignKey:Webhook"` // only for FK definition
+	Id   uint32      `gorm:"primaryKey;autoIncrement"`
+	Hash WebhookHash `gorm:"type:CHAR(21);index;not null"`
+	// StorageApiHost of the project stack, empty means the default host of the service
+	StorageApiHost string `gorm:"type:VARCHAR(255);not null;default:''"`
+	ProjectId      uint32
+	Token          string `gorm:"type:VARCHAR(255);not null"`
+	TableId        string `gorm:"type:VARCHAR(1000);not null"`
+	Size           uint64
+	ImportedAt     time.Time   `gorm:"not null"`
+	Conditions     Conditions  `gorm:"embedded;embeddedPrefix:condition_"`
+	Methods        string      `gorm:"type:VARCHAR(50);not null;default:POST"`
+	Response       string      `gorm:"type:VARCHAR(10);not null;default:json"`
+	BodyFormat     string      `gorm:"type:VARCHAR(10);not null;default:auto"`
+	CloudEvents    bool        `gorm:"not null;default:false"`
+	Schema         string      `gorm:"type:MEDIUMTEXT"`
+	Idempotency    Idempotency `gorm:"embedded;embeddedPrefix:idempotency_"`
+	EventTime      EventTime   `gorm:"embedded;embeddedPrefix:event_time_"`
+	Routes         Routes      `gorm:"type:TEXT"`
+	DropRules      DropRules   `gorm:"type:TEXT"`
+	SampleRate     float64     `gorm:"not null;default:1"`
+	Stats          Stats       `gorm:"embedded;embeddedPrefix:stats_"`
+	// Flatten stores the JSON body flattened to columns, instead of the "body" column
+	Flatten        bool           `gorm:"not null;default:false"`
+	FlattenColumns FlattenColumns `gorm:"type:MEDIUMTEXT"`
+	// FixedColumns disables adding columns missing in the table, the import fails instead
+	FixedColumns bool `gorm:"not null;default:false"`
+	// PrimaryKey columns separated by comma, see LoadType
+	PrimaryKey       string `gorm:"type:VARCHAR(1000);not null;default:''"`
+	LoadType         string `gorm:"type:VARCHAR(10);not null;default:append"`
+	CreatePrimaryKey bool   `gorm:"not null;default:false"`
+	// ColumnTypes of the auto-created table, see Webhook.TableDefinition
+	ColumnTypes  ColumnTypes `gorm:"type:TEXT"`
+	Description  string      `gorm:"type:TEXT"`
+	RegisteredBy string      `gorm:"type:VARCHAR(255);not null;default:''"`
+	Trigger      Trigger     `gorm:"embedded;embeddedPrefix:trigger_"`
+	// BranchId of the development branch, 0 means the default branch
+	BranchId int `gorm:"not null;default:0"`
+	// RetryAt delays the next import after a failed import, see RetryDelay
+	RetryAt  *time.Time
+	Data     []Row     `gorm:"foreignKey:Webhook"` // only for FK definition
+	Receipts []Receipt `gorm:"foreignKey:Webhook"` // only for FK definition
+	Batches  []Batch   `gorm:"foreignKey:Webhook"` // only for FK definition
 }
 
 func (v *Webhook) Url(host string) string {
 	return fmt.Sprintf("https://%s/import/%s", host, v.Hash)
 }
 
+// MethodsSlice returns HTTP methods accepted on the import URL.
+func (v *Webhook) MethodsSlice() []string {
+	if v.Methods == "" {
+		return []string{http.MethodPost}
+	}
+	return strings.Split(v.Methods, ",")
+}
+
+func (v *Webhook) AllowsMethod(method string) bool {
+	for _, m := range v.MethodsSlice() {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Webhook) SetMethods(methods []string) error {
+	if len(methods) == 0 {
+		return fmt.Errorf("at least one method must be allowed")
+	}
+
+	var out []string
+	seen := make(map[string]bool)
+	for _, method := range methods {
+		method = strings.ToUpper(method)
+		if !isAllowedMethod(method) {
+			return fmt.Errorf(`method "%s" is not supported, allowed values: %s`, method, strings.Join(AllowedMethods, ", "))
+		}
+		if !seen[method] {
+			seen[method] = true
+			out = append(out, method)
+		}
+	}
+	v.Methods = strings.Join(out, ",")
+	return nil
+}
+
+func (v *Webhook) SetResponse(response string) error {
+	if response != ResponseJson && response != ResponsePixel {
+		return fmt.Errorf(`response "%s" is not supported, allowed values: %s, %s`, response, ResponseJson, ResponsePixel)
+	}
+	v.Response = response
+	return nil
+}
+
+func (v *Webhook) SetBodyFormat(format string) error {
+	if format != BodyFormatAuto && format != BodyFormatXml {
+		return fmt.Errorf(`body format "%s" is not supported, allowed values: %s, %s`, format, BodyFormatAuto, BodyFormatXml)
+	}
+	v.BodyFormat = format
+	return nil
+}
+
+// TableIdOf returns the target table of the event, see Routes.
+func (v *Webhook) TableIdOf(headers http.Header, body string) string {
+	if tableId := v.Routes.TableIdOf(headers, body); tableId != "" {
+		return tableId
+	}
+	return v.TableId
+}
+
+func isAllowedMethod(method string) bool {
+	for _, m := range AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
 type Row struct {
-	Webhook uint32
-	Time    time.Time `gorm:"not null"`
-	Headers string    `gorm:"not null"`
-	Body    string    `gorm:"not null"`
+	// Id orders the rows with the same time, the rows of a batch are read in chunks, see storage.Storage.WriteBatch
+	Id           uint64 `gorm:"primaryKey;autoIncrement"`
+	Webhook      uint32
+	ReceiptId    string    `gorm:"type:CHAR(21);not null;default:''"`
+	TableId      string    `gorm:"type:VARCHAR(1000);not null;default:''"`
+	BatchId      string    `gorm:"type:CHAR(21);not null;default:'';index"`
+	Time         time.Time `gorm:"not null"`
+	ReceivedAt   time.Time `gorm:"default:null"`
+	Headers      string    `gorm:"not null"`
+	Body         string    `gorm:"not null"`
+	EventId      string    `gorm:"type:VARCHAR(255);not null;default:''"`
+	EventSource  string    `gorm:"type:VARCHAR(1000);not null;default:''"`
+	EventType    string    `gorm:"type:VARCHAR(255);not null;default:''"`
+	EventSubject string    `gorm:"type:VARCHAR(1000);not null;default:''"`
+	EventTime    string    `gorm:"type:VARCHAR(50);not null;default:''"`
+	// Attempts is the number of failed imports of the row, see MaxImportAttempts
+	Attempts uint `gorm:"not null;default:0"`
+	// IdempotencyKey is stored in the receipt, it is used to detect a repeated delivery, see Idempotency
+	IdempotencyKey string `gorm:"-"`
+	// Flattened body, it is set before writing to CSV, see Webhook.Flatten
+	Flattened *orderedmap.OrderedMap `gorm:"-"`
+}
+
+// CsvHeader returns columns of the CSV file imported to the webhook table.
+// In the flatten mode, the "body" column is replaced by the flattened body columns.
+func (v *Webhook) CsvHeader(flattenColumns []string) []string {
+	header := []string{"timestamp", "headers"}
+	if !v.Flatten {
+		header = append(header, "body")
+	}
+	if v.CloudEvents {
+		header = append(header, "event_id", "event_source", "event_type", "event_subject", "event_time")
+	}
+	if v.EventTime.Enabled() {
+		header = append(header, "received_at")
+	}
+	if v.Flatten {
+		header = append(header, flattenColumns...)
+	}
+	return header
+}
+
+// CsvRow returns the row values in the order defined by Webhook.CsvHeader.
+func (r *Row) CsvRow(webhook *Webhook, flattenColumns []string) []string {
+	row := []string{r.Time.UTC().Format(time.RFC3339), r.Headers}
+	if !webhook.Flatten {
+		row = append(row, r.Body)
+	}
+	if webhook.CloudEvents {
+		row = append(row, r.EventId, r.EventSource, r.EventType, r.EventSubject, r.EventTime)
+	}
+	if webhook.EventTime.Enabled() {
+		row = append(row, r.ReceivedAt.UTC().Format(time.RFC3339))
+	}
+	if webhook.Flatten {
+		for _, column := range flattenColumns {
+			value := ""
+			if r.Flattened != nil {
+				value, _ = r.Flattened.GetOrNil(column).(string)
+			}
+			row = append(row, value)
+		}
+	}
+	return row
 }
 
 func (Row) TableName() string {
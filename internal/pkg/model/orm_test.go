@@ -0,0 +1,99 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDefaultMethods(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{}
+	assert.Equal(t, []string{"POST"}, webhook.MethodsSlice())
+	assert.True(t, webhook.AllowsMethod("POST"))
+	assert.False(t, webhook.AllowsMethod("GET"))
+}
+
+func TestWebhookSetMethods(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{}
+	assert.NoError(t, webhook.SetMethods([]string{"get", "POST", "GET"}))
+	assert.Equal(t, "GET,POST", webhook.Methods)
+	assert.True(t, webhook.AllowsMethod("GET"))
+	assert.False(t, webhook.AllowsMethod("PUT"))
+}
+
+func TestWebhookSetMethodsInvalid(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{}
+	err := webhook.SetMethods([]string{"DELETE"})
+	assert.Contains(t, err.Error(), `method "DELETE" is not supported`)
+	err = webhook.SetMethods([]string{})
+	assert.Contains(t, err.Error(), "at least one method must be allowed")
+}
+
+func TestWebhookSetResponse(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{}
+	assert.NoError(t, webhook.SetResponse(ResponsePixel))
+	assert.Equal(t, "pixel", webhook.Response)
+	assert.Contains(t, webhook.SetResponse("xml").Error(), `response "xml" is not supported`)
+}
+
+func TestWebhookSetBodyFormat(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{}
+	assert.NoError(t, webhook.SetBodyFormat(BodyFormatXml))
+	assert.Equal(t, "xml", webhook.BodyFormat)
+	assert.Contains(t, webhook.SetBodyFormat("yaml").Error(), `body format "yaml" is not supported`)
+}
+
+func TestWebhookCsv(t *testing.T) {
+	t.Parallel()
+	row := &Row{
+		Time:        time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC),
+		Headers:     `{}`,
+		Body:        `{"foo":"bar"}`,
+		EventId:     "123",
+		EventSource: "/orders",
+		EventType:   "order.created",
+	}
+
+	webhook := &Webhook{}
+	assert.Equal(t, []string{"timestamp", "headers", "body"}, webhook.CsvHeader(nil))
+	assert.Equal(t, []string{"2022-03-10T12:00:00Z", `{}`, `{"foo":"bar"}`}, row.CsvRow(webhook, nil))
+
+	webhook.CloudEvents = true
+	assert.Equal(t, []string{"timestamp", "headers", "body", "event_id", "event_source", "event_type", "event_subject", "event_time"}, webhook.CsvHeader(nil))
+	assert.Equal(t, []string{"2022-03-10T12:00:00Z", `{}`, `{"foo":"bar"}`, "123", "/orders", "order.created", "", ""}, row.CsvRow(webhook, nil))
+}
+
+func TestWebhookCsvEventTime(t *testing.T) {
+	t.Parallel()
+	row := &Row{
+		Time:       time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC),
+		ReceivedAt: time.Date(2022, 3, 10, 12, 5, 0, 0, time.UTC),
+		Headers:    `{}`,
+		Body:       `{"foo":"bar"}`,
+	}
+
+	webhook := &Webhook{EventTime: EventTime{Source: EventTimeSourceJsonPath, Key: "time", Format: EventTimeFormatRfc3339}}
+	assert.Equal(t, []string{"timestamp", "headers", "body", "received_at"}, webhook.CsvHeader(nil))
+	assert.Equal(t, []string{"2022-03-10T12:00:00Z", `{}`, `{"foo":"bar"}`, "2022-03-10T12:05:00Z"}, row.CsvRow(webhook, nil))
+}
+
+func TestWebhookCsvTimezone(t *testing.T) {
+	t.Parallel()
+	prague := time.FixedZone("CET", 3600)
+	row := &Row{
+		Time:       time.Date(2022, 3, 10, 13, 0, 0, 0, prague),
+		ReceivedAt: time.Date(2022, 3, 10, 13, 5, 0, 0, prague),
+		Headers:    `{}`,
+		Body:       `{"foo":"bar"}`,
+	}
+
+	// Times are written in UTC, so the column has one timezone
+	webhook := &Webhook{EventTime: EventTime{Source: EventTimeSourceJsonPath, Key: "time", Format: EventTimeFormatRfc3339}}
+	assert.Equal(t, []string{"2022-03-10T12:00:00Z", `{}`, `{"foo":"bar"}`, "2022-03-10T12:05:00Z"}, row.CsvRow(webhook, nil))
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	ReceiptStatusBuffered = "buffered"
+	ReceiptRetention      = 7 * 24 * time.Hour
+)
+
+// Receipt of an accepted delivery. It is used to report the delivery status
+// and to detect a repeated delivery, see Idempotency.
+type Receipt struct {
+	Id      string `gorm:"type:CHAR(21);primaryKey"`
+	Webhook uint32 `gorm:"not null;index:idx_receipt_key"`
+	// IdempotencyKey is a SHA-256 hash, with an index suffix for multiple events of one request, see Idempotency.KeyOf
+	IdempotencyKey string    `gorm:"type:VARCHAR(255);not null;index:idx_receipt_key"`
+	BatchId        string    `gorm:"type:CHAR(21);not null;default:'';index"`
+	CreatedAt      time.Time `gorm:"not null;index"`
+	// Duplicate is true if the receipt belongs to an already accepted delivery
+	Duplicate bool `gorm:"-"`
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/payload"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+)
+
+const (
+	RouteSourceHeader   = "header"
+	RouteSourceJsonPath = "jsonPath"
+)
+
+// Route sends the event to the TableId, if the header or the JSON path value is equal to the Value.
+type Route struct {
+	Source  string `json:"source"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	TableId string `json:"tableId"`
+}
+
+// Routes are evaluated in order, the first matching route wins.
+// Events that don't match any route are sent to the webhook table.
+// Routes are stored in the DB as a JSON array.
+type Routes []Route
+
+func NewRoute(source, key, value, tableId string) (Route, error) {
+	v := Route{Source: source, Key: key, Value: value, TableId: tableId}
+	if source != RouteSourceHeader && source != RouteSourceJsonPath {
+		return v, fmt.Errorf(`route source "%s" is not supported, allowed values: %s, %s`, source, RouteSourceHeader, RouteSourceJsonPath)
+	}
+	if key == "" {
+		return v, fmt.Errorf(`route key must be set`)
+	}
+	if err := ValidateTableId(tableId); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// Matches returns true if the route condition is met by the event.
+func (v Route) Matches(headers http.Header, body string) bool {
+	return matchesValue(v.Source, v.Key, v.Value, headers, body)
+}
+
+// TableIdOf returns the target table of the event, empty string if no route matches.
+func (v Routes) TableIdOf(headers http.Header, body string) string {
+	for _, route := range v {
+		if route.Matches(headers, body) {
+			return route.TableId
+		}
+	}
+	return ""
+}
+
+func (v Routes) Payload() []*webhooks.Route {
+	out := make([]*webhooks.Route, 0, len(v))
+	for _, route := range v {
+		out = append(out, &webhooks.Route{Source: route.Source, Key: route.Key, Value: route.Value, TableID: route.TableId})
+	}
+	return out
+}
+
+// Value implements driver.Valuer interface.
+func (v Routes) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return "", nil
+	}
+	return json.EncodeString(v, false)
+}
+
+// Scan implements sql.Scanner interface.
+func (v *Routes) Scan(value interface{}) error {
+	*v = nil
+	return scanJson(value, v)
+}
+
+// matchesValue returns true if the header or the JSON path value is equal to the expected value.
+func matchesValue(source, key, expected string, headers http.Header, body string) bool {
+	switch source {
+	case RouteSourceHeader:
+		return headers.Get(key) == expected
+	case RouteSourceJsonPath:
+		value, found, err := payload.JsonPathString(body, key)
+		return err == nil && found && value == expected
+	default:
+		return false
+	}
+}
+
+// BucketIdOf returns the bucket ID "stage.c-bucket" of the table ID.
+func BucketIdOf(tableId string) string {
+	if i := strings.LastIndex(tableId, "."); i >= 0 {
+		return tableId[:i]
+	}
+	return tableId
+}
+
+// ValidateTableId checks the table ID format "stage.c-bucket.table".
+func ValidateTableId(tableId string) error {
+	if len(strings.Split(tableId, ".")) != 3 {
+		return fmt.Errorf(`invalid table ID: %s`, tableId)
+	}
+	return nil
+}
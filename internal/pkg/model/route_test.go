@@ -0,0 +1,59 @@
+package model
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRouteInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := NewRoute("cookie", "foo", "bar", "in.c-bucket.table")
+	assert.Contains(t, err.Error(), `route source "cookie" is not supported`)
+
+	_, err = NewRoute("header", "", "push", "in.c-bucket.table")
+	assert.EqualError(t, err, `route key must be set`)
+
+	_, err = NewRoute("header", "X-GitHub-Event", "push", "table")
+	assert.EqualError(t, err, `invalid table ID: table`)
+}
+
+func TestWebhookTableIdOf(t *testing.T) {
+	t.Parallel()
+	webhook := &Webhook{
+		TableId: "in.c-github.other",
+		Routes: Routes{
+			{Source: "header", Key: "X-GitHub-Event", Value: "push", TableId: "in.c-github.push"},
+			{Source: "jsonPath", Key: "pull_request.state", Value: "open", TableId: "in.c-github.pull_request"},
+		},
+	}
+
+	headers := http.Header{}
+	headers.Set("X-GitHub-Event", "push")
+	assert.Equal(t, "in.c-github.push", webhook.TableIdOf(headers, `{}`))
+	assert.Equal(t, "in.c-github.pull_request", webhook.TableIdOf(http.Header{}, `{"pull_request": {"state": "open"}}`))
+	assert.Equal(t, "in.c-github.other", webhook.TableIdOf(http.Header{}, `{"issue": {}}`))
+	assert.Equal(t, "in.c-github.other", webhook.TableIdOf(http.Header{}, `not json`))
+}
+
+func TestRoutesValueScan(t *testing.T) {
+	t.Parallel()
+	routes := Routes{{Source: "header", Key: "X-GitHub-Event", Value: "push", TableId: "in.c-github.push"}}
+	value, err := routes.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"source":"header","key":"X-GitHub-Event","value":"push","tableId":"in.c-github.push"}]`, value)
+
+	var scanned Routes
+	assert.NoError(t, scanned.Scan([]byte(value.(string))))
+	assert.Equal(t, routes, scanned)
+
+	assert.NoError(t, scanned.Scan(nil))
+	assert.Empty(t, scanned)
+}
+
+func TestBucketIdOf(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "in.c-bucket", BucketIdOf("in.c-bucket.table"))
+	assert.Equal(t, "table", BucketIdOf("table"))
+}
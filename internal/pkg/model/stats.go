@@ -0,0 +1,11 @@
+package model
+
+// Stats of the events received by the webhook.
+type Stats struct {
+	// Received is the number of all received events, including dropped and duplicate events
+	Received uint64 `gorm:"not null;default:0"`
+	// Dropped is the number of events dropped by DropRules or by sampling
+	Dropped uint64 `gorm:"not null;default:0"`
+	// Duplicates is the number of events skipped as a repeated delivery, see Idempotency
+	Duplicates uint64 `gorm:"not null;default:0"`
+}
@@ -0,0 +1,37 @@
+package model
+
+// Table - Storage API table detail.
+type Table struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	PrimaryKey []string `json:"primaryKey"`
+}
+
+// TableDefinition of a new table with typed columns.
+// https://keboola.docs.apiary.io/#reference/tables/create-table-definition/create-new-table-definition
+type TableDefinition struct {
+	Name       string             `json:"name"`
+	PrimaryKey []string           `json:"primaryKeysNames"`
+	Columns    []ColumnDefinition `json:"columns"`
+}
+
+// ColumnDefinition defines a native column type, or a base type if Definition is nil.
+type ColumnDefinition struct {
+	Name       string            `json:"name"`
+	BaseType   string            `json:"basetype,omitempty"`
+	Definition *ColumnNativeType `json:"definition,omitempty"`
+}
+
+type ColumnNativeType struct {
+	Type     string `json:"type"`
+	Length   string `json:"length,omitempty"`
+	Nullable bool   `json:"nullable"`
+}
+
+// Metadata key-value pair.
+// https://keboola.docs.apiary.io/#reference/metadata
+type Metadata struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
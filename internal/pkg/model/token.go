@@ -2,10 +2,15 @@ package model
 
 // Token https://keboola.docs.apiary.io/#reference/tokens-and-permissions/token-verification/token-verification
 type Token struct {
-	Id       string     `json:"id"`
-	Token    string     `json:"token"`
-	IsMaster bool       `json:"isMasterToken"`
-	Owner    TokenOwner `json:"owner"`
+	Id          string     `json:"id"`
+	Token       string     `json:"token"`
+	Description string     `json:"description"`
+	IsMaster    bool       `json:"isMasterToken"`
+	Owner       TokenOwner `json:"owner"`
+	// CanManageBuckets allows the token to create buckets and to write to all buckets
+	CanManageBuckets bool `json:"canManageBuckets"`
+	// BucketPermissions maps bucket ID to "read", "write" or "manage"
+	BucketPermissions map[string]string `json:"bucketPermissions"`
 }
 
 func (t *Token) ProjectId() int {
@@ -16,6 +21,15 @@ func (t *Token) ProjectName() string {
 	return t.Owner.Name
 }
 
+// CanWriteBucket returns true if the token can import a table to the bucket.
+func (t *Token) CanWriteBucket(bucketId string) bool {
+	if t.IsMaster || t.CanManageBuckets {
+		return true
+	}
+	permission := t.BucketPermissions[bucketId]
+	return permission == "write" || permission == "manage"
+}
+
 type TokenOwner struct {
 	Id   int    `json:"id"`
 	Name string `json:"name"`
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCanWriteBucket(t *testing.T) {
+	t.Parallel()
+	assert.True(t, (&Token{IsMaster: true}).CanWriteBucket("in.c-bucket"))
+	assert.True(t, (&Token{CanManageBuckets: true}).CanWriteBucket("in.c-bucket"))
+
+	token := &Token{BucketPermissions: map[string]string{"in.c-write": "write", "in.c-manage": "manage", "in.c-read": "read"}}
+	assert.True(t, token.CanWriteBucket("in.c-write"))
+	assert.True(t, token.CanWriteBucket("in.c-manage"))
+	assert.False(t, token.CanWriteBucket("in.c-read"))
+	assert.False(t, token.CanWriteBucket("in.c-other"))
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+)
+
+const (
+	TriggerStatusTriggered = "triggered"
+	TriggerStatusSkipped   = "skipped"
+	TriggerStatusFailed    = "failed"
+)
+
+// Trigger defines a Queue job created after a successful import, for example a flow run.
+// Empty ComponentId means that no job is created.
+type Trigger struct {
+	ComponentId string        `gorm:"type:VARCHAR(255);not null;default:''"`
+	ConfigId    string        `gorm:"type:VARCHAR(255);not null;default:''"`
+	MinInterval time.Duration `gorm:"not null;default:0"`
+	// LastAt is time of the last created job, see MinInterval
+	LastAt *time.Time
+}
+
+func NewTrigger(componentId string, configId *string, minInterval *string) (Trigger, error) {
+	if componentId == "" {
+		return Trigger{}, nil
+	}
+
+	v := Trigger{ComponentId: componentId}
+	if configId == nil || *configId == "" {
+		return v, fmt.Errorf(`trigger config ID must be set`)
+	}
+	v.ConfigId = *configId
+
+	if minInterval != nil {
+		interval, err := time.ParseDuration(*minInterval)
+		if err != nil || interval < 0 {
+			return v, fmt.Errorf(`trigger min interval "%s" is not valid, use format Xs|m|h`, *minInterval)
+		}
+		v.MinInterval = interval
+	}
+	return v, nil
+}
+
+func (v Trigger) Enabled() bool {
+	return v.ComponentId != ""
+}
+
+// Due returns true if the MinInterval elapsed since the last job.
+func (v Trigger) Due(now time.Time) bool {
+	return v.LastAt == nil || now.Sub(*v.LastAt) >= v.MinInterval
+}
+
+func (v Trigger) Payload() *webhooks.Trigger {
+	if !v.Enabled() {
+		return nil
+	}
+	configId := v.ConfigId
+	minInterval := v.MinInterval.String()
+	return &webhooks.Trigger{ComponentID: v.ComponentId, ConfigID: &configId, MinInterval: &minInterval}
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTrigger(t *testing.T) {
+	t.Parallel()
+	configId := "123"
+	minInterval := "15m"
+	trigger, err := NewTrigger("keboola.orchestrator", &configId, &minInterval)
+	assert.NoError(t, err)
+	assert.Equal(t, Trigger{ComponentId: "keboola.orchestrator", ConfigId: "123", MinInterval: 15 * time.Minute}, trigger)
+	assert.True(t, trigger.Enabled())
+
+	trigger, err = NewTrigger("", nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, trigger.Enabled())
+	assert.Nil(t, trigger.Payload())
+
+	_, err = NewTrigger("keboola.orchestrator", nil, nil)
+	assert.EqualError(t, err, `trigger config ID must be set`)
+
+	invalid := "-5m"
+	_, err = NewTrigger("keboola.orchestrator", &configId, &invalid)
+	assert.EqualError(t, err, `trigger min interval "-5m" is not valid, use format Xs|m|h`)
+}
+
+func TestTriggerDue(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	trigger := Trigger{ComponentId: "keboola.orchestrator", ConfigId: "123", MinInterval: 15 * time.Minute}
+	assert.True(t, trigger.Due(now))
+
+	lastAt := now.Add(-10 * time.Minute)
+	trigger.LastAt = &lastAt
+	assert.False(t, trigger.Due(now))
+	assert.True(t, trigger.Due(now.Add(5*time.Minute)))
+}
@@ -0,0 +1,128 @@
+package payload
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+)
+
+const (
+	CloudEventsSpecVersion      = "1.0"
+	CloudEventsContentType      = "application/cloudevents+json"
+	CloudEventsBatchContentType = "application/cloudevents-batch+json"
+	cloudEventsHeaderPrefix     = "Ce-"
+)
+
+// CloudEvent contains attributes of a CloudEvent 1.0 stored as columns, and the event data.
+type CloudEvent struct {
+	SpecVersion string
+	Id          string
+	Source      string
+	Type        string
+	Subject     string
+	Time        string
+	Data        string
+}
+
+// structuredCloudEvent is a CloudEvent in the structured content mode.
+type structuredCloudEvent struct {
+	SpecVersion string          `json:"specversion"`
+	Id          string          `json:"id"`
+	Source      string          `json:"source"`
+	Type        string          `json:"type"`
+	Subject     string          `json:"subject"`
+	Time        string          `json:"time"`
+	Data        json.RawMessage `json:"data"`
+	DataBase64  string          `json:"data_base64"`
+}
+
+// IsBinaryCloudEvent returns true if the request headers contain a CloudEvent in the binary content mode.
+func IsBinaryCloudEvent(header http.Header) bool {
+	return header.Get(cloudEventsHeaderPrefix+"Specversion") != ""
+}
+
+// CloudEventFromBinary creates CloudEvent from the "ce-*" headers, the body is the event data.
+func CloudEventFromBinary(header http.Header, body string) (CloudEvent, error) {
+	event := CloudEvent{
+		SpecVersion: header.Get(cloudEventsHeaderPrefix + "Specversion"),
+		Id:          header.Get(cloudEventsHeaderPrefix + "Id"),
+		Source:      header.Get(cloudEventsHeaderPrefix + "Source"),
+		Type:        header.Get(cloudEventsHeaderPrefix + "Type"),
+		Subject:     header.Get(cloudEventsHeaderPrefix + "Subject"),
+		Time:        header.Get(cloudEventsHeaderPrefix + "Time"),
+		Data:        body,
+	}
+	return event, event.validate()
+}
+
+// CloudEventsFromStructured parses CloudEvents in the structured content mode.
+// If batch is true, the body is a JSON array of events.
+func CloudEventsFromStructured(body []byte, batch bool) ([]CloudEvent, error) {
+	var items []structuredCloudEvent
+	if batch {
+		if err := json.Decode(body, &items); err != nil {
+			return nil, fmt.Errorf("invalid CloudEvents batch: %w", err)
+		}
+	} else {
+		var item structuredCloudEvent
+		if err := json.Decode(body, &item); err != nil {
+			return nil, fmt.Errorf("invalid CloudEvent: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	out := make([]CloudEvent, 0, len(items))
+	for i, item := range items {
+		event := CloudEvent{
+			SpecVersion: item.SpecVersion,
+			Id:          item.Id,
+			Source:      item.Source,
+			Type:        item.Type,
+			Subject:     item.Subject,
+			Time:        item.Time,
+			Data:        structuredData(item),
+		}
+		if err := event.validate(); err != nil {
+			if batch {
+				return nil, fmt.Errorf("event %d: %w", i, err)
+			}
+			return nil, err
+		}
+		out = append(out, event)
+	}
+	return out, nil
+}
+
+// structuredData returns the JSON string value as it is, other JSON values are kept encoded.
+func structuredData(item structuredCloudEvent) string {
+	if item.DataBase64 != "" {
+		return item.DataBase64
+	}
+	var str string
+	if err := json.Decode(item.Data, &str); err == nil {
+		return str
+	}
+	return string(item.Data)
+}
+
+func (e CloudEvent) validate() error {
+	var missing []string
+	if e.Id == "" {
+		missing = append(missing, "id")
+	}
+	if e.Source == "" {
+		missing = append(missing, "source")
+	}
+	if e.Type == "" {
+		missing = append(missing, "type")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required CloudEvent attributes: %s", strings.Join(missing, ", "))
+	}
+	if e.SpecVersion != CloudEventsSpecVersion {
+		return fmt.Errorf(`unsupported CloudEvents spec version "%s", expected "%s"`, e.SpecVersion, CloudEventsSpecVersion)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package payload
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudEventFromBinary(t *testing.T) {
+	t.Parallel()
+	header := http.Header{}
+	header.Set("ce-specversion", "1.0")
+	header.Set("ce-id", "A234-1234-1234")
+	header.Set("ce-source", "/mycontext")
+	header.Set("ce-type", "com.example.someevent")
+	header.Set("ce-time", "2018-04-05T17:31:00Z")
+	assert.True(t, IsBinaryCloudEvent(header))
+
+	event, err := CloudEventFromBinary(header, `{"foo":"bar"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, CloudEvent{
+		SpecVersion: "1.0",
+		Id:          "A234-1234-1234",
+		Source:      "/mycontext",
+		Type:        "com.example.someevent",
+		Time:        "2018-04-05T17:31:00Z",
+		Data:        `{"foo":"bar"}`,
+	}, event)
+}
+
+func TestCloudEventFromBinaryMissingAttributes(t *testing.T) {
+	t.Parallel()
+	header := http.Header{}
+	header.Set("ce-specversion", "1.0")
+	header.Set("ce-id", "123")
+	_, err := CloudEventFromBinary(header, "")
+	assert.EqualError(t, err, "missing required CloudEvent attributes: source, type")
+	assert.False(t, IsBinaryCloudEvent(http.Header{}))
+}
+
+func TestCloudEventsFromStructured(t *testing.T) {
+	t.Parallel()
+	body := `{"specversion":"1.0","id":"1","source":"/orders","type":"order.created","subject":"order-1","data":{"total":10}}`
+	events, err := CloudEventsFromStructured([]byte(body), false)
+	assert.NoError(t, err)
+	assert.Equal(t, []CloudEvent{
+		{SpecVersion: "1.0", Id: "1", Source: "/orders", Type: "order.created", Subject: "order-1", Data: `{"total":10}`},
+	}, events)
+}
+
+func TestCloudEventsFromStructuredBatch(t *testing.T) {
+	t.Parallel()
+	body := `[
+  {"specversion":"1.0","id":"1","source":"/orders","type":"order.created","data":"text data"},
+  {"specversion":"1.0","id":"2","source":"/orders","type":"order.paid","data_base64":"Zm9v"}
+]`
+	events, err := CloudEventsFromStructured([]byte(body), true)
+	assert.NoError(t, err)
+	assert.Equal(t, []CloudEvent{
+		{SpecVersion: "1.0", Id: "1", Source: "/orders", Type: "order.created", Data: "text data"},
+		{SpecVersion: "1.0", Id: "2", Source: "/orders", Type: "order.paid", Data: "Zm9v"},
+	}, events)
+}
+
+func TestCloudEventsFromStructuredInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := CloudEventsFromStructured([]byte(`[{"specversion":"0.3","id":"1","source":"/s","type":"t"}]`), true)
+	assert.EqualError(t, err, `event 0: unsupported CloudEvents spec version "0.3", expected "1.0"`)
+
+	_, err = CloudEventsFromStructured([]byte(`{`), false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid CloudEvent")
+}
@@ -0,0 +1,67 @@
+package payload
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/orderedmap"
+)
+
+const FlattenSeparator = "__"
+
+var invalidColumnChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// Flatten converts a JSON object body to a flat object with string values, the key order is kept:
+//   - keys of nested objects are joined by "__", for example "customer__address__city",
+//   - characters not allowed in a column name are replaced by "_",
+//   - arrays are stored JSON encoded, null is stored as an empty string,
+//   - numbers are stored as they are sent, they are not rounded.
+//
+// An error is returned, if two keys are converted to the same column, for example "a-b" and "a_b".
+func Flatten(body string) (*orderedmap.OrderedMap, error) {
+	m, err := decodeObject(body)
+	if err != nil {
+		return nil, err
+	}
+
+	out := orderedmap.New()
+	if err := flattenTo(out, make(map[string]string), "", "", m); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ColumnName converts the key to a valid column name.
+func ColumnName(key string) string {
+	return invalidColumnChars.ReplaceAllString(key, "_")
+}
+
+// flattenTo writes values of the map to the out map, keys maps the columns to the original key paths.
+func flattenTo(out *orderedmap.OrderedMap, keys map[string]string, prefix, keyPrefix string, m *orderedmap.OrderedMap) error {
+	for _, key := range m.Keys() {
+		column, keyPath := ColumnName(key), key
+		if prefix != "" {
+			column = prefix + FlattenSeparator + column
+			keyPath = keyPrefix + "." + key
+		}
+
+		if value, ok := m.GetOrNil(key).(*orderedmap.OrderedMap); ok {
+			if err := flattenTo(out, keys, column, keyPath, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if other, found := keys[column]; found {
+			return fmt.Errorf(`keys "%s" and "%s" are both flattened to column "%s"`, other, keyPath, column)
+		}
+		keys[column] = keyPath
+
+		if value := m.GetOrNil(key); value == nil {
+			out.Set(column, "")
+		} else {
+			out.Set(column, ValueToString(value))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package payload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlatten(t *testing.T) {
+	t.Parallel()
+	body := `{"id": 123, "customer": {"name": "John", "address": {"city": "Prague", "zip": null}}, "tags": ["a", "b"], "paid": true, "first-name": "x"}`
+	out, err := Flatten(body)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "customer__name", "customer__address__city", "customer__address__zip", "tags", "paid", "first_name"}, out.Keys())
+	assert.Equal(t, map[string]interface{}{
+		"id":                      "123",
+		"customer__name":          "John",
+		"customer__address__city": "Prague",
+		"customer__address__zip":  "",
+		"tags":                    `["a","b"]`,
+		"paid":                    "true",
+		"first_name":              "x",
+	}, out.ToMap())
+}
+
+func TestFlattenInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := Flatten(`[1, 2]`)
+	assert.EqualError(t, err, "body is not a JSON object")
+}
+
+func TestFlattenNumbers(t *testing.T) {
+	t.Parallel()
+	out, err := Flatten(`{"id": 12345678901234567891, "big": 1e21, "price": 10.50, "items": [{"id": 9007199254740993}]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":    "12345678901234567891",
+		"big":   "1e21",
+		"price": "10.50",
+		"items": `[{"id":9007199254740993}]`,
+	}, out.ToMap())
+}
+
+func TestFlattenKeyCollision(t *testing.T) {
+	t.Parallel()
+	_, err := Flatten(`{"a-b": 1, "a_b": 2}`)
+	assert.EqualError(t, err, `keys "a-b" and "a_b" are both flattened to column "a_b"`)
+
+	_, err = Flatten(`{"a": {"b": 1}, "a__b": 2}`)
+	assert.EqualError(t, err, `keys "a.b" and "a__b" are both flattened to column "a__b"`)
+}
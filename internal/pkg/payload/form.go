@@ -0,0 +1,65 @@
+package payload
+
+import (
+	"fmt"
+	"mime/multipart"
+	"sort"
+)
+
+// FileConverter returns a value which is stored in the body instead of the file content, for example the ID of the uploaded file.
+type FileConverter func(file *multipart.FileHeader) (interface{}, error)
+
+// UploadError is returned by FromMultipart if the converter fails, the request body itself is valid.
+type UploadError struct {
+	FileName string
+	Err      error
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf(`cannot upload file "%s": %s`, e.FileName, e.Err)
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// FromMultipart converts multipart form to a JSON object, in the same way as FromValues.
+// The form is read at once by multipart.Reader.ReadForm, so a malformed body is rejected before any file is converted.
+// File values follow the text values of the same field.
+func FromMultipart(form *multipart.Form, converter FileConverter) (map[string]interface{}, error) {
+	fields := make(map[string][]interface{})
+	for name, values := range form.Value {
+		for _, value := range values {
+			fields[name] = append(fields[name], value)
+		}
+	}
+	for _, name := range sortedFileFields(form) {
+		for _, file := range form.File[name] {
+			value, err := converter(file)
+			if err != nil {
+				return nil, &UploadError{FileName: file.Filename, Err: err}
+			}
+			fields[name] = append(fields[name], value)
+		}
+	}
+
+	out := make(map[string]interface{}, len(fields))
+	for name, values := range fields {
+		if len(values) == 1 {
+			out[name] = values[0]
+		} else {
+			out[name] = values
+		}
+	}
+	return out, nil
+}
+
+// sortedFileFields returns names of the file fields, so files are converted in a stable order.
+func sortedFileFields(form *multipart.Form) []string {
+	names := make([]string, 0, len(form.File))
+	for name := range form.File {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,66 @@
+package payload
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"testing"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromMultipart(t *testing.T) {
+	t.Parallel()
+
+	// Create body
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	assert.NoError(t, writer.WriteField("from", "+420123456789"))
+	assert.NoError(t, writer.WriteField("tag", "a"))
+	assert.NoError(t, writer.WriteField("tag", "b"))
+	file, err := writer.CreateFormFile("attachment", "invoice.pdf")
+	assert.NoError(t, err)
+	_, err = file.Write([]byte("%PDF-1.4 content"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	// Parse
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1024)
+	assert.NoError(t, err)
+	defer func() { _ = form.RemoveAll() }()
+	converter := func(file *multipart.FileHeader) (interface{}, error) {
+		reader, err := file.Open()
+		assert.NoError(t, err)
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, "%PDF-1.4 content", string(data))
+		return map[string]interface{}{"fileId": 123, "name": file.Filename}, nil
+	}
+	fields, err := FromMultipart(form, converter)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"attachment":{"fileId":123,"name":"invoice.pdf"},"from":"+420123456789","tag":["a","b"]}`, json.MustEncodeString(fields, false))
+}
+
+func TestFromMultipartUploadError(t *testing.T) {
+	t.Parallel()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_, err := writer.CreateFormFile("attachment", "invoice.pdf")
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1024)
+	assert.NoError(t, err)
+	converter := func(file *multipart.FileHeader) (interface{}, error) {
+		return nil, errors.New("some error")
+	}
+	_, err = FromMultipart(form, converter)
+	assert.EqualError(t, err, `cannot upload file "invoice.pdf": some error`)
+	var uploadErr *UploadError
+	assert.True(t, errors.As(err, &uploadErr))
+	assert.Equal(t, "invoice.pdf", uploadErr.FileName)
+}
@@ -0,0 +1,54 @@
+package payload
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/orderedmap"
+)
+
+// JsonPathValue returns a value from the JSON object body, path is in format "data.items[0].id".
+// Found is false if the body is a JSON object, but the path doesn't exist.
+func JsonPathValue(body string, path string) (value interface{}, found bool, err error) {
+	m, err := decodeObject(body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, found, err = m.GetNested(path)
+	if !found {
+		return nil, false, nil
+	}
+	return value, found, err
+}
+
+// JsonPathString returns a value from the JSON object body converted to string.
+// String value is returned as it is, other values are JSON encoded.
+func JsonPathString(body string, path string) (value string, found bool, err error) {
+	raw, found, err := JsonPathValue(body, path)
+	if !found || err != nil {
+		return "", found, err
+	}
+	return ValueToString(raw), true, nil
+}
+
+// decodeObject decodes the JSON object body, numbers are decoded as json.Number, so they are stored as they are sent.
+func decodeObject(body string) (*orderedmap.OrderedMap, error) {
+	if !strings.HasPrefix(strings.TrimSpace(body), "{") {
+		return nil, fmt.Errorf("body is not a JSON object")
+	}
+	m := orderedmap.New()
+	if err := m.UnmarshalJSONUseNumber([]byte(body)); err != nil {
+		return nil, fmt.Errorf("body is not a JSON object: %w", err)
+	}
+	return m, nil
+}
+
+// ValueToString converts a JSON value to string, string value is returned as it is, other values are JSON encoded.
+func ValueToString(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	return json.MustEncodeString(value, false)
+}
@@ -0,0 +1,54 @@
+package payload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJsonPathString(t *testing.T) {
+	t.Parallel()
+	body := `{"id": "evt_1", "data": {"items": [{"sku": 123}, {"sku": "B2"}], "meta": {"a": true}}}`
+
+	value, found, err := JsonPathString(body, "id")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "evt_1", value)
+
+	value, found, err = JsonPathString(body, "data.items[0].sku")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "123", value)
+
+	value, found, err = JsonPathString(body, "data.meta")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, `{"a":true}`, value)
+
+	value, found, err = JsonPathString(body, "data.items[2].sku")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, "", value)
+}
+
+func TestJsonPathStringInvalidBody(t *testing.T) {
+	t.Parallel()
+	_, found, err := JsonPathString(`[1, 2]`, "id")
+	assert.False(t, found)
+	assert.EqualError(t, err, "body is not a JSON object")
+
+	_, found, err = JsonPathString(`{"id": `, "id")
+	assert.False(t, found)
+	assert.Error(t, err)
+}
+
+func TestJsonPathStringLargeNumber(t *testing.T) {
+	t.Parallel()
+	value, found, err := JsonPathString(`{"id": 12345678901234567891}`, "id")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "12345678901234567891", value)
+
+	_, _, err = JsonPathString(`{"id": 1} {}`, "id")
+	assert.Error(t, err)
+}
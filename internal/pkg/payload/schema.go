@@ -0,0 +1,70 @@
+package payload
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const schemaUrl = "webhook.schema.json"
+
+// Schema validates the body against a JSON Schema.
+type Schema struct {
+	schema *jsonschema.Schema
+}
+
+func CompileSchema(schemaJson string) (*Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	// External references are not allowed, the schema is provided by the user
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf(`external reference "%s" is not allowed`, url)
+	}
+	if err := compiler.AddResource(schemaUrl, strings.NewReader(schemaJson)); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	schema, err := compiler.Compile(schemaUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return &Schema{schema: schema}, nil
+}
+
+// Validate returns validation errors, or nil if the body is valid.
+func (s *Schema) Validate(body string) []string {
+	var value interface{}
+	if err := json.DecodeUseNumber([]byte(body), &value); err != nil {
+		return []string{fmt.Sprintf("body is not valid JSON: %s", err)}
+	}
+
+	err := s.schema.Validate(value)
+	if err == nil {
+		return nil
+	}
+
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []string{err.Error()}
+	}
+
+	var out []string
+	var visit func(e *jsonschema.ValidationError)
+	visit = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			location := e.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			out = append(out, fmt.Sprintf("%s: %s", location, e.Message))
+		}
+		for _, cause := range e.Causes {
+			visit(cause)
+		}
+	}
+	visit(validationErr)
+	sort.Strings(out)
+	return out
+}
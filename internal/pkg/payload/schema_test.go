@@ -0,0 +1,60 @@
+package payload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const orderSchema = `{
+  "type": "object",
+  "properties": {
+    "id": {"type": "integer"},
+    "email": {"type": "string"}
+  },
+  "required": ["id", "email"]
+}`
+
+func TestSchemaValid(t *testing.T) {
+	t.Parallel()
+	schema, err := CompileSchema(orderSchema)
+	assert.NoError(t, err)
+	assert.Nil(t, schema.Validate(`{"id": 123, "email": "john@example.com"}`))
+}
+
+func TestSchemaInvalid(t *testing.T) {
+	t.Parallel()
+	schema, err := CompileSchema(orderSchema)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/: missing properties: 'email'",
+		"/id: expected integer, but got string",
+	}, schema.Validate(`{"id": "abc"}`))
+	assert.Equal(t, []string{
+		"body is not valid JSON: invalid character 'o' in literal null (expecting 'u'), offset: 2",
+	}, schema.Validate(`not json`))
+}
+
+func TestSchemaTrailingData(t *testing.T) {
+	t.Parallel()
+	schema, err := CompileSchema(orderSchema)
+	assert.NoError(t, err)
+	assert.Nil(t, schema.Validate("{\"id\": 123, \"email\": \"john@example.com\"}\n"))
+	assert.Equal(t, []string{
+		"body is not valid JSON: invalid data after top-level value, offset: 40",
+	}, schema.Validate(`{"id": 123, "email": "john@example.com"} garbage`))
+	assert.Equal(t, []string{
+		"body is not valid JSON: invalid data after top-level value, offset: 40",
+	}, schema.Validate(`{"id": 123, "email": "john@example.com"}{"id": 456}`))
+}
+
+func TestSchemaCompileError(t *testing.T) {
+	t.Parallel()
+	_, err := CompileSchema(`{"type": 123}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid JSON schema")
+
+	_, err = CompileSchema(`{"$ref": "file:///etc/passwd"}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `external reference "file:///etc/passwd" is not allowed`)
+}
@@ -0,0 +1,19 @@
+package payload
+
+import (
+	"net/url"
+)
+
+// FromValues converts query or form values to a JSON object.
+// A key with a single value is converted to a string, a key with multiple values to an array.
+func FromValues(values url.Values) map[string]interface{} {
+	out := make(map[string]interface{}, len(values))
+	for key, items := range values {
+		if len(items) == 1 {
+			out[key] = items[0]
+		} else {
+			out[key] = items
+		}
+	}
+	return out
+}
@@ -0,0 +1,16 @@
+package payload
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromValues(t *testing.T) {
+	t.Parallel()
+	values, err := url.ParseQuery("utm_source=mail&id=123&tag=a&tag=b")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"123","tag":["a","b"],"utm_source":"mail"}`, json.MustEncodeString(FromValues(values), false))
+}
@@ -0,0 +1,101 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/orderedmap"
+)
+
+const (
+	XmlAttributePrefix = "@"
+	XmlTextKey         = "#text"
+)
+
+type xmlElement struct {
+	name     string
+	attrs    []xml.Attr
+	children *orderedmap.OrderedMap
+	text     strings.Builder
+}
+
+// XmlToJson converts an XML document to a JSON object, the document order is kept:
+//   - an element is converted to a key with the element local name,
+//   - attributes are stored under keys with the "@" prefix, namespace declarations are skipped,
+//   - an element without attributes and children is converted to its text,
+//   - text of an element with attributes or children is stored under the "#text" key,
+//   - repeated elements are converted to an array.
+func XmlToJson(data []byte) (*orderedmap.OrderedMap, error) {
+	root := &xmlElement{children: orderedmap.New()}
+	stack := []*xmlElement{root}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+
+		current := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, &xmlElement{name: t.Name.Local, attrs: t.Attr, children: orderedmap.New()})
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			addXmlChild(stack[len(stack)-1].children, current.name, current.value())
+		case xml.CharData:
+			current.text.Write(t)
+		}
+	}
+
+	if root.children.Len() == 0 {
+		return nil, fmt.Errorf("invalid XML: no root element")
+	}
+	return root.children, nil
+}
+
+func (e *xmlElement) value() interface{} {
+	text := strings.TrimSpace(e.text.String())
+
+	out := orderedmap.New()
+	for _, attr := range e.attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		out.Set(XmlAttributePrefix+attr.Name.Local, attr.Value)
+	}
+	for _, key := range e.children.Keys() {
+		out.Set(key, e.children.GetOrNil(key))
+	}
+
+	// Simple element
+	if out.Len() == 0 {
+		return text
+	}
+
+	if text != "" {
+		out.Set(XmlTextKey, text)
+	}
+	return out
+}
+
+func addXmlChild(children *orderedmap.OrderedMap, name string, value interface{}) {
+	existing, found := children.Get(name)
+	if !found {
+		children.Set(name, value)
+		return
+	}
+
+	// Repeated element
+	if items, ok := existing.([]interface{}); ok {
+		children.Set(name, append(items, value))
+	} else {
+		children.Set(name, []interface{}{existing, value})
+	}
+}
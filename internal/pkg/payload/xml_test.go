@@ -0,0 +1,68 @@
+package payload
+
+import (
+	"testing"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXmlToJson(t *testing.T) {
+	t.Parallel()
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <order id="123" status="paid">
+      <customer>John</customer>
+      <item sku="A1">Apple</item>
+      <item sku="B2">Banana</item>
+      <note/>
+    </order>
+  </soap:Body>
+</soap:Envelope>
+`
+	expected := `
+{
+  "Envelope": {
+    "Body": {
+      "order": {
+        "@id": "123",
+        "@status": "paid",
+        "customer": "John",
+        "item": [
+          {
+            "@sku": "A1",
+            "#text": "Apple"
+          },
+          {
+            "@sku": "B2",
+            "#text": "Banana"
+          }
+        ],
+        "note": ""
+      }
+    }
+  }
+}
+`
+	out, err := XmlToJson([]byte(input))
+	assert.NoError(t, err)
+	assert.Equal(t, expected[1:], json.MustEncodeString(out, true))
+}
+
+func TestXmlToJsonRepeatedSimpleElements(t *testing.T) {
+	t.Parallel()
+	out, err := XmlToJson([]byte(`<ids><id>1</id><id>2</id><id>3</id></ids>`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"ids":{"id":["1","2","3"]}}`, json.MustEncodeString(out, false))
+}
+
+func TestXmlToJsonInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := XmlToJson([]byte(`<order><id>1</order>`))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid XML")
+
+	_, err = XmlToJson([]byte(`just text`))
+	assert.EqualError(t, err, "invalid XML: no root element")
+}
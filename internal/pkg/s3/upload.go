@@ -2,49 +2,45 @@ package s3
 
 import (
 	"context"
-	"os"
-	"time"
+	"io"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
 )
 
-func UploadFileToS3(filePath string, resource model.FileResource) (err error) {
-	dat, errFile := os.Open(filePath)
-	if errFile != nil {
-		return errFile
-	}
+const (
+	// PartSize of the multipart upload, each part is uploaded and retried separately.
+	PartSize = 5 * 1024 * 1024
+	// PartRetries is the maximum number of retries of one part.
+	PartRetries = 3
+)
 
-	sess, errSession := session.NewSession(&aws.Config{
+// UploadToS3 uploads content of the reader to the prepared file resource.
+// Reader is consumed in parts, so the content size doesn't have to be known.
+// The upload is aborted when the context is done.
+func UploadToS3(ctx context.Context, reader io.Reader, resource model.FileResource) error {
+	sess, err := session.NewSession(&aws.Config{
 		Region: aws.String(resource.Region),
 		Credentials: credentials.NewStaticCredentials(
 			resource.UploadParams.Credentials.AccessKeyId,
 			resource.UploadParams.Credentials.SecretAccessKey,
 			resource.UploadParams.Credentials.SessionToken),
-	},
-	)
-	if errSession != nil {
-		return errSession
-	}
-
-	// set the fixed timeout
-	ctx := context.Background()
-	var cancelFn func()
-	ctx, cancelFn = context.WithTimeout(ctx, time.Millisecond*1000*30)
-	if cancelFn != nil {
-		defer cancelFn()
+		MaxRetries: aws.Int(PartRetries),
+	})
+	if err != nil {
+		return err
 	}
 
-	svc := s3.New(sess)
-
-	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+	uploader := s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
+		u.PartSize = PartSize
+	})
+	_, err = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: aws.String(resource.UploadParams.Bucket),
 		Key:    aws.String(resource.UploadParams.Key),
-		Body:   dat,
+		Body:   reader,
 	})
-
 	return err
 }
@@ -1,7 +1,8 @@
 package s3
 
 import (
-	"os"
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/keboola/temp-webhooks-api/internal/pkg/env"
@@ -16,10 +17,7 @@ func TestUpload(t *testing.T) {
 	response, err := api.CreateFileResource("tmpfile")
 	assert.NoError(t, err)
 
-	err = os.WriteFile("/tmp/dat1", []byte("hello\ngo\n"), 0o666)
-	assert.NoError(t, err)
-
-	err = UploadFileToS3("/tmp/dat1", response)
+	err = UploadToS3(context.Background(), strings.NewReader("hello\ngo\n"), response)
 
 	assert.NoError(t, err)
 }
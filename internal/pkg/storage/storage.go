@@ -1,29 +1,34 @@
 package storage
 
 import (
-	"encoding/csv"
 	"errors"
 	"fmt"
-	"io"
+	"sort"
 	"time"
 
 	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/orderedmap"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
 	gonanoid "github.com/matoous/go-nanoid/v2"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+// ReadChunkSize is the number of rows read at once by WriteBatch.
+const ReadChunkSize = 1000
+
 type Storage struct {
-	db     *gorm.DB
-	logger log.Logger
+	db            *gorm.DB
+	logger        log.Logger
+	readChunkSize int
 }
 
 func New(db *gorm.DB, logger log.Logger) *Storage {
 	return &Storage{
-		db:     db,
-		logger: logger,
+		db:            db,
+		logger:        logger,
+		readChunkSize: ReadChunkSize,
 	}
 }
 
@@ -39,21 +44,15 @@ func (s *Storage) CountRows(webhookId uint32) (uint, error) {
 	return countRows(webhookId, s.db)
 }
 
-func (s *Storage) RegisterWebhook(token model.Token, tableId string, conditions model.Conditions) (*model.Webhook, error) {
-	hash := model.WebhookHash(gonanoid.Must())
-	webhook := &model.Webhook{
-		Hash:       hash,
-		ProjectId:  uint32(token.ProjectId()),
-		Token:      token.Token,
-		TableId:    tableId,
-		ImportedAt: time.Now(),
-		Size:       0,
-		Conditions: conditions,
-	}
-	return webhook, s.db.Create(webhook).Error
+func (s *Storage) RegisterWebhook(webhook *model.Webhook) error {
+	webhook.Hash = model.WebhookHash(gonanoid.Must())
+	webhook.ImportedAt = time.Now()
+	webhook.Size = 0
+	return s.db.Create(webhook).Error
 }
 
-func (s *Storage) UpdateWebhook(webhookHash string, conditions model.Conditions) (webhook *model.Webhook, err error) {
+// UpdateWebhook loads the webhook for update, modifies it by the callback and saves it.
+func (s *Storage) UpdateWebhook(webhookHash string, update func(webhook *model.Webhook) error) (webhook *model.Webhook, err error) {
 	err = s.db.Transaction(func(tx *gorm.DB) error {
 		// Get webhook, select for update
 		webhook, err = getWebhook(webhookHash, tx.Clauses(clause.Locking{Strength: "UPDATE"}))
@@ -62,13 +61,10 @@ func (s *Storage) UpdateWebhook(webhookHash string, conditions model.Conditions)
 		}
 
 		// Update
-		if err := tx.Model(&model.Webhook{}).Where("id = ?", webhook.Id).Updates(&model.Webhook{Conditions: conditions}).Error; err != nil {
+		if err := update(webhook); err != nil {
 			return err
 		}
-
-		// Load new values
-		webhook, err = getWebhook(webhookHash, tx.Clauses(clause.Locking{Strength: "UPDATE"}))
-		return err
+		return tx.Save(webhook).Error
 	})
 	return webhook, err
 }
@@ -85,8 +81,10 @@ func (s *Storage) FlushData(webhookHash string) (result string, err error) {
 	return "ok", err
 }
 
-func (s *Storage) WriteRow(webhookHash string, headers, body string) (webhook *model.Webhook, count uint, err error) {
-	var countInt int64
+// WriteRow writes one or more rows to the webhook buffer, in one transaction.
+// Each row gets a receipt. A repeated delivery, see model.Idempotency,
+// is not written, the receipt of the original delivery is returned instead.
+func (s *Storage) WriteRow(webhookHash string, rows ...*model.Row) (webhook *model.Webhook, receipts []*model.Receipt, count uint, err error) {
 	err = s.db.Transaction(func(tx *gorm.DB) error {
 		// Get webhook, select for update
 		webhook, err = getWebhook(webhookHash, tx.Clauses(clause.Locking{Strength: "UPDATE"}))
@@ -94,45 +92,263 @@ func (s *Storage) WriteRow(webhookHash string, headers, body string) (webhook *m
 			return err
 		}
 
-		// Create row
-		row := &model.Row{
-			Webhook: webhook.Id,
-			Time:    time.Now(),
-			Headers: headers,
-			Body:    body,
-		}
+		// Insert rows
+		receipts = make([]*model.Receipt, len(rows))
+		size := webhook.Size
+		duplicates := 0
+		for i, row := range rows {
+			// Skip repeated delivery
+			if row.IdempotencyKey != "" {
+				receipt, err := findReceipt(webhook.Id, row.IdempotencyKey, time.Now().Add(-webhook.Idempotency.Window), tx)
+				if err != nil {
+					return err
+				}
+				if receipt != nil {
+					receipt.Duplicate = true
+					receipts[i] = receipt
+					duplicates++
+					continue
+				}
+			}
 
-		// Insert row
-		if err := tx.Create(row).Error; err != nil {
-			return fmt.Errorf("cannot write data to db: %w", err)
+			// Create receipt
+			receipt := &model.Receipt{
+				Id:             gonanoid.Must(),
+				Webhook:        webhook.Id,
+				IdempotencyKey: row.IdempotencyKey,
+				CreatedAt:      time.Now(),
+			}
+			if err := tx.Create(receipt).Error; err != nil {
+				return fmt.Errorf("cannot write receipt to db: %w", err)
+			}
+			receipts[i] = receipt
+
+			row.Webhook = webhook.Id
+			row.ReceiptId = receipt.Id
+			if row.ReceivedAt.IsZero() {
+				row.ReceivedAt = time.Now()
+			}
+			if row.Time.IsZero() {
+				row.Time = row.ReceivedAt
+			}
+			if err := tx.Create(row).Error; err != nil {
+				return fmt.Errorf("cannot write data to db: %w", err)
+			}
+			size += uint64(len(row.Headers) + len(row.Body))
 		}
 
-		// Update size
-		size := uint64(len(headers) + len(body))
-		if err := tx.Model(&model.Webhook{}).Where("id = ?", webhook.Id).Update("size", webhook.Size+size).Error; err != nil {
+		// Update size and stats
+		err := tx.Model(&model.Webhook{}).Where("id = ?", webhook.Id).Updates(map[string]interface{}{
+			"size":             size,
+			"stats_received":   gorm.Expr("stats_received + ?", len(rows)),
+			"stats_duplicates": gorm.Expr("stats_duplicates + ?", duplicates),
+		}).Error
+		if err != nil {
 			return err
 		}
 
 		// Get current batch size
 		count, err = countRows(webhook.Id, tx)
-		if err := tx.Model(&model.Row{}).Where("webhook = ?", webhook.Id).Count(&countInt).Error; err != nil {
-			return fmt.Errorf("cannot count rows: %w", err)
+		return err
+	})
+	return webhook, receipts, count, err
+}
+
+// IsRepeated checks if an event with the idempotency key has already been delivered, see model.Idempotency.
+// WriteRow checks it again when the row is written, it is used to skip work for a repeated delivery.
+func (s *Storage) IsRepeated(webhook *model.Webhook, idempotencyKey string) (bool, error) {
+	receipt, err := findReceipt(webhook.Id, idempotencyKey, time.Now().Add(-webhook.Idempotency.Window), s.db)
+	if err != nil {
+		return false, err
+	}
+	return receipt != nil, nil
+}
+
+// WriteDropped counts events dropped by drop rules or by sampling, see model.Stats.
+func (s *Storage) WriteDropped(webhook *model.Webhook, count uint) error {
+	return s.db.Model(&model.Webhook{}).Where("id = ?", webhook.Id).Updates(map[string]interface{}{
+		"stats_received": gorm.Expr("stats_received + ?", count),
+		"stats_dropped":  gorm.Expr("stats_dropped + ?", count),
+	}).Error
+}
+
+// DeleteExpiredReceipts deletes receipts, finished batches and rows of failed batches older than model.ReceiptRetention.
+func (s *Storage) DeleteExpiredReceipts() (int64, error) {
+	before := time.Now().Add(-model.ReceiptRetention)
+	result := s.db.Where("created_at < ?", before).Delete(&model.Receipt{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	// Delete rows which failed too many times, see FinishBatch
+	expiredBatches := s.db.Model(&model.Batch{}).Select("id").Where("created_at < ? AND status = ?", before, model.BatchStatusFailed)
+	if err := s.db.Table("data").Where("batch_id IN (?)", expiredBatches).Delete(&model.Row{}).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.Where("created_at < ? AND status != ?", before, model.BatchStatusImporting).Delete(&model.Batch{}).Error; err != nil {
+		return 0, err
+	}
+	return result.RowsAffected, nil
+}
+
+// GetReceipt returns the receipt and its batch, the batch is nil if the receipt is still buffered.
+func (s *Storage) GetReceipt(webhookHash string, receiptId string) (receipt *model.Receipt, batch *model.Batch, err error) {
+	webhook, err := getWebhook(webhookHash, s.db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	receipt = &model.Receipt{}
+	err = s.db.First(receipt, "id = ? AND webhook = ?", receiptId, webhook.Id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, &webhooks.ReceiptNotFoundError{Message: fmt.Sprintf(`Receipt "%s" not found.`, receiptId)}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if receipt.BatchId == "" {
+		return receipt, nil, nil
+	}
+	batch = &model.Batch{}
+	if err := s.db.First(batch, "id = ?", receipt.BatchId).Error; err != nil {
+		return nil, nil, fmt.Errorf(`cannot load batch "%s": %w`, receipt.BatchId, err)
+	}
+	return receipt, batch, nil
+}
+
+// StartJob stores the Storage job importing the batch, so the job can be tracked after a restart, see TrackedBatches.
+func (s *Storage) StartJob(batch *model.Batch, jobId int) error {
+	batch.JobId = jobId
+	return s.db.Model(batch).Select("job_id", "merged_to").Updates(batch).Error
+}
+
+// TrackedBatches returns webhooks with the batches, which are waiting for the Storage job.
+func (s *Storage) TrackedBatches() (webhooks []*model.Webhook, err error) {
+	tracked := s.db.Model(&model.Batch{}).Where("status = ? AND job_id > 0", model.BatchStatusImporting)
+	err = s.db.
+		Preload("Batches", func(db *gorm.DB) *gorm.DB {
+			return db.Where("status = ? AND job_id > 0", model.BatchStatusImporting).Order("created_at")
+		}).
+		Where("id IN (?)", tracked.Select("webhook")).
+		Find(&webhooks).
+		Error
+	return webhooks, err
+}
+
+// StaleBatches returns webhooks with the batches, which have been fetched, but their Storage job has not been created.
+// It happens if the replica is killed during the import. A batch is stale if it has been created before the time
+// and the import lease of its webhook is not held, see model.ImportLease. Stale batches are finished by FinishBatch.
+func (s *Storage) StaleBatches(createdBefore time.Time) (webhooks []*model.Webhook, err error) {
+	stale := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? AND job_id = 0 AND created_at < ?", model.BatchStatusImporting, createdBefore)
+	}
+	err = s.db.
+		Preload("Batches", func(db *gorm.DB) *gorm.DB {
+			return stale(db).Order("created_at")
+		}).
+		Where("id IN (?)", stale(s.db.Model(&model.Batch{})).Select("webhook")).
+		Where("NOT EXISTS (SELECT 1 FROM leases WHERE leases.name = CONCAT(?, webhooks.hash) AND leases.expires_at >= NOW(3))", model.ImportLeasePrefix).
+		Find(&webhooks).
+		Error
+	return webhooks, err
+}
+
+// FinishBatch marks the batch as imported by the job, or as failed if the error is set.
+// Rows of an imported batch are deleted.
+// Rows of a failed batch are returned to the buffer, so they are not lost, and the next import of the webhook is delayed, see model.RetryDelay.
+// Rows which failed model.MaxImportAttempts times stay in the failed batch, their receipts report the error.
+func (s *Storage) FinishBatch(batch *model.Batch, jobId int, importErr error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		batch.JobId = jobId
+		batch.FinishedAt = &now
+		if importErr == nil {
+			batch.Status = model.BatchStatusImported
+		} else {
+			batch.Status = model.BatchStatusFailed
+			batch.Error = importErr.Error()
+		}
+		if err := tx.Save(batch).Error; err != nil {
+			return err
 		}
 
-		return nil
+		// Delete imported rows
+		if importErr == nil {
+			return tx.Table("data").Where("batch_id = ?", batch.Id).Delete(&model.Row{}).Error
+		}
+
+		// Count the failed attempt
+		if err := tx.Table("data").Where("batch_id = ?", batch.Id).Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+			return err
+		}
+		var attempts uint
+		returned := tx.Table("data").Where("batch_id = ? AND attempts < ?", batch.Id, model.MaxImportAttempts)
+		if err := returned.Session(&gorm.Session{}).Select("COALESCE(MAX(attempts), 0)").Scan(&attempts).Error; err != nil {
+			return err
+		}
+		return returnRows(tx, batch, returned, now.Add(model.RetryDelay(attempts)))
 	})
-	return webhook, uint(countInt), err
 }
 
-func (s *Storage) Fetch(webhookHash string, target io.Writer) (webhook *model.Webhook, err error) {
-	csvWriter := csv.NewWriter(target)
-	defer csvWriter.Flush()
+// ReturnBatch marks the batch as failed and returns all its rows to the buffer, for example on shutdown.
+// The failed attempt is not counted and the next import of the webhook is not delayed, see FinishBatch.
+func (s *Storage) ReturnBatch(batch *model.Batch, reason error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		batch.Status = model.BatchStatusFailed
+		batch.Error = reason.Error()
+		batch.FinishedAt = &now
+		if err := tx.Save(batch).Error; err != nil {
+			return err
+		}
+		return returnRows(tx, batch, tx.Table("data").Where("batch_id = ?", batch.Id), now)
+	})
+}
 
-	// Write header
-	if err := csvWriter.Write([]string{"timestamp", "headers", "body"}); err != nil {
-		return nil, err
+// returnRows returns the rows of the batch to the buffer, the receipts are buffered again.
+// The next import of the webhook is delayed to the retryAt time, if it is later than the current value.
+func returnRows(tx *gorm.DB, batch *model.Batch, rows *gorm.DB, retryAt time.Time) error {
+	receiptIds := rows.Session(&gorm.Session{}).Select("receipt_id")
+	if err := tx.Model(&model.Receipt{}).Where("id IN (?)", receiptIds).Update("batch_id", "").Error; err != nil {
+		return err
 	}
+	if err := rows.Session(&gorm.Session{}).Update("batch_id", "").Error; err != nil {
+		return err
+	}
+
+	// Update size of the buffer and the retry time
+	size := tx.Table("data").Select("COALESCE(SUM(LENGTH(headers) + LENGTH(body)), 0)").Where("webhook = ? AND batch_id = ''", batch.Webhook)
+	return tx.Model(&model.Webhook{}).Where("id = ?", batch.Webhook).Updates(map[string]interface{}{
+		"size":     size,
+		"retry_at": gorm.Expr("GREATEST(COALESCE(retry_at, ?), ?)", retryAt, retryAt),
+	}).Error
+}
+
+// FetchBatches returns the batches created by one fetch, see model.Batch.FetchId.
+func (s *Storage) FetchBatches(fetchId string) (batches []*model.Batch, err error) {
+	return batches, s.db.Where("fetch_id = ?", fetchId).Order("id").Find(&batches).Error
+}
+
+// FinishTrigger stores result of the job created after the import to the batches, see model.Trigger.
+func (s *Storage) FinishTrigger(webhook *model.Webhook, batches []*model.Batch) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, batch := range batches {
+			if err := tx.Model(batch).Select("trigger_status", "trigger_job_id", "trigger_error").Updates(batch).Error; err != nil {
+				return err
+			}
+		}
+		if webhook.Trigger.LastAt == nil {
+			return nil
+		}
+		// The time of the last job only moves forward
+		lastAt := *webhook.Trigger.LastAt
+		return tx.Model(&model.Webhook{}).Where("id = ?", webhook.Id).Update("trigger_last_at", gorm.Expr("GREATEST(COALESCE(trigger_last_at, ?), ?)", lastAt, lastAt)).Error
+	})
+}
 
+// Fetch moves the buffered rows to batches, one batch per target table, see model.Routes.
+// A batch is created only for a table with rows, so no batch is created if the buffer is empty.
+// Rows of each batch must be written by WriteBatch and each batch must be finished by FinishBatch.
+func (s *Storage) Fetch(webhookHash string) (webhook *model.Webhook, batches []*model.Batch, err error) {
 	err = s.db.Transaction(func(tx *gorm.DB) error {
 		// Get webhook, select for update
 		webhook, err = getWebhook(webhookHash, tx.Clauses(clause.Locking{Strength: "UPDATE"}))
@@ -140,43 +356,258 @@ func (s *Storage) Fetch(webhookHash string, target io.Writer) (webhook *model.We
 			return err
 		}
 
-		// Select rows
-		rows, err := tx.Table("data").Where("webhook = ?", webhook.Id).Order("time").Rows()
+		// Get size of rows grouped by the target table
+		sizePerTable, err := tableSizes(webhook, tx)
 		if err != nil {
 			return err
 		}
-		defer rows.Close()
+		tableIds := batchTables(webhook, sizePerTable)
 
-		// Load rows
-		for rows.Next() {
-			row := &model.Row{}
-			if err := tx.ScanRows(rows, row); err != nil {
+		// Add new flattened columns, the order of columns is stable
+		if webhook.FlattenColumns == nil {
+			webhook.FlattenColumns = make(model.FlattenColumns)
+		}
+		if webhook.Flatten {
+			if err := s.addFlattenColumns(webhook, tx); err != nil {
+				return err
+			}
+		}
+
+		// Create batches
+		batches = nil
+		fetchId := gonanoid.Must()
+		for _, tableId := range tableIds {
+			batch := &model.Batch{
+				Id:        gonanoid.Must(),
+				FetchId:   fetchId,
+				Webhook:   webhook.Id,
+				TableId:   tableId,
+				Status:    model.BatchStatusImporting,
+				Size:      sizePerTable[tableId],
+				CreatedAt: time.Now(),
+			}
+			if err := tx.Create(batch).Error; err != nil {
+				return fmt.Errorf("cannot create batch: %w", err)
+			}
+			batch.Columns = webhook.CsvHeader(webhook.FlattenColumnsOf(tableId))
+			batches = append(batches, batch)
+
+			// Move rows to the batch, they are deleted when the batch is imported, see FinishBatch
+			rowsQuery := tx.Table("data").Where("webhook = ? AND batch_id = ''", webhook.Id)
+			if tableId == webhook.TableId {
+				rowsQuery = rowsQuery.Where("table_id IN (?, '')", tableId)
+			} else {
+				rowsQuery = rowsQuery.Where("table_id = ?", tableId)
+			}
+			if err := rowsQuery.Update("batch_id", batch.Id).Error; err != nil {
 				return err
 			}
 
-			csvRow := []string{row.Time.Format(time.RFC3339), row.Headers, row.Body}
-			if err := csvWriter.Write(csvRow); err != nil {
+			// Move receipts to the batch
+			receiptIds := tx.Table("data").Select("receipt_id").Where("batch_id = ?", batch.Id)
+			if err := tx.Model(&model.Receipt{}).Where("id IN (?)", receiptIds).Update("batch_id", batch.Id).Error; err != nil {
 				return err
 			}
 		}
 
-		if err := rows.Err(); err != nil {
+		// Update size, importedAt and flattened columns
+		err = tx.Model(&model.Webhook{}).Where("id = ?", webhook.Id).Updates(map[string]interface{}{
+			"size":            0,
+			"imported_at":     time.Now(),
+			"flatten_columns": webhook.FlattenColumns,
+		}).Error
+		if err != nil {
 			return err
 		}
 
-		// Clear rows
-		if err := tx.Table("data").Where("webhook = ?", webhook.Id).Delete(&model.Row{}).Error; err != nil {
+		return nil
+	})
+	return webhook, batches, err
+}
+
+// RowWriter writes CSV records, for example csv.Writer.
+type RowWriter interface {
+	Write(record []string) error
+}
+
+// WriteBatch writes rows of the batch, ordered by time. Rows are read in chunks, see ReadChunkSize.
+// No cursor is open between the chunks, so a slow upload doesn't hold a database connection.
+// The header is not written, it is model.Batch.Columns.
+// Columns of the batch, which are not present in the rows, are written with empty values.
+func (s *Storage) WriteBatch(webhook *model.Webhook, batch *model.Batch, w RowWriter) error {
+	flattenColumns := webhook.FlattenColumnsOf(batch.TableId)
+	extraColumns := len(batch.Columns) - len(webhook.CsvHeader(flattenColumns))
+	if extraColumns < 0 {
+		return fmt.Errorf(`batch "%s" has less columns than the rows`, batch.Id)
+	}
+	empty := make([]string, extraColumns)
+
+	events := make(map[string]bool)
+	duplicates := 0
+	var last *model.Row
+	for {
+		// Keyset pagination, the next chunk starts after the last row
+		query := s.db.Table("data").Where("batch_id = ?", batch.Id)
+		if last != nil {
+			query = query.Where("(time > ? OR (time = ? AND id > ?))", last.Time, last.Time, last.Id)
+		}
+		var rows []*model.Row
+		if err := query.Order("time, id").Limit(s.readChunkSize).Find(&rows).Error; err != nil {
 			return err
 		}
 
-		// Update size and importedAt
-		if err := tx.Model(&model.Webhook{}).Where("id = ?", webhook.Id).Updates(&model.Webhook{Size: 0, ImportedAt: time.Now()}).Error; err != nil {
+		for _, row := range rows {
+			// Skip duplicate CloudEvents, the combination of source and id is unique
+			if row.EventId != "" {
+				key := row.EventSource + "\x00" + row.EventId
+				if events[key] {
+					duplicates++
+					continue
+				}
+				events[key] = true
+			}
+
+			// Flatten body, it has been validated on import
+			if webhook.Flatten {
+				s.flattenRow(webhook, row)
+			}
+
+			if err := w.Write(append(row.CsvRow(webhook, flattenColumns), empty...)); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < s.readChunkSize {
+			break
+		}
+		last = rows[len(rows)-1]
+	}
+
+	if duplicates > 0 {
+		s.logger.Infof(`skipped %d duplicate events in webhook "%s"`, duplicates, webhook.Hash)
+	}
+	return nil
+}
+
+// addFlattenColumns adds keys of the flattened buffered rows to the webhook columns, see model.FlattenColumns.
+func (s *Storage) addFlattenColumns(webhook *model.Webhook, tx *gorm.DB) error {
+	rows, err := tx.Table("data").Select("table_id", "body").Where("webhook = ? AND batch_id = ''", webhook.Id).Order("time").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := &model.Row{}
+		if err := tx.ScanRows(rows, row); err != nil {
 			return err
 		}
+		s.flattenRow(webhook, row)
+		webhook.FlattenColumns.Add(targetTable(webhook, row), row.Flattened.Keys())
+	}
+	return rows.Err()
+}
 
-		return nil
+func (s *Storage) flattenRow(webhook *model.Webhook, row *model.Row) {
+	if err := row.Flatten(webhook); err != nil {
+		s.logger.Warnf(`cannot flatten body in webhook "%s": %s`, webhook.Hash, err)
+		row.Flattened = orderedmap.New()
+	}
+}
+
+// tableSizes returns size of the buffered rows, which are not in a batch, grouped by the target table.
+func tableSizes(webhook *model.Webhook, tx *gorm.DB) (map[string]uint64, error) {
+	var results []struct {
+		TableId string
+		Size    uint64
+	}
+	err := tx.
+		Table("data").
+		Select("table_id, COALESCE(SUM(LENGTH(headers) + LENGTH(body)), 0) AS size").
+		Where("webhook = ? AND batch_id = ''", webhook.Id).
+		Group("table_id").
+		Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]uint64)
+	for _, result := range results {
+		row := &model.Row{TableId: result.TableId}
+		out[targetTable(webhook, row)] += result.Size
+	}
+	return out, nil
+}
+
+// batchTables returns the target tables with rows, the webhook table is the first one, the others are sorted.
+func batchTables(webhook *model.Webhook, sizePerTable map[string]uint64) []string {
+	var tableIds []string
+	for tableId := range sizePerTable {
+		if tableId != webhook.TableId {
+			tableIds = append(tableIds, tableId)
+		}
+	}
+	sort.Strings(tableIds)
+	if _, found := sizePerTable[webhook.TableId]; found {
+		tableIds = append([]string{webhook.TableId}, tableIds...)
+	}
+	return tableIds
+}
+
+// targetTable returns the table of the row, rows buffered before routing was introduced have no table.
+func targetTable(webhook *model.Webhook, row *model.Row) string {
+	if row.TableId == "" {
+		return webhook.TableId
+	}
+	return row.TableId
+}
+
+// AcquireLease acquires the lease, if it doesn't exist or it is expired, see model.Lease.
+// It returns false, if the lease is held by an owner, including the same owner.
+// Times are computed by the database, so the clocks of the replicas don't have to be synchronized.
+// Milliseconds are used, so a renewal always changes the row and RenewLease can detect a lost lease by the affected rows.
+func (s *Storage) AcquireLease(name, owner string, ttl time.Duration) (acquired bool, err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Lease{}).Clauses(clause.OnConflict{DoNothing: true}).Create(map[string]interface{}{
+			"name":         name,
+			"owner":        owner,
+			"expires_at":   leaseExpiration(ttl),
+			"heartbeat_at": gorm.Expr("NOW(3)"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			acquired = true
+			return nil
+		}
+
+		// Take over the expired lease
+		result = tx.Model(&model.Lease{}).
+			Where("name = ? AND expires_at < NOW(3)", name).
+			Updates(map[string]interface{}{"owner": owner, "expires_at": leaseExpiration(ttl), "heartbeat_at": gorm.Expr("NOW(3)")})
+		acquired = result.RowsAffected == 1
+		return result.Error
 	})
-	return webhook, err
+	return acquired, err
+}
+
+// RenewLease extends the lease held by the owner, it returns false if the lease has been lost.
+func (s *Storage) RenewLease(name, owner string, ttl time.Duration) (bool, error) {
+	result := s.db.Model(&model.Lease{}).
+		Where("name = ? AND owner = ?", name, owner).
+		Updates(map[string]interface{}{"expires_at": leaseExpiration(ttl), "heartbeat_at": gorm.Expr("NOW(3)")})
+	return result.RowsAffected == 1, result.Error
+}
+
+// leaseExpiration returns the expiration time computed by the database.
+func leaseExpiration(ttl time.Duration) clause.Expr {
+	return gorm.Expr("NOW(3) + INTERVAL ? SECOND", int(ttl.Seconds()))
+}
+
+// ReleaseLease deletes the lease held by the owner.
+func (s *Storage) ReleaseLease(name, owner string) error {
+	return s.db.Where("name = ? AND owner = ?", name, owner).Delete(&model.Lease{}).Error
 }
 
 func (s *Storage) MigrateDb() error {
@@ -185,7 +616,13 @@ func (s *Storage) MigrateDb() error {
 	if err := s.db.Exec(`SELECT GET_LOCK(?, ?)`, lockName, lockTimeout).Error; err != nil {
 		return fmt.Errorf("db migration: cannot create lock: %w", err)
 	}
-	if err := s.db.AutoMigrate(&model.Webhook{}, &model.Row{}); err != nil {
+	// AutoMigrate cannot add the auto increment primary key to the existing rows
+	if s.db.Migrator().HasTable(&model.Row{}) && !s.db.Migrator().HasColumn(&model.Row{}, "Id") {
+		if err := s.db.Exec("ALTER TABLE `data` ADD `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY FIRST").Error; err != nil {
+			return fmt.Errorf("db migration: cannot add rows id: %w", err)
+		}
+	}
+	if err := s.db.AutoMigrate(&model.Webhook{}, &model.Row{}, &model.Receipt{}, &model.Batch{}, &model.Lease{}); err != nil {
 		return fmt.Errorf("db migration: cannot migrate: %w", err)
 	}
 	if err := s.db.Exec(`SELECT RELEASE_LOCK(?)`, lockName).Error; err != nil {
@@ -196,12 +633,30 @@ func (s *Storage) MigrateDb() error {
 
 func countRows(webhookId uint32, db *gorm.DB) (uint, error) {
 	var countInt int64
-	if err := db.Model(&model.Row{}).Where("webhook = ?", webhookId).Count(&countInt).Error; err != nil {
+	if err := db.Model(&model.Row{}).Where("webhook = ? AND batch_id = ''", webhookId).Count(&countInt).Error; err != nil {
 		return 0, fmt.Errorf("cannot count rows: %w", err)
 	}
 	return uint(countInt), nil
 }
 
+// findReceipt returns receipt with the idempotency key created after the time, or nil if not found.
+func findReceipt(webhookId uint32, idempotencyKey string, after time.Time, db *gorm.DB) (*model.Receipt, error) {
+	var receipts []*model.Receipt
+	err := db.
+		Where("webhook = ? AND idempotency_key = ? AND created_at > ?", webhookId, idempotencyKey, after).
+		Order("created_at").
+		Limit(1).
+		Find(&receipts).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("cannot find receipt: %w", err)
+	}
+	if len(receipts) == 0 {
+		return nil, nil
+	}
+	return receipts[0], nil
+}
+
 func getWebhook(hashStr string, db *gorm.DB) (*model.Webhook, error) {
 	hash := model.WebhookHash(hashStr)
 	webhook := model.Webhook{}
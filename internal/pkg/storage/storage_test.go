@@ -0,0 +1,369 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testdb"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// testStorage returns the storage connected to the test database, see testdb.New.
+func testStorage(t *testing.T) *Storage {
+	t.Helper()
+	s := New(testdb.New(t), log.NewDebugLogger())
+	if err := s.MigrateDb(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// testWebhook registers a new webhook, so parallel tests don't share data.
+func testWebhook(t *testing.T, s *Storage) *model.Webhook {
+	t.Helper()
+	webhook := &model.Webhook{Token: "my-token", TableId: "in.c-bucket.table", Conditions: model.NewConditions()}
+	if err := s.RegisterWebhook(webhook); err != nil {
+		t.Fatal(err)
+	}
+	return webhook
+}
+
+func TestBatchTables(t *testing.T) {
+	t.Parallel()
+	webhook := &model.Webhook{TableId: "in.c-bucket.default"}
+
+	// Empty buffer, no batch
+	assert.Empty(t, batchTables(webhook, map[string]uint64{}))
+
+	// The webhook table is the first one
+	assert.Equal(t, []string{"in.c-bucket.default", "in.c-bucket.a", "in.c-bucket.b"}, batchTables(webhook, map[string]uint64{
+		"in.c-bucket.b":       10,
+		"in.c-bucket.default": 0,
+		"in.c-bucket.a":       20,
+	}))
+
+	// All rows are routed to other tables, no batch of the webhook table
+	assert.Equal(t, []string{"in.c-bucket.a", "in.c-bucket.b"}, batchTables(webhook, map[string]uint64{
+		"in.c-bucket.b": 10,
+		"in.c-bucket.a": 20,
+	}))
+}
+
+func TestFinishBatchFailed(t *testing.T) {
+	t.Parallel()
+	s := testStorage(t)
+	webhook := testWebhook(t, s)
+	hash := string(webhook.Hash)
+	_, receipts, _, err := s.WriteRow(hash, &model.Row{Headers: `{}`, Body: `{"id":1}`}, &model.Row{Headers: `{}`, Body: `{"id":2}`})
+	assert.NoError(t, err)
+
+	for attempt := 1; attempt <= model.MaxImportAttempts; attempt++ {
+		_, batches, err := s.Fetch(hash)
+		assert.NoError(t, err)
+		assert.Len(t, batches, 1)
+		assert.NoError(t, s.FinishBatch(batches[0], 0, errors.New("access denied")))
+
+		count, err := s.CountRows(webhook.Id)
+		assert.NoError(t, err)
+		_, batch, err := s.GetReceipt(hash, receipts[0].Id)
+		assert.NoError(t, err)
+		if attempt < model.MaxImportAttempts {
+			// Rows are returned to the buffer, the receipts are buffered again, the next import is delayed
+			assert.Equal(t, uint(2), count)
+			assert.Nil(t, batch)
+			updated, err := s.Get(hash)
+			assert.NoError(t, err)
+			if assert.NotNil(t, updated.RetryAt) {
+				assert.WithinDuration(t, time.Now().Add(model.RetryDelay(uint(attempt))), *updated.RetryAt, 10*time.Second)
+			}
+		} else {
+			// Rows failed too many times stay in the failed batch, the receipt reports the error
+			assert.Equal(t, uint(0), count)
+			if assert.NotNil(t, batch) {
+				assert.Equal(t, batches[0].Id, batch.Id)
+				assert.Equal(t, model.BatchStatusFailed, batch.Status)
+				assert.Equal(t, "access denied", batch.Error)
+			}
+		}
+	}
+}
+
+// recordsWriter collects the written CSV records.
+type recordsWriter struct {
+	records [][]string
+}
+
+func (w *recordsWriter) Write(record []string) error {
+	w.records = append(w.records, record)
+	return nil
+}
+
+func TestWriteBatchChunks(t *testing.T) {
+	t.Parallel()
+	s := testStorage(t)
+	s.readChunkSize = 2
+	webhook := testWebhook(t, s)
+	hash := string(webhook.Hash)
+	receivedAt := time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC)
+	var rows []*model.Row
+	for i := 1; i <= 5; i++ {
+		// Rows 1-4 have the same time, so they are ordered by the id
+		rowTime := receivedAt
+		if i == 5 {
+			rowTime = receivedAt.Add(-time.Hour)
+		}
+		rows = append(rows, &model.Row{Headers: `{}`, Body: fmt.Sprintf(`{"id":%d}`, i), Time: rowTime, ReceivedAt: receivedAt})
+	}
+	_, _, _, err := s.WriteRow(hash, rows...)
+	assert.NoError(t, err)
+
+	webhook, batches, err := s.Fetch(hash)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 1)
+
+	// Columns missing in the rows are written with empty values
+	batch := batches[0]
+	batch.Columns = append(batch.Columns, "note", "source")
+	w := &recordsWriter{}
+	assert.NoError(t, s.WriteBatch(webhook, batch, w))
+
+	var bodies []string
+	for _, record := range w.records {
+		assert.Equal(t, []string{"", ""}, record[len(record)-2:])
+		assert.Len(t, record, len(batch.Columns))
+		bodies = append(bodies, record[len(record)-3])
+	}
+	assert.Equal(t, []string{`{"id":5}`, `{"id":1}`, `{"id":2}`, `{"id":3}`, `{"id":4}`}, bodies)
+}
+
+func TestStaleBatches(t *testing.T) {
+	t.Parallel()
+	s := testStorage(t)
+	webhook := testWebhook(t, s)
+	hash := string(webhook.Hash)
+	_, receipts, _, err := s.WriteRow(hash, &model.Row{Headers: `{}`, Body: `{"id":1}`})
+	assert.NoError(t, err)
+	_, batches, err := s.Fetch(hash)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 1)
+	batch := batches[0]
+
+	// The batch is not stale yet
+	staleBatchIds := func() (ids []string) {
+		webhooks, err := s.StaleBatches(time.Now().Add(-time.Minute))
+		assert.NoError(t, err)
+		for _, w := range webhooks {
+			if w.Id == webhook.Id {
+				for _, b := range w.Batches {
+					ids = append(ids, b.Id)
+				}
+			}
+		}
+		return ids
+	}
+	assert.Empty(t, staleBatchIds())
+
+	// The batch is old, but the import is still running
+	assert.NoError(t, s.db.Model(batch).Update("created_at", time.Now().Add(-time.Hour)).Error)
+	lease := model.ImportLease(webhook.Hash)
+	acquired, err := s.AcquireLease(lease, "owner", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Empty(t, staleBatchIds())
+
+	// The import lease is released, the batch is stale
+	assert.NoError(t, s.ReleaseLease(lease, "owner"))
+	assert.Equal(t, []string{batch.Id}, staleBatchIds())
+
+	// Rows of the finished stale batch are returned to the buffer
+	assert.NoError(t, s.FinishBatch(batch, 0, errors.New("the import has been interrupted")))
+	assert.Empty(t, staleBatchIds())
+	count, err := s.CountRows(webhook.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), count)
+	_, receiptBatch, err := s.GetReceipt(hash, receipts[0].Id)
+	assert.NoError(t, err)
+	assert.Nil(t, receiptBatch)
+}
+
+func TestLease(t *testing.T) {
+	t.Parallel()
+	s := testStorage(t)
+	name := "test/" + gonanoid.Must()
+
+	// Acquire
+	acquired, err := s.AcquireLease(name, "owner1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+
+	// Conflict, the lease is held, including the same owner
+	acquired, err = s.AcquireLease(name, "owner2", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+	acquired, err = s.AcquireLease(name, "owner1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+
+	// Renewal
+	renewed, err := s.RenewLease(name, "owner1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, renewed)
+	renewed, err = s.RenewLease(name, "owner2", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, renewed)
+
+	// Expired lease is taken over, the expiration is computed by the database
+	assert.NoError(t, s.db.Model(&model.Lease{}).Where("name = ?", name).Update("expires_at", gorm.Expr("NOW(3) - INTERVAL 1 SECOND")).Error)
+	acquired, err = s.AcquireLease(name, "owner2", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+
+	// The lost lease cannot be renewed, or released by the previous owner
+	renewed, err = s.RenewLease(name, "owner1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, renewed)
+	assert.NoError(t, s.ReleaseLease(name, "owner1"))
+	acquired, err = s.AcquireLease(name, "owner1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+
+	// Release
+	assert.NoError(t, s.ReleaseLease(name, "owner2"))
+	acquired, err = s.AcquireLease(name, "owner1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	assert.NoError(t, s.ReleaseLease(name, "owner1"))
+}
+
+func TestIsRepeated(t *testing.T) {
+	t.Parallel()
+	s := testStorage(t)
+	webhook := testWebhook(t, s)
+	webhook.Idempotency = model.Idempotency{Source: model.IdempotencySourceBodyHash, Window: model.DefaultIdempotencyWindow}
+
+	// The key has not been delivered
+	repeated, err := s.IsRepeated(webhook, "key1")
+	assert.NoError(t, err)
+	assert.False(t, repeated)
+
+	// The key has been delivered
+	_, _, _, err = s.WriteRow(string(webhook.Hash), &model.Row{Headers: `{}`, Body: `{}`, IdempotencyKey: "key1"})
+	assert.NoError(t, err)
+	repeated, err = s.IsRepeated(webhook, "key1")
+	assert.NoError(t, err)
+	assert.True(t, repeated)
+	repeated, err = s.IsRepeated(webhook, "key2")
+	assert.NoError(t, err)
+	assert.False(t, repeated)
+}
+
+func TestGetReceipt(t *testing.T) {
+	t.Parallel()
+	s := testStorage(t)
+	webhook := testWebhook(t, s)
+	hash := string(webhook.Hash)
+	_, receipts, _, err := s.WriteRow(hash, &model.Row{Headers: `{}`, Body: `{"id":1}`})
+	assert.NoError(t, err)
+
+	// The receipt is buffered
+	receipt, batch, err := s.GetReceipt(hash, receipts[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, receipts[0].Id, receipt.Id)
+	assert.Nil(t, batch)
+
+	// The receipt is in the batch
+	_, batches, err := s.Fetch(hash)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 1)
+	receipt, batch, err = s.GetReceipt(hash, receipts[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, batches[0].Id, receipt.BatchId)
+	if assert.NotNil(t, batch) {
+		assert.Equal(t, batches[0].Id, batch.Id)
+		assert.Equal(t, model.BatchStatusImporting, batch.Status)
+	}
+
+	// The receipt of another webhook is not found
+	other := testWebhook(t, s)
+	_, _, err = s.GetReceipt(string(other.Hash), receipts[0].Id)
+	assert.EqualError(t, err, fmt.Sprintf(`Receipt "%s" not found.`, receipts[0].Id))
+
+	// Unknown receipt
+	_, _, err = s.GetReceipt(hash, "unknown")
+	assert.EqualError(t, err, `Receipt "unknown" not found.`)
+}
+
+func TestDeleteExpiredReceipts(t *testing.T) {
+	t.Parallel()
+	s := testStorage(t)
+	webhook := testWebhook(t, s)
+	hash := string(webhook.Hash)
+	expired := time.Now().Add(-model.ReceiptRetention - time.Hour)
+
+	// Rows failed too many times stay in the failed batch
+	_, failedReceipts, _, err := s.WriteRow(hash, &model.Row{Headers: `{}`, Body: `{"id":1}`})
+	assert.NoError(t, err)
+	var failedBatch *model.Batch
+	for attempt := 1; attempt <= model.MaxImportAttempts; attempt++ {
+		_, batches, err := s.Fetch(hash)
+		assert.NoError(t, err)
+		if !assert.Len(t, batches, 1) {
+			t.FailNow()
+		}
+		failedBatch = batches[0]
+		assert.NoError(t, s.FinishBatch(failedBatch, 0, errors.New("access denied")))
+	}
+
+	// The imported batch
+	_, importedReceipts, _, err := s.WriteRow(hash, &model.Row{Headers: `{}`, Body: `{"id":2}`})
+	assert.NoError(t, err)
+	_, batches, err := s.Fetch(hash)
+	assert.NoError(t, err)
+	if !assert.Len(t, batches, 1) {
+		t.FailNow()
+	}
+	importedBatch := batches[0]
+	assert.NoError(t, s.FinishBatch(importedBatch, 123, nil))
+
+	// The buffered receipt is not expired
+	_, bufferedReceipts, _, err := s.WriteRow(hash, &model.Row{Headers: `{}`, Body: `{"id":3}`})
+	assert.NoError(t, err)
+
+	// Expire the receipts and the batches of the first two rows
+	for _, receipt := range []*model.Receipt{failedReceipts[0], importedReceipts[0]} {
+		assert.NoError(t, s.db.Model(receipt).Update("created_at", expired).Error)
+	}
+	for _, batch := range []*model.Batch{failedBatch, importedBatch} {
+		assert.NoError(t, s.db.Model(batch).Update("created_at", expired).Error)
+	}
+	deleted, err := s.DeleteExpiredReceipts()
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, deleted, int64(2))
+
+	// Expired receipts, batches and rows of the failed batch are deleted
+	for _, receipt := range []*model.Receipt{failedReceipts[0], importedReceipts[0]} {
+		_, _, err := s.GetReceipt(hash, receipt.Id)
+		assert.EqualError(t, err, fmt.Sprintf(`Receipt "%s" not found.`, receipt.Id))
+	}
+	var batchCount int64
+	assert.NoError(t, s.db.Model(&model.Batch{}).Where("id IN ?", []string{failedBatch.Id, importedBatch.Id}).Count(&batchCount).Error)
+	assert.Equal(t, int64(0), batchCount)
+	var rowCount int64
+	assert.NoError(t, s.db.Table("data").Where("batch_id = ?", failedBatch.Id).Count(&rowCount).Error)
+	assert.Equal(t, int64(0), rowCount)
+
+	// The buffered receipt and its row are kept
+	receipt, batch, err := s.GetReceipt(hash, bufferedReceipts[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, bufferedReceipts[0].Id, receipt.Id)
+	assert.Nil(t, batch)
+	count, err := s.CountRows(webhook.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), count)
+}
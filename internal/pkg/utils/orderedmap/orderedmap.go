@@ -4,7 +4,9 @@ package orderedmap
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"sort"
 
 	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/deepcopy"
@@ -129,7 +131,7 @@ func (o *OrderedMap) SetNestedPath(keys Key, value interface{}) error {
 			}
 		case SliceStep:
 			if s, ok := current.([]interface{}); ok {
-				if len(s) >= int(key) {
+				if int(key) < len(s) {
 					current = s[key]
 					continue
 				} else {
@@ -217,7 +219,7 @@ func (o *OrderedMap) GetNestedPath(keys Key) (value interface{}, found bool, err
 			}
 		case SliceStep:
 			if s, ok := current.([]interface{}); ok {
-				if len(s) >= int(key) {
+				if int(key) < len(s) {
 					current = s[key]
 					continue
 				} else {
@@ -290,8 +292,29 @@ func (o *OrderedMap) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
+	return o.decodeKeys(b)
+}
+
+// UnmarshalJSONUseNumber is UnmarshalJSON, but numbers are decoded as json.Number, so large integers are not rounded.
+func (o *OrderedMap) UnmarshalJSONUseNumber(b []byte) error {
+	if o.values == nil {
+		o.values = map[string]interface{}{}
+	}
+	valuesDec := json.NewDecoder(bytes.NewReader(b))
+	valuesDec.UseNumber()
+	if err := valuesDec.Decode(&o.values); err != nil {
+		return err
+	}
+	if _, err := valuesDec.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid character after top-level value")
+	}
+	return o.decodeKeys(b)
+}
+
+// decodeKeys loads the order of the keys, values are already decoded.
+func (o *OrderedMap) decodeKeys(b []byte) error {
 	dec := json.NewDecoder(bytes.NewReader(b))
-	if _, err = dec.Token(); err != nil { // skip '{'
+	if _, err := dec.Token(); err != nil { // skip '{'
 		return err
 	}
 	o.keys = make([]string, 0, len(o.values))
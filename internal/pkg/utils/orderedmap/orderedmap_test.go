@@ -668,6 +668,13 @@ func TestOrderedMapGetNested(t *testing.T) {
 	value = root.GetNestedPathOrNil(Key{MapStep(`nested`), MapStep(`slice`), SliceStep(123)})
 	assert.Nil(t, value)
 
+	// Slice index equal to slice length
+	value, found, err = root.GetNested(`nested.slice[3]`)
+	assert.Nil(t, value)
+	assert.False(t, found)
+	assert.Error(t, err)
+	assert.Equal(t, `key "nested.slice[3]" not found`, err.Error())
+
 	// Get nested map - not found
 	value, found, err = root.GetNestedMap(`nested.foo`)
 	assert.Nil(t, value)
@@ -814,3 +821,13 @@ path=str, parent=*orderedmap.OrderedMap, value=string
 	})
 	assert.Equal(t, strings.TrimSpace(expected), strings.Join(visited, "\n"))
 }
+
+func TestUnmarshalJSONUseNumber(t *testing.T) {
+	t.Parallel()
+	o := New()
+	assert.NoError(t, o.UnmarshalJSONUseNumber([]byte(`{"b": 12345678901234567891, "a": {"c": 1.50}}`)))
+	assert.Equal(t, []string{"b", "a"}, o.Keys())
+	assert.Equal(t, json.Number("12345678901234567891"), o.GetOrNil("b"))
+	assert.Equal(t, json.Number("1.50"), o.GetNestedOrNil("a.c"))
+	assert.Error(t, New().UnmarshalJSONUseNumber([]byte(`{"a": 1} {}`)))
+}
@@ -6,14 +6,20 @@ import (
 	"time"
 
 	"github.com/jarcoal/httpmock"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/api/queueapi"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/api/storageapi"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
 )
 
 func NewMockedStorageApi(logger log.DebugLogger) (*storageapi.Api, *httpmock.MockTransport) {
+	return NewMockedStorageApiWithContext(context.Background(), logger)
+}
+
+// NewMockedStorageApiWithContext returns the mocked API, its requests are cancelled by the context.
+func NewMockedStorageApiWithContext(ctx context.Context, logger log.DebugLogger) (*storageapi.Api, *httpmock.MockTransport) {
 	// Set short retry delay in tests
-	api := storageapi.New(context.Background(), logger, "connection.keboola.com", false)
+	api := storageapi.New(ctx, logger, "connection.keboola.com", false)
 	api.SetRetry(3, 1*time.Millisecond, 1*time.Millisecond)
 	api = api.WithToken(model.Token{Owner: model.TokenOwner{Id: 12345}})
 
@@ -41,3 +47,15 @@ func NewStorageApiWithToken(host, tokenStr string, verbose bool) (*storageapi.Ap
 	}
 	return a.WithToken(token), logger
 }
+
+func NewMockedQueueApi(logger log.DebugLogger) (*queueapi.Api, *httpmock.MockTransport) {
+	// Set short retry delay in tests
+	api := queueapi.New(context.Background(), logger, "queue.keboola.com", false)
+	api.SetRetry(3, 1*time.Millisecond, 1*time.Millisecond)
+	api = api.WithToken(model.Token{Token: "my-token"})
+
+	// Mocked resty transport
+	transport := httpmock.NewMockTransport()
+	api.HttpClient().Transport = transport
+	return api, transport
+}
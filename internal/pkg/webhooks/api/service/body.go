@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/api/storageapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/filestorage"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/payload"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+)
+
+// MultipartMaxMemory is the size of multipart files kept in memory until they are uploaded, bigger files are stored in temporary files.
+const MultipartMaxMemory = 10 * 1024 * 1024
+
+// readRows converts the request to rows, one request can contain multiple CloudEvents.
+// The multipart form is returned if the body contains files, they are uploaded later, see Service.uploadFiles.
+func (s *Service) readRows(webhook *model.Webhook, req *http.Request, headers http.Header, bodyStream io.Reader) ([]*model.Row, *multipart.Form, error) {
+	headersJson := json.MustEncodeString(headers, true)
+	if !webhook.CloudEvents {
+		body, form, err := s.readBody(webhook, req, bodyStream)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*model.Row{{Headers: headersJson, Body: body}}, form, nil
+	}
+
+	events, form, err := s.readCloudEvents(webhook, req, headers, bodyStream)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([]*model.Row, 0, len(events))
+	for _, event := range events {
+		rows = append(rows, &model.Row{
+			Headers:      headersJson,
+			Body:         event.Data,
+			EventId:      event.Id,
+			EventSource:  event.Source,
+			EventType:    event.Type,
+			EventSubject: event.Subject,
+			EventTime:    event.Time,
+		})
+	}
+	return rows, form, nil
+}
+
+// validateRows checks body of each row against the webhook JSON Schema.
+func (s *Service) validateRows(webhook *model.Webhook, rows []*model.Row) error {
+	if webhook.Schema == "" {
+		return nil
+	}
+
+	schema, err := s.schemas.get(webhook)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for i, row := range rows {
+		for _, msg := range schema.Validate(row.Body) {
+			if len(rows) > 1 {
+				msg = fmt.Sprintf("event %d: %s", i, msg)
+			}
+			errs = append(errs, msg)
+		}
+	}
+
+	if len(errs) > 0 {
+		return &webhooks.InvalidPayloadError{Message: "Request body does not match the webhook schema.", Errors: errs}
+	}
+	return nil
+}
+
+// flattenRows checks that body of each row can be flattened, see model.Webhook.Flatten.
+func flattenRows(webhook *model.Webhook, rows []*model.Row) error {
+	if !webhook.Flatten {
+		return nil
+	}
+	for _, row := range rows {
+		if err := row.Flatten(webhook); err != nil {
+			return &webhooks.BadRequestError{Message: fmt.Sprintf("Cannot flatten body: %s.", err)}
+		}
+	}
+	return nil
+}
+
+// setSchema sets the webhook JSON Schema, if it is valid. Empty string removes the schema.
+func setSchema(webhook *model.Webhook, schema string) error {
+	if schema != "" {
+		if _, err := payload.CompileSchema(schema); err != nil {
+			return err
+		}
+	}
+	webhook.Schema = schema
+	return nil
+}
+
+// setIdempotencyKeys sets the key used to detect a repeated delivery, see model.Idempotency.
+func setIdempotencyKeys(webhook *model.Webhook, headers http.Header, rows []*model.Row) error {
+	if !webhook.Idempotency.Enabled() {
+		return nil
+	}
+
+	for i, row := range rows {
+		key, err := webhook.Idempotency.KeyOf(headers, row.Body)
+		if err != nil {
+			return &webhooks.BadRequestError{Message: fmt.Sprintf("Invalid body: %s.", err)}
+		}
+		// Header identifies the whole request, rows from one request must be distinguished
+		if key != "" && webhook.Idempotency.Source == model.IdempotencySourceHeader && len(rows) > 1 {
+			key = fmt.Sprintf("%s#%d", key, i)
+		}
+		row.IdempotencyKey = key
+	}
+	return nil
+}
+
+func setIdempotency(webhook *model.Webhook, v *webhooks.Idempotency) error {
+	key := ""
+	if v.Key != nil {
+		key = *v.Key
+	}
+	idempotency, err := model.NewIdempotency(v.Source, key, v.Window)
+	if err != nil {
+		return err
+	}
+	webhook.Idempotency = idempotency
+	return nil
+}
+
+// setEventTimes sets time of each row from the request, see model.EventTime.
+func setEventTimes(webhook *model.Webhook, headers http.Header, rows []*model.Row) error {
+	if !webhook.EventTime.Enabled() {
+		return nil
+	}
+
+	receivedAt := time.Now()
+	for _, row := range rows {
+		row.ReceivedAt = receivedAt
+		value, found, err := webhook.EventTime.TimeOf(headers, row.Body)
+		if err != nil {
+			return &webhooks.BadRequestError{Message: fmt.Sprintf("Invalid event time: %s.", err)}
+		}
+		if found {
+			row.Time = value
+		} else {
+			row.Time = receivedAt
+		}
+	}
+	return nil
+}
+
+func setEventTime(webhook *model.Webhook, v *webhooks.EventTime) error {
+	key := ""
+	if v.Key != nil {
+		key = *v.Key
+	}
+	eventTime, err := model.NewEventTime(v.Source, key, v.Format)
+	if err != nil {
+		return err
+	}
+	webhook.EventTime = eventTime
+	return nil
+}
+
+// setRoutes replaces the webhook routing rules, empty slice removes the rules.
+func setRoutes(webhook *model.Webhook, routes []*webhooks.Route) error {
+	out := make(model.Routes, 0, len(routes))
+	for _, v := range routes {
+		route, err := model.NewRoute(v.Source, v.Key, v.Value, v.TableID)
+		if err != nil {
+			return err
+		}
+		out = append(out, route)
+	}
+	webhook.Routes = out
+	return nil
+}
+
+// dropRows removes rows matching a drop rule or not sampled, see model.Webhook.Drops.
+func dropRows(webhook *model.Webhook, headers http.Header, rows []*model.Row) (kept []*model.Row, dropped uint) {
+	kept = rows[:0]
+	for _, row := range rows {
+		if webhook.Drops(headers, row.Body) {
+			dropped++
+			continue
+		}
+		kept = append(kept, row)
+	}
+	return kept, dropped
+}
+
+// setDropRules replaces the webhook drop rules, empty slice removes the rules.
+func setDropRules(webhook *model.Webhook, rules []*webhooks.DropRule) error {
+	out := make(model.DropRules, 0, len(rules))
+	for _, v := range rules {
+		rule, err := model.NewDropRule(v.Source, v.Key, v.Value)
+		if err != nil {
+			return err
+		}
+		out = append(out, rule)
+	}
+	webhook.DropRules = out
+	return nil
+}
+
+// setTrigger replaces the job created after the import, the time of the last job is kept.
+func setTrigger(webhook *model.Webhook, v *webhooks.Trigger) error {
+	trigger, err := model.NewTrigger(v.ComponentID, v.ConfigID, v.MinInterval)
+	if err != nil {
+		return err
+	}
+	trigger.LastAt = webhook.Trigger.LastAt
+	webhook.Trigger = trigger
+	return nil
+}
+
+// readCloudEvents reads CloudEvents in the binary or in the structured content mode.
+func (s *Service) readCloudEvents(webhook *model.Webhook, req *http.Request, headers http.Header, bodyStream io.Reader) ([]payload.CloudEvent, *multipart.Form, error) {
+	// Binary content mode, the body is the event data
+	if payload.IsBinaryCloudEvent(headers) {
+		body, form, err := s.readBody(webhook, req, bodyStream)
+		if err != nil {
+			return nil, nil, err
+		}
+		event, err := payload.CloudEventFromBinary(headers, body)
+		if err != nil {
+			removeForm(form)
+			return nil, nil, &webhooks.BadRequestError{Message: fmt.Sprintf("Invalid CloudEvent: %s.", err)}
+		}
+		return []payload.CloudEvent{event}, form, nil
+	}
+
+	// Structured content mode
+	mediaType, _, _ := mime.ParseMediaType(headers.Get("Content-Type"))
+	if mediaType != payload.CloudEventsContentType && mediaType != payload.CloudEventsBatchContentType {
+		return nil, nil, &webhooks.BadRequestError{Message: fmt.Sprintf(`Expected a CloudEvent, "ce-*" headers or content type "%s" / "%s" are missing.`, payload.CloudEventsContentType, payload.CloudEventsBatchContentType)}
+	}
+	data, err := io.ReadAll(bodyStream)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read request body: %w", err)
+	}
+	events, err := payload.CloudEventsFromStructured(data, mediaType == payload.CloudEventsBatchContentType)
+	if err != nil {
+		return nil, nil, &webhooks.BadRequestError{Message: fmt.Sprintf("Cannot parse CloudEvents: %s.", err)}
+	}
+	return events, nil, nil
+}
+
+// readBody returns the request body as it should be stored in the row.
+// Files of a multipart body are not uploaded yet, the body contains their placeholders, see fileValue.
+func (s *Service) readBody(webhook *model.Webhook, req *http.Request, bodyStream io.Reader) (string, *multipart.Form, error) {
+	// GET request is stored as query parameters
+	if req.Method == http.MethodGet {
+		return json.MustEncodeString(payload.FromValues(req.URL.Query()), false), nil, nil
+	}
+
+	// XML body is converted to JSON
+	if webhook.BodyFormat == model.BodyFormatXml {
+		data, err := io.ReadAll(bodyStream)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot read request body: %w", err)
+		}
+		out, err := payload.XmlToJson(data)
+		if err != nil {
+			return "", nil, &webhooks.BadRequestError{Message: fmt.Sprintf("Cannot parse XML body: %s.", err)}
+		}
+		return json.MustEncodeString(out, false), nil, nil
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		data, err := io.ReadAll(bodyStream)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot read request body: %w", err)
+		}
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return "", nil, &webhooks.BadRequestError{Message: fmt.Sprintf("Cannot parse form body: %s.", err)}
+		}
+		return json.MustEncodeString(payload.FromValues(values), false), nil, nil
+	case "multipart/form-data":
+		form, err := multipart.NewReader(bodyStream, params["boundary"]).ReadForm(MultipartMaxMemory)
+		if err != nil {
+			return "", nil, &webhooks.BadRequestError{Message: fmt.Sprintf("Cannot parse multipart body: %s.", err)}
+		}
+		fields, err := payload.FromMultipart(form, func(file *multipart.FileHeader) (interface{}, error) {
+			return fileValue(file, 0), nil
+		})
+		if err != nil {
+			removeForm(form)
+			return "", nil, err
+		}
+		return json.MustEncodeString(fields, false), form, nil
+	default:
+		data, err := io.ReadAll(bodyStream)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot read request body: %w", err)
+		}
+		return string(data), nil, nil
+	}
+}
+
+// uploadFiles uploads files of the multipart body to the Keboola File Storage of the webhook project
+// and replaces the placeholders in the row body by the file IDs.
+// It is called when the row has been dropped, validated and checked for a repeated delivery,
+// so files are uploaded only for a row which will be written.
+// If an upload fails, the files already uploaded from the request are deleted.
+func (s *Service) uploadFiles(ctx context.Context, webhook *model.Webhook, rows []*model.Row, form *multipart.Form) error {
+	// Multipart body is always stored in one row
+	if form == nil || len(form.File) == 0 || len(rows) != 1 {
+		return nil
+	}
+	row := rows[0]
+
+	// Skip a repeated delivery, the row is not written, see storage.Storage.WriteRow
+	if row.IdempotencyKey != "" {
+		repeated, err := s.storage.IsRepeated(webhook, row.IdempotencyKey)
+		if err != nil {
+			return err
+		}
+		if repeated {
+			return nil
+		}
+	}
+
+	stack, err := s.stackOf(webhook)
+	if err != nil {
+		return err
+	}
+	apiWithToken := stack.storageApi.WithToken(model.Token{Token: webhook.Token}).WithBranch(webhook.BranchId)
+
+	var uploaded []int
+	fields, err := payload.FromMultipart(form, func(file *multipart.FileHeader) (interface{}, error) {
+		fileId, err := uploadFile(ctx, apiWithToken, file)
+		if err != nil {
+			return nil, err
+		}
+		uploaded = append(uploaded, fileId)
+		s.logger.Infof(`uploaded file "%s" from webhook "%s", fileId=%d`, file.Filename, webhook.Hash, fileId)
+		return fileValue(file, fileId), nil
+	})
+	var uploadErr *payload.UploadError
+	if errors.As(err, &uploadErr) {
+		// The body is valid, but the file storage failed
+		s.logger.Errorf(`cannot upload file from webhook "%s": %s`, webhook.Hash, err)
+		for _, fileId := range uploaded {
+			if err := apiWithToken.DeleteFile(fileId); err != nil {
+				s.logger.Errorf(`cannot delete file "%d" from webhook "%s": %s`, fileId, webhook.Hash, err)
+			}
+		}
+		return &webhooks.UpstreamError{Message: fmt.Sprintf(`Cannot upload file "%s" to the file storage, please try again later.`, uploadErr.FileName)}
+	} else if err != nil {
+		return err
+	}
+
+	// The flattened body contains the file IDs
+	row.Body = json.MustEncodeString(fields, false)
+	return flattenRows(webhook, rows)
+}
+
+// uploadFile uploads the file to the Keboola File Storage and returns its ID.
+// The upload is aborted when the request context is done.
+func uploadFile(ctx context.Context, apiWithToken *storageapi.Api, file *multipart.FileHeader) (int, error) {
+	fileResource, err := apiWithToken.CreateFileResource(file.Filename)
+	if err != nil {
+		return 0, fmt.Errorf(`cannot create file resource: %w`, err)
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return 0, fmt.Errorf(`cannot read file: %w`, err)
+	}
+	defer reader.Close()
+	if err := filestorage.Upload(ctx, reader, fileResource); err != nil {
+		return 0, fmt.Errorf(`cannot upload file: %w`, err)
+	}
+	return fileResource.Id, nil
+}
+
+// fileValue is stored in the body instead of the file content.
+// The placeholder with zero file ID has the same keys, so the body is validated before the upload.
+func fileValue(file *multipart.FileHeader, fileId int) map[string]interface{} {
+	return map[string]interface{}{
+		"fileId":      fileId,
+		"name":        file.Filename,
+		"contentType": file.Header.Get("Content-Type"),
+		"size":        file.Size,
+	}
+}
+
+// removeForm removes temporary files of the multipart form, see MultipartMaxMemory.
+func removeForm(form *multipart.Form) {
+	if form != nil {
+		_ = form.RemoveAll()
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadMultipartBody(t *testing.T) {
+	t.Parallel()
+	storageApi, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("POST", `=~/files/prepare$`, httpmock.NewJsonResponderOrPanic(400, map[string]interface{}{"error": "File storage is not available"}))
+	s := &Service{
+		logger:                log.NewDebugLogger(),
+		stacks:                map[string]*stack{"connection.keboola.com": {storageApi: storageApi}},
+		defaultStorageApiHost: "connection.keboola.com",
+	}
+	webhook := &model.Webhook{Hash: "hash", Token: "my-token", BodyFormat: model.BodyFormatAuto}
+
+	// Create body
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	assert.NoError(t, writer.WriteField("from", "+420123456789"))
+	file, err := writer.CreateFormFile("attachment", "invoice.pdf")
+	assert.NoError(t, err)
+	_, err = file.Write([]byte("%PDF-1.4 content"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/webhook/hash/import", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	// The file is not uploaded yet, the body contains the placeholder
+	rows, form, err := s.readRows(webhook, req, req.Header, req.Body)
+	assert.NoError(t, err)
+	defer removeForm(form)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, `{"attachment":{"contentType":"application/octet-stream","fileId":0,"name":"invoice.pdf","size":16},"from":"+420123456789"}`, rows[0].Body)
+	}
+	assert.Equal(t, 0, transport.GetTotalCallCount())
+
+	// The row has been dropped, no file is uploaded
+	assert.NoError(t, s.uploadFiles(context.Background(), webhook, nil, form))
+	assert.Equal(t, 0, transport.GetTotalCallCount())
+
+	// The file storage failed
+	err = s.uploadFiles(context.Background(), webhook, rows, form)
+	var upstreamErr *webhooks.UpstreamError
+	if assert.True(t, errors.As(err, &upstreamErr)) {
+		assert.Equal(t, `Cannot upload file "invoice.pdf" to the file storage, please try again later.`, upstreamErr.Message)
+	}
+	assert.Equal(t, 1, transport.GetTotalCallCount())
+}
+
+func TestReadMultipartBodyMalformed(t *testing.T) {
+	t.Parallel()
+	s := &Service{logger: log.NewDebugLogger()}
+	webhook := &model.Webhook{Hash: "hash", BodyFormat: model.BodyFormatAuto}
+
+	// The second part is not terminated, the whole body is rejected before any upload
+	body := "--boundary\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\ncontent\r\n--boundary\r\nContent-Disposition: form-data; name=\"from\"\r\n\r\nvalue"
+	req := httptest.NewRequest(http.MethodPost, "/webhook/hash/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+	_, form, err := s.readRows(webhook, req, req.Header, req.Body)
+	assert.Nil(t, form)
+	var badRequestErr *webhooks.BadRequestError
+	assert.True(t, errors.As(err, &badRequestErr))
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+// validateBranch checks that the development branch exists in the project of the webhook token. Zero means the default branch.
+// It calls the Storage API, so it is called before the webhook is locked in the database, see storage.Storage.UpdateWebhook.
+func (s *Service) validateBranch(webhook *model.Webhook, branchId int) error {
+	if branchId == 0 {
+		return nil
+	}
+	stack, err := s.stackOf(webhook)
+	if err != nil {
+		return err
+	}
+	apiWithToken := stack.storageApi.WithToken(model.Token{Token: webhook.Token})
+	if _, err := apiWithToken.GetBranch(branchId); err != nil {
+		var errWithResponse client.ErrorWithResponse
+		if errors.As(err, &errWithResponse) && errWithResponse.IsNotFound() {
+			return fmt.Errorf(`branch "%d" not found`, branchId)
+		}
+		return fmt.Errorf(`cannot get branch "%d": %w`, branchId, err)
+	}
+	return nil
+}
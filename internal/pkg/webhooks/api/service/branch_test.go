@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBranch(t *testing.T) {
+	t.Parallel()
+	storageApi, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("GET", "https://connection.keboola.com/v2/storage/dev-branches/123", httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{"id": 123, "name": "staging"}))
+	transport.RegisterResponder("GET", "https://connection.keboola.com/v2/storage/dev-branches/456", httpmock.NewJsonResponderOrPanic(404, map[string]interface{}{"error": "Branch not found"}))
+	transport.RegisterResponder("GET", "https://connection.keboola.com/v2/storage/dev-branches/789", httpmock.NewJsonResponderOrPanic(500, map[string]interface{}{"error": "Internal error"}))
+	s := &Service{
+		stacks:                map[string]*stack{"connection.keboola.com": {storageApi: storageApi}},
+		defaultStorageApiHost: "connection.keboola.com",
+	}
+	webhook := &model.Webhook{Token: "my-token"}
+
+	// Default branch, no API call
+	assert.NoError(t, s.validateBranch(webhook, 0))
+	assert.Equal(t, 0, transport.GetTotalCallCount())
+
+	// Branch exists
+	assert.NoError(t, s.validateBranch(webhook, 123))
+
+	// Branch not found
+	assert.EqualError(t, s.validateBranch(webhook, 456), `branch "456" not found`)
+
+	// Other errors are not reported as a missing branch
+	err := s.validateBranch(webhook, 789)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `cannot get branch "789": `)
+	}
+}
+
+func TestUpdateBranch(t *testing.T) {
+	t.Parallel()
+	s, storageTransport, _ := testService(t)
+	storageTransport.RegisterResponder("GET", "https://connection.keboola.com/v2/storage/dev-branches/123", httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{"id": 123, "name": "staging"}))
+	storageTransport.RegisterResponder("GET", "https://connection.keboola.com/v2/storage/dev-branches/456", httpmock.NewJsonResponderOrPanic(404, map[string]interface{}{"error": "Branch not found"}))
+	webhook := &model.Webhook{Token: "my-token", TableId: "in.c-bucket.table", Conditions: model.NewConditions()}
+	assert.NoError(t, s.storage.RegisterWebhook(webhook))
+	hash := string(webhook.Hash)
+
+	// Branch not found, the webhook is not modified
+	branchId := 456
+	_, err := s.Update(context.Background(), &webhooks.UpdatePayload{Hash: hash, BranchID: &branchId})
+	assert.EqualError(t, err, `branch "456" not found`)
+	stored, err := s.storage.Get(hash)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stored.BranchId)
+
+	// Branch exists
+	branchId = 123
+	res, err := s.Update(context.Background(), &webhooks.UpdatePayload{Hash: hash, BranchID: &branchId})
+	assert.NoError(t, err)
+	assert.Equal(t, 123, res.BranchID)
+	stored, err = s.storage.Get(hash)
+	assert.NoError(t, err)
+	assert.Equal(t, 123, stored.BranchId)
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/api/storageapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+const (
+	JobCheckInterval = 5 * time.Second
+	// JobTimeout is the max duration of the import job, then the batch is failed and its rows are returned to the buffer.
+	JobTimeout = 12 * time.Hour
+	// StaleBatchTimeout is the min age of a batch without the Storage job and without the import lease, then the batch is failed
+	// and its rows are returned to the buffer. It is longer than the upload timeout of the max batch, see filestorage.Timeout.
+	StaleBatchTimeout = 15 * time.Minute
+)
+
+// errStaleBatch is the error of a batch, which import has been interrupted before the Storage job was created.
+var errStaleBatch = errors.New("the import has been interrupted, the rows have been returned to the buffer")
+
+// StartJobTracker polls Storage jobs of the importing batches and finishes the batches.
+// Jobs are persisted, so the jobs created before a restart are tracked too.
+func (s *Service) StartJobTracker() {
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		ticker := time.NewTicker(JobCheckInterval)
+		defer ticker.Stop()
+		for {
+			s.trackJobs()
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// trackJobs finishes the batches, which Storage jobs are finished.
+// The trigger is created once per import, after all its jobs are finished, see Service.triggerAfterImport.
+// Jobs are tracked by one replica at a time, see model.JobTrackerLease.
+func (s *Service) trackJobs() {
+	if !s.acquireLease(model.JobTrackerLease) {
+		return
+	}
+	ctx, release := s.holdLeases(s.ctx, model.JobTrackerLease)
+	defer release()
+
+	s.recoverStaleBatches()
+
+	items, err := s.storage.TrackedBatches()
+	if err != nil {
+		s.logger.Errorf(`cannot load tracked batches: %s`, err)
+		return
+	}
+
+	// Merged batches share the job, it is loaded once, see model.Batch.MergedTo.
+	// The merged batches are checked after the first batch of the group,
+	// so the job is loaded by the token, which has created it, see importGroup.split.
+	jobs := make(map[string]*model.Job)
+	finished := make(map[*model.Webhook][]*model.Batch)
+	for _, merged := range []bool{false, true} {
+		for _, webhook := range items {
+			// Stop, if the lease has been lost or on shutdown, jobs are tracked by the next run
+			if ctx.Err() != nil {
+				return
+			}
+
+			stack, err := s.stackOf(webhook)
+			if err != nil {
+				s.logger.Errorf(`cannot track jobs of "%s": %s`, webhook.Hash, err)
+				continue
+			}
+			apiWithToken := stack.storageApi.WithToken(model.Token{Token: webhook.Token}).WithBranch(webhook.BranchId)
+
+			for i := range webhook.Batches {
+				batch := &webhook.Batches[i]
+				if (batch.MergedTo != "") != merged {
+					continue
+				}
+				importErr, done := s.checkJob(apiWithToken, webhook, batch, jobs)
+				if !done {
+					continue
+				}
+				if err := s.storage.FinishBatch(batch, batch.JobId, importErr); err != nil {
+					s.logger.Errorf(`cannot finish batch "%s": %s`, batch.Id, err)
+					continue
+				}
+				if importErr != nil {
+					s.logger.Errorf(`cannot import batch "%s" of "%s": %s`, batch.Id, webhook.Hash, importErr)
+				} else {
+					s.logger.Infof(`imported batch "%s" of "%s", tableId="%s", rows=%d`, batch.Id, webhook.Hash, batch.TableId, batch.ImportedRows)
+				}
+				finished[webhook] = append(finished[webhook], batch)
+			}
+		}
+	}
+
+	// Create the job after a successful import
+	for _, webhook := range items {
+		s.triggerAfterImports(webhook, finished[webhook])
+	}
+}
+
+// recoverStaleBatches finishes the batches, which import has been interrupted, so their rows are returned to the buffer.
+// See storage.Storage.StaleBatches.
+func (s *Service) recoverStaleBatches() {
+	items, err := s.storage.StaleBatches(time.Now().Add(-StaleBatchTimeout))
+	if err != nil {
+		s.logger.Errorf(`cannot load stale batches: %s`, err)
+		return
+	}
+
+	for _, webhook := range items {
+		var finished []*model.Batch
+		for i := range webhook.Batches {
+			batch := &webhook.Batches[i]
+			if err := s.storage.FinishBatch(batch, 0, errStaleBatch); err != nil {
+				s.logger.Errorf(`cannot finish stale batch "%s": %s`, batch.Id, err)
+				continue
+			}
+			s.logger.Warnf(`recovered stale batch "%s" of "%s", tableId="%s"`, batch.Id, webhook.Hash, batch.TableId)
+			finished = append(finished, batch)
+		}
+		s.triggerAfterImports(webhook, finished)
+	}
+}
+
+// triggerAfterImports checks the trigger of each import of the finished batches, see Service.triggerAfterImport.
+func (s *Service) triggerAfterImports(webhook *model.Webhook, finished []*model.Batch) {
+	if !webhook.Trigger.Enabled() {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, batch := range finished {
+		key := batch.FetchId
+		if key == "" {
+			key = batch.Id
+		}
+		if !seen[key] {
+			seen[key] = true
+			s.triggerAfterImport(webhook, batch)
+		}
+	}
+}
+
+// checkJob returns true, if the job of the batch is finished, and the import error, if the job failed.
+// Loaded jobs are cached in the jobs map.
+// Jobs are loaded without a worker of the import pool, so the polling is not blocked by running imports,
+// but it waits while the project is throttled, see importPool.call.
+func (s *Service) checkJob(apiWithToken *storageapi.Api, webhook *model.Webhook, batch *model.Batch, jobs map[string]*model.Job) (importErr error, finished bool) {
+	jobKey := fmt.Sprintf("%s/%d", apiWithToken.Host(), batch.JobId)
+	var err error
+	job, found := jobs[jobKey]
+	if !found {
+		err = s.callApi(webhook, func() (err error) {
+			job, err = apiWithToken.GetJob(batch.JobId)
+			return err
+		})
+		if err == nil {
+			jobs[jobKey] = job
+		}
+	}
+	switch {
+	case errors.Is(err, errShuttingDown):
+		// The job is tracked after the restart
+		return nil, false
+	case err != nil && time.Since(batch.CreatedAt) > JobTimeout:
+		return fmt.Errorf(`cannot get job "%d": %w`, batch.JobId, err), true
+	case err != nil:
+		s.logger.Warnf(`cannot get job "%d" of batch "%s": %s`, batch.JobId, batch.Id, err)
+		return nil, false
+	case !job.IsFinished() && time.Since(batch.CreatedAt) > JobTimeout:
+		return fmt.Errorf(`timeout while waiting for the storage job "%d" to complete`, job.Id), true
+	case !job.IsFinished():
+		return nil, false
+	}
+	return s.finishJob(apiWithToken, webhook, batch, job), true
+}
+
+// finishJob processes results of the finished job.
+func (s *Service) finishJob(apiWithToken *storageapi.Api, webhook *model.Webhook, batch *model.Batch, job *model.Job) error {
+	if err := job.Err(); err != nil {
+		return err
+	}
+	batch.ImportedRows = job.ImportedRowsCount()
+	if warnings := job.Warnings(); len(warnings) > 0 {
+		s.logger.Warnf(`job "%d" of batch "%s" has warnings: %s`, job.Id, batch.Id, strings.Join(warnings, "; "))
+	}
+
+	// The table has been created from the CSV file, see Service.createTable.
+	// Metadata are added by the first merged batch, its webhook defines settings of the table.
+	if job.OperationName == model.JobOperationTableCreate && batch.MergedTo == "" {
+		s.addTableMetadata(apiWithToken, webhook, batch.TableId)
+	}
+	return nil
+}
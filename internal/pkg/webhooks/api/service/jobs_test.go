@@ -0,0 +1,110 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/filestorage"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckJob(t *testing.T) {
+	t.Parallel()
+	s := &Service{logger: log.NewDebugLogger(), imports: newImportPool(1, 1, 1)}
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	transport.RegisterResponder("GET", `=~/jobs/1$`, httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{"id": 1, "status": "processing"}))
+	transport.RegisterResponder("GET", `=~/jobs/2$`, httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+		"id":            2,
+		"status":        "success",
+		"operationName": "tableImport",
+		"results":       map[string]interface{}{"importedRowsCount": 15},
+	}))
+	transport.RegisterResponder("GET", `=~/jobs/3$`, httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+		"id":     3,
+		"status": "error",
+		"error":  map[string]interface{}{"message": "Some columns are missing in the csv file."},
+	}))
+	transport.RegisterResponder("POST", `=~/tables/in.c-bucket.table/metadata$`, httpmock.NewJsonResponderOrPanic(201, []interface{}{}))
+	transport.RegisterResponder("GET", `=~/jobs/4$`, httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{"id": 4, "status": "success", "operationName": "tableCreate"}))
+	webhook := &model.Webhook{Hash: "hash"}
+	jobs := make(map[string]*model.Job)
+
+	// Job is running
+	batch := &model.Batch{Id: "batch1", TableId: "in.c-bucket.table", JobId: 1, CreatedAt: time.Now()}
+	importErr, finished := s.checkJob(api, webhook, batch, jobs)
+	assert.False(t, finished)
+	assert.NoError(t, importErr)
+
+	// Job is running too long
+	batch.CreatedAt = time.Now().Add(-JobTimeout - time.Minute)
+	importErr, finished = s.checkJob(api, webhook, batch, jobs)
+	assert.True(t, finished)
+	assert.EqualError(t, importErr, `timeout while waiting for the storage job "1" to complete`)
+
+	// Job succeeded
+	batch = &model.Batch{Id: "batch2", TableId: "in.c-bucket.table", JobId: 2, CreatedAt: time.Now()}
+	importErr, finished = s.checkJob(api, webhook, batch, jobs)
+	assert.True(t, finished)
+	assert.NoError(t, importErr)
+	assert.Equal(t, uint64(15), batch.ImportedRows)
+
+	// Job failed
+	batch = &model.Batch{Id: "batch3", TableId: "in.c-bucket.table", JobId: 3, CreatedAt: time.Now()}
+	importErr, finished = s.checkJob(api, webhook, batch, jobs)
+	assert.True(t, finished)
+	assert.EqualError(t, importErr, "job 3 failed: Some columns are missing in the csv file.")
+
+	// Table created, metadata are added
+	batch = &model.Batch{Id: "batch4", TableId: "in.c-bucket.table", JobId: 4, CreatedAt: time.Now()}
+	importErr, finished = s.checkJob(api, webhook, batch, jobs)
+	assert.True(t, finished)
+	assert.NoError(t, importErr)
+	assert.Equal(t, 1, transport.GetCallCountInfo()["POST =~/tables/in.c-bucket.table/metadata$"])
+
+	// Merged batch uses the loaded job, metadata are added only by the first batch
+	batch = &model.Batch{Id: "batch5", TableId: "in.c-bucket.table", JobId: 4, MergedTo: "batch4", CreatedAt: time.Now()}
+	importErr, finished = s.checkJob(api, webhook, batch, jobs)
+	assert.True(t, finished)
+	assert.NoError(t, importErr)
+	assert.Equal(t, 1, transport.GetCallCountInfo()["GET =~/jobs/4$"])
+	assert.Equal(t, 1, transport.GetCallCountInfo()["POST =~/tables/in.c-bucket.table/metadata$"])
+}
+
+func TestStaleBatchTimeout(t *testing.T) {
+	t.Parallel()
+	// The upload of the max batch must finish before the batch is stale
+	assert.Greater(t, StaleBatchTimeout, filestorage.Timeout(uint64(model.MaxSize)))
+}
+
+func TestRecoverStaleBatches(t *testing.T) {
+	t.Parallel()
+	s, _, _ := testService(t)
+	webhook := &model.Webhook{Token: "my-token", TableId: "in.c-bucket.table", Conditions: model.NewConditions()}
+	assert.NoError(t, s.storage.RegisterWebhook(webhook))
+	hash := string(webhook.Hash)
+	_, _, _, err := s.storage.WriteRow(hash, &model.Row{Headers: `{}`, Body: `{"id":1}`})
+	assert.NoError(t, err)
+
+	// The replica has been killed after the fetch, the Storage job has not been created
+	_, batches, err := s.storage.Fetch(hash)
+	assert.NoError(t, err)
+	assert.Len(t, batches, 1)
+	assert.NoError(t, testdb.New(t).Model(batches[0]).Update("created_at", time.Now().Add(-StaleBatchTimeout-time.Minute)).Error)
+
+	// Rows are returned to the buffer
+	s.recoverStaleBatches()
+	count, err := s.storage.CountRows(webhook.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), count)
+	stored, err := s.storage.FetchBatches(batches[0].FetchId)
+	assert.NoError(t, err)
+	if assert.Len(t, stored, 1) {
+		assert.Equal(t, model.BatchStatusFailed, stored[0].Status)
+		assert.Equal(t, errStaleBatch.Error(), stored[0].Error)
+	}
+}
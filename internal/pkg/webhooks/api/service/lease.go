@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const (
+	// LeaseTtl is the time after which a lease without a heartbeat can be acquired by another replica.
+	LeaseTtl = 2 * time.Minute
+	// LeaseHeartbeat is the interval of the lease renewal.
+	LeaseHeartbeat = 30 * time.Second
+)
+
+var errLeaseLost = errors.New("the import lease has been lost")
+
+// leaseOwner returns a unique ID of the replica, it is the owner of the acquired leases, see model.Lease.
+func leaseOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%s", hostname, gonanoid.Must(10))
+}
+
+// acquireLease acquires the lease, it returns false if the lease is held by this or another replica.
+func (s *Service) acquireLease(name string) bool {
+	acquired, err := s.storage.AcquireLease(name, s.leaseOwner, LeaseTtl)
+	if err != nil {
+		s.logger.Errorf(`cannot acquire lease "%s": %s`, name, err)
+		return false
+	}
+	return acquired
+}
+
+// holdLeases renews the acquired leases by a heartbeat, until the returned release function is called.
+// The returned context is cancelled, if a lease cannot be renewed, because the lease can be acquired by another replica,
+// so the work under the lease must be stopped, see Service.importStopped.
+// The release function stops the heartbeat and releases the leases.
+func (s *Service) holdLeases(parent context.Context, names ...string) (ctx context.Context, release func()) {
+	ctx, cancel := context.WithCancel(parent)
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(s.leaseHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, name := range names {
+					if renewed, err := s.storage.RenewLease(name, s.leaseOwner, LeaseTtl); err != nil {
+						s.logger.Errorf(`cannot renew lease "%s", stopping: %s`, name, err)
+						cancel()
+					} else if !renewed {
+						s.logger.Errorf(`lease "%s" has been lost, stopping`, name)
+						cancel()
+					}
+				}
+			}
+		}
+	}()
+
+	return ctx, func() {
+		close(done)
+		wg.Wait()
+		cancel()
+		for _, name := range names {
+			if err := s.storage.ReleaseLease(name, s.leaseOwner); err != nil {
+				s.logger.Errorf(`cannot release lease "%s": %s`, name, err)
+			}
+		}
+	}
+}
+
+// importStopped returns the reason, why the import running with the context must be stopped, or nil, see holdLeases.
+func (s *Service) importStopped(ctx context.Context) error {
+	switch {
+	case ctx.Err() == nil:
+		return nil
+	case s.importCtx.Err() != nil:
+		return errShuttingDown
+	default:
+		return errLeaseLost
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHoldLeases(t *testing.T) {
+	t.Parallel()
+	s, _, _ := testService(t)
+	s.leaseHeartbeat = 10 * time.Millisecond
+	name := "test/" + leaseOwner()
+	assert.True(t, s.acquireLease(name))
+	ctx, release := s.holdLeases(s.importCtx, name)
+
+	// The lease is renewed
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, s.importStopped(ctx))
+
+	// The lease expired and it has been acquired by another replica, the import is stopped
+	assert.NoError(t, s.storage.ReleaseLease(name, s.leaseOwner))
+	acquired, err := s.storage.AcquireLease(name, "other", LeaseTtl)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the context must be cancelled when the lease is lost")
+	}
+	assert.Equal(t, errLeaseLost, s.importStopped(ctx))
+
+	// The lease of the other replica is not released
+	release()
+	acquired, err = s.storage.AcquireLease(name, s.leaseOwner, LeaseTtl)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+	assert.NoError(t, s.storage.ReleaseLease(name, "other"))
+}
+
+func TestImportStoppedOnShutdown(t *testing.T) {
+	t.Parallel()
+	s := newShutdownService()
+	ctx, cancel := context.WithCancel(s.importCtx)
+	defer cancel()
+	assert.NoError(t, s.importStopped(ctx))
+	s.cancelImports()
+	assert.Equal(t, errShuttingDown, s.importStopped(ctx))
+}
+
+func TestFlushImportInProgress(t *testing.T) {
+	t.Parallel()
+	s, _, _ := testService(t)
+	webhook := &model.Webhook{Token: "my-token", TableId: "in.c-bucket.table", Conditions: model.NewConditions()}
+	assert.NoError(t, s.storage.RegisterWebhook(webhook))
+
+	// The import is running in another replica
+	lease := model.ImportLease(webhook.Hash)
+	acquired, err := s.storage.AcquireLease(lease, "other", LeaseTtl)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+
+	_, err = s.Flush(context.Background(), &webhooks.FlushPayload{Hash: string(webhook.Hash)})
+	assert.Equal(t, &webhooks.ImportInProgressError{Message: `Import of the webhook "` + string(webhook.Hash) + `" is in progress.`}, err)
+	assert.NoError(t, s.storage.ReleaseLease(lease, "other"))
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/storage"
+)
+
+// importKey identifies batches, which can be merged to one CSV file and imported by one Storage job.
+// Batches of webhooks of one project are merged, even if they have been registered with different tokens, see importGroup.split.
+// The job uses the table settings of the first webhook of the group,
+// so they are a part of the key and only batches of webhooks with the same settings are merged.
+type importKey struct {
+	storageApiHost   string
+	projectId        uint32
+	branchId         int
+	tableId          string
+	loadType         string
+	primaryKey       string
+	createPrimaryKey bool
+	fixedColumns     bool
+	columnTypes      string
+}
+
+func newImportKey(storageApiHost string, webhook *model.Webhook, batch *model.Batch) importKey {
+	return importKey{
+		storageApiHost:   storageApiHost,
+		projectId:        webhook.ProjectId,
+		branchId:         webhook.BranchId,
+		tableId:          batch.TableId,
+		loadType:         webhook.LoadType,
+		primaryKey:       strings.ToLower(webhook.PrimaryKey),
+		createPrimaryKey: webhook.CreatePrimaryKey,
+		fixedColumns:     webhook.FixedColumns,
+		columnTypes:      json.MustEncodeString(webhook.ColumnTypes, false),
+	}
+}
+
+// project identifies the project, see importPool.
+func (k importKey) project() string {
+	return projectKey(k.storageApiHost, k.projectId)
+}
+
+// projectKey identifies the project in the importPool.
+func projectKey(storageApiHost string, projectId uint32) string {
+	return fmt.Sprintf("%s/%d", storageApiHost, projectId)
+}
+
+// table identifies the table in the project and branch, see importPool.
+func (k importKey) table() string {
+	return fmt.Sprintf("%s/%d/%s", k.project(), k.branchId, k.tableId)
+}
+
+// importGroup contains batches of one or more webhooks imported to the same table by one Storage job.
+// The first webhook defines settings of the table.
+type importGroup struct {
+	key importKey
+	// token imports the group, it is the token of the first webhook, see importGroup.split
+	token    string
+	webhooks []*model.Webhook
+	batches  []*model.Batch
+}
+
+// importGroups groups batches by the importKey, order of the groups and batches is kept.
+type importGroups struct {
+	keys   []importKey
+	groups map[importKey]*importGroup
+}
+
+func newImportGroups() *importGroups {
+	return &importGroups{groups: make(map[importKey]*importGroup)}
+}
+
+func (v *importGroups) add(key importKey, webhook *model.Webhook, batch *model.Batch) {
+	group, found := v.groups[key]
+	if !found {
+		group = &importGroup{key: key}
+		v.groups[key] = group
+		v.keys = append(v.keys, key)
+	}
+	group.add(webhook, batch)
+}
+
+func (v *importGroups) all() []*importGroup {
+	out := make([]*importGroup, 0, len(v.keys))
+	for _, key := range v.keys {
+		out = append(out, v.groups[key])
+	}
+	return out
+}
+
+func (g *importGroup) add(webhook *model.Webhook, batch *model.Batch) {
+	if len(g.batches) > 0 {
+		batch.MergedTo = g.batches[0].Id
+	} else {
+		g.token = webhook.Token
+	}
+	g.webhooks = append(g.webhooks, webhook)
+	g.batches = append(g.batches, batch)
+}
+
+// webhook returns the first webhook, it defines settings of the table.
+func (g *importGroup) webhook() *model.Webhook {
+	return g.webhooks[0]
+}
+
+// split checks tokens of the group, if the webhooks have been registered with different tokens.
+// Batches of webhooks whose token can write to the bucket stay in the group, imported by the first of these tokens.
+// Batches of other webhooks are imported separately by their own tokens, so no rows are imported by a token,
+// which the webhook has not been registered with, unless the own token has the same access.
+func (g *importGroup) split(canWrite func(webhook *model.Webhook) bool) []*importGroup {
+	mixed := false
+	for _, webhook := range g.webhooks {
+		if webhook.Token != g.token {
+			mixed = true
+			break
+		}
+	}
+	if !mixed {
+		return []*importGroup{g}
+	}
+
+	merged := &importGroup{key: g.key}
+	var separate []*importGroup
+	for i, webhook := range g.webhooks {
+		batch := g.batches[i]
+		batch.MergedTo = ""
+		if canWrite(webhook) {
+			merged.add(webhook, batch)
+		} else {
+			group := &importGroup{key: g.key}
+			group.add(webhook, batch)
+			separate = append(separate, group)
+		}
+	}
+	if len(merged.batches) == 0 {
+		return separate
+	}
+	return append([]*importGroup{merged}, separate...)
+}
+
+// target returns the merged batch: columns of all batches, column names are case-insensitive, and the total size.
+func (g *importGroup) target() *model.Batch {
+	target := &model.Batch{Id: g.batches[0].Id, TableId: g.batches[0].TableId}
+	seen := make(map[string]bool)
+	for _, batch := range g.batches {
+		target.Size += batch.Size
+		for _, column := range batch.Columns {
+			if !seen[strings.ToLower(column)] {
+				seen[strings.ToLower(column)] = true
+				target.Columns = append(target.Columns, column)
+			}
+		}
+	}
+	return target
+}
+
+// columnMapper reorders records from the batch columns to the target columns.
+// Target columns, which are not present in the batch, are written empty.
+type columnMapper struct {
+	writer  storage.RowWriter
+	indexes []int
+}
+
+func newColumnMapper(writer storage.RowWriter, columns, target []string) *columnMapper {
+	indexOf := make(map[string]int)
+	for i, column := range columns {
+		indexOf[strings.ToLower(column)] = i
+	}
+	indexes := make([]int, len(target))
+	for i, column := range target {
+		if index, found := indexOf[strings.ToLower(column)]; found {
+			indexes[i] = index
+		} else {
+			indexes[i] = -1
+		}
+	}
+	return &columnMapper{writer: writer, indexes: indexes}
+}
+
+func (m *columnMapper) Write(record []string) error {
+	out := make([]string, len(m.indexes))
+	for i, index := range m.indexes {
+		if index >= 0 && index < len(record) {
+			out[i] = record[index]
+		}
+	}
+	return m.writer.Write(out)
+}
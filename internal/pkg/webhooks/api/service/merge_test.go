@@ -0,0 +1,126 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordsWriter struct {
+	records [][]string
+}
+
+func (w *recordsWriter) Write(record []string) error {
+	w.records = append(w.records, record)
+	return nil
+}
+
+func TestImportGroups(t *testing.T) {
+	t.Parallel()
+	webhook1 := &model.Webhook{Hash: "hash1"}
+	webhook2 := &model.Webhook{Hash: "hash2"}
+	keyA := importKey{storageApiHost: "connection.keboola.com", projectId: 123, tableId: "in.c-bucket.a", loadType: model.LoadTypeAppend}
+	keyB := importKey{storageApiHost: "connection.keboola.com", projectId: 123, tableId: "in.c-bucket.b", loadType: model.LoadTypeAppend}
+
+	groups := newImportGroups()
+	groups.add(keyA, webhook1, &model.Batch{Id: "batch1", TableId: "in.c-bucket.a", Size: 10, Columns: []string{"id", "body"}})
+	groups.add(keyB, webhook1, &model.Batch{Id: "batch2", TableId: "in.c-bucket.b", Size: 20, Columns: []string{"id", "body"}})
+	groups.add(keyA, webhook2, &model.Batch{Id: "batch3", TableId: "in.c-bucket.a", Size: 30, Columns: []string{"ID", "region", "body"}})
+
+	all := groups.all()
+	assert.Len(t, all, 2)
+	assert.Equal(t, webhook1, all[0].webhook())
+	assert.Equal(t, []*model.Webhook{webhook1, webhook2}, all[0].webhooks)
+	assert.Equal(t, "", all[0].batches[0].MergedTo)
+	assert.Equal(t, "batch1", all[0].batches[1].MergedTo)
+	assert.Equal(t, "", all[1].batches[0].MergedTo)
+
+	target := all[0].target()
+	assert.Equal(t, "in.c-bucket.a", target.TableId)
+	assert.Equal(t, uint64(40), target.Size)
+	assert.Equal(t, []string{"id", "body", "region"}, target.Columns)
+}
+
+func TestNewImportKey(t *testing.T) {
+	t.Parallel()
+	host := "connection.keboola.com"
+	batch := &model.Batch{TableId: "in.c-bucket.table"}
+	webhookA := &model.Webhook{Hash: "hashA", ProjectId: 123, Token: "token-a", LoadType: model.LoadTypeUpsert, PrimaryKey: "id"}
+	webhookB := &model.Webhook{Hash: "hashB", ProjectId: 123, Token: "token-b", LoadType: model.LoadTypeUpsert, PrimaryKey: "id"}
+	webhookC := &model.Webhook{Hash: "hashC", ProjectId: 123, Token: "token-a", LoadType: model.LoadTypeUpsert, PrimaryKey: "ID"}
+	webhookD := &model.Webhook{Hash: "hashD", ProjectId: 123, Token: "token-a", LoadType: model.LoadTypeUpsert, PrimaryKey: "id", FixedColumns: true}
+	webhookE := &model.Webhook{Hash: "hashE", ProjectId: 123, Token: "token-a", LoadType: model.LoadTypeUpsert, PrimaryKey: "id", ColumnTypes: model.ColumnTypes{{Name: "id", Type: "INTEGER"}}}
+
+	// Webhooks of the project with different tokens are merged
+	groups := newImportGroups()
+	for _, webhook := range []*model.Webhook{webhookA, webhookB, webhookC, webhookD, webhookE} {
+		groups.add(newImportKey(host, webhook, batch), webhook, &model.Batch{Id: "batch" + string(webhook.Hash), TableId: batch.TableId})
+	}
+	all := groups.all()
+	assert.Len(t, all, 3)
+	assert.Equal(t, []*model.Webhook{webhookA, webhookB, webhookC}, all[0].webhooks)
+	assert.Equal(t, "token-a", all[0].token)
+
+	// Different table settings are not merged
+	assert.Equal(t, []*model.Webhook{webhookD}, all[1].webhooks)
+	assert.Equal(t, []*model.Webhook{webhookE}, all[2].webhooks)
+
+	// Pool budgets are shared by the project and the table
+	assert.Equal(t, all[0].key.project(), all[1].key.project())
+	assert.Equal(t, all[0].key.table(), all[1].key.table())
+
+	// Another project is not merged
+	webhookF := &model.Webhook{Hash: "hashF", ProjectId: 456, Token: "token-f", LoadType: model.LoadTypeUpsert, PrimaryKey: "id"}
+	assert.NotEqual(t, newImportKey(host, webhookA, batch), newImportKey(host, webhookF, batch))
+}
+
+func TestImportGroupSplit(t *testing.T) {
+	t.Parallel()
+	key := importKey{storageApiHost: "connection.keboola.com", projectId: 123, tableId: "in.c-bucket.table"}
+	webhookA := &model.Webhook{Hash: "hashA", Token: "token-read"}
+	webhookB := &model.Webhook{Hash: "hashB", Token: "token-write"}
+	webhookC := &model.Webhook{Hash: "hashC", Token: "token-read"}
+	webhookD := &model.Webhook{Hash: "hashD", Token: "token-manage"}
+	canWrite := func(webhook *model.Webhook) bool {
+		return webhook.Token != "token-read"
+	}
+
+	// The same token, no check
+	group := &importGroup{key: key}
+	group.add(webhookA, &model.Batch{Id: "batch1"})
+	group.add(webhookC, &model.Batch{Id: "batch2"})
+	assert.Equal(t, []*importGroup{group}, group.split(func(webhook *model.Webhook) bool {
+		assert.Fail(t, "unexpected check")
+		return false
+	}))
+
+	// The first token without the access is replaced, webhooks without the access are imported separately
+	group = &importGroup{key: key}
+	group.add(webhookA, &model.Batch{Id: "batch1"})
+	group.add(webhookB, &model.Batch{Id: "batch2"})
+	group.add(webhookC, &model.Batch{Id: "batch3"})
+	group.add(webhookD, &model.Batch{Id: "batch4"})
+	split := group.split(canWrite)
+	assert.Len(t, split, 3)
+	assert.Equal(t, "token-write", split[0].token)
+	assert.Equal(t, []*model.Webhook{webhookB, webhookD}, split[0].webhooks)
+	assert.Equal(t, "", split[0].batches[0].MergedTo)
+	assert.Equal(t, "batch2", split[0].batches[1].MergedTo)
+	assert.Equal(t, "token-read", split[1].token)
+	assert.Equal(t, []*model.Webhook{webhookA}, split[1].webhooks)
+	assert.Equal(t, "", split[1].batches[0].MergedTo)
+	assert.Equal(t, []*model.Webhook{webhookC}, split[2].webhooks)
+	assert.Equal(t, "", split[2].batches[0].MergedTo)
+	for _, g := range split {
+		assert.Equal(t, key, g.key)
+	}
+}
+
+func TestColumnMapper(t *testing.T) {
+	t.Parallel()
+	w := &recordsWriter{}
+	mapper := newColumnMapper(w, []string{"ID", "region", "body"}, []string{"id", "body", "region", "extra"})
+	assert.NoError(t, mapper.Write([]string{"1", "eu", "foo"}))
+	assert.Equal(t, [][]string{{"1", "foo", "eu", ""}}, w.records)
+}
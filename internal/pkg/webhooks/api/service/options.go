@@ -0,0 +1,189 @@
+package service
+
+import (
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+)
+
+// webhookOptions are the settings shared by the register and the update payload.
+// A nil value means the option is not sent and the current setting is kept.
+type webhookOptions struct {
+	Conditions       *webhooks.Conditions
+	Methods          []string
+	Response         *webhooks.ResponseType
+	BodyFormat       *webhooks.BodyFormat
+	CloudEvents      *bool
+	Schema           *string
+	Idempotency      *webhooks.Idempotency
+	EventTime        *webhooks.EventTime
+	Routes           []*webhooks.Route
+	DropRules        []*webhooks.DropRule
+	SampleRate       *float64
+	Flatten          *bool
+	AddColumns       *bool
+	PrimaryKey       []string
+	LoadType         *webhooks.LoadType
+	CreatePrimaryKey *bool
+	ColumnTypes      []*webhooks.ColumnType
+	Description      *string
+	Trigger          *webhooks.Trigger
+	BranchID         *int
+}
+
+func registerOptions(payload *webhooks.RegisterPayload) *webhookOptions {
+	return &webhookOptions{
+		Conditions:       payload.Conditions,
+		Methods:          payload.Methods,
+		Response:         payload.Response,
+		BodyFormat:       payload.BodyFormat,
+		CloudEvents:      payload.CloudEvents,
+		Schema:           payload.Schema,
+		Idempotency:      payload.Idempotency,
+		EventTime:        payload.EventTime,
+		Routes:           payload.Routes,
+		DropRules:        payload.DropRules,
+		SampleRate:       payload.SampleRate,
+		Flatten:          payload.Flatten,
+		AddColumns:       payload.AddColumns,
+		PrimaryKey:       payload.PrimaryKey,
+		LoadType:         payload.LoadType,
+		CreatePrimaryKey: payload.CreatePrimaryKey,
+		ColumnTypes:      payload.ColumnTypes,
+		Description:      payload.Description,
+		Trigger:          payload.Trigger,
+		BranchID:         payload.BranchID,
+	}
+}
+
+func updateOptions(payload *webhooks.UpdatePayload) *webhookOptions {
+	return &webhookOptions{
+		Conditions:       payload.Conditions,
+		Methods:          payload.Methods,
+		Response:         payload.Response,
+		BodyFormat:       payload.BodyFormat,
+		CloudEvents:      payload.CloudEvents,
+		Schema:           payload.Schema,
+		Idempotency:      payload.Idempotency,
+		EventTime:        payload.EventTime,
+		Routes:           payload.Routes,
+		DropRules:        payload.DropRules,
+		SampleRate:       payload.SampleRate,
+		Flatten:          payload.Flatten,
+		AddColumns:       payload.AddColumns,
+		PrimaryKey:       payload.PrimaryKey,
+		LoadType:         payload.LoadType,
+		CreatePrimaryKey: payload.CreatePrimaryKey,
+		ColumnTypes:      payload.ColumnTypes,
+		Description:      payload.Description,
+		Trigger:          payload.Trigger,
+		BranchID:         payload.BranchID,
+	}
+}
+
+// validateOptions checks the options which need the Storage API.
+// It is called before the webhook is locked, the token and the stack of the webhook cannot be changed.
+func (s *Service) validateOptions(webhook *model.Webhook, opts *webhookOptions) error {
+	if opts.BranchID != nil {
+		if err := s.validateBranch(webhook, *opts.BranchID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyOptions sets the sent options to the webhook.
+func applyOptions(webhook *model.Webhook, opts *webhookOptions) error {
+	if opts.Conditions != nil {
+		conditions, err := conditionsFromPayload(opts.Conditions)
+		if err != nil {
+			return err
+		}
+		webhook.Conditions = conditions
+	}
+	if opts.Methods != nil {
+		if err := webhook.SetMethods(opts.Methods); err != nil {
+			return err
+		}
+	}
+	if opts.Response != nil {
+		if err := webhook.SetResponse(string(*opts.Response)); err != nil {
+			return err
+		}
+	}
+	if opts.BodyFormat != nil {
+		if err := webhook.SetBodyFormat(string(*opts.BodyFormat)); err != nil {
+			return err
+		}
+	}
+	if opts.CloudEvents != nil {
+		webhook.CloudEvents = *opts.CloudEvents
+	}
+	if opts.Schema != nil {
+		if err := setSchema(webhook, *opts.Schema); err != nil {
+			return err
+		}
+	}
+	if opts.Idempotency != nil {
+		if err := setIdempotency(webhook, opts.Idempotency); err != nil {
+			return err
+		}
+	}
+	if opts.EventTime != nil {
+		if err := setEventTime(webhook, opts.EventTime); err != nil {
+			return err
+		}
+	}
+	if opts.Routes != nil {
+		if err := setRoutes(webhook, opts.Routes); err != nil {
+			return err
+		}
+	}
+	if opts.DropRules != nil {
+		if err := setDropRules(webhook, opts.DropRules); err != nil {
+			return err
+		}
+	}
+	if opts.SampleRate != nil {
+		if err := webhook.SetSampleRate(*opts.SampleRate); err != nil {
+			return err
+		}
+	}
+	if opts.Flatten != nil {
+		webhook.Flatten = *opts.Flatten
+	}
+	if opts.AddColumns != nil {
+		webhook.FixedColumns = !*opts.AddColumns
+	}
+	if opts.PrimaryKey != nil {
+		if err := webhook.SetPrimaryKey(opts.PrimaryKey); err != nil {
+			return err
+		}
+	}
+	if opts.LoadType != nil {
+		if err := webhook.SetLoadType(string(*opts.LoadType)); err != nil {
+			return err
+		}
+	}
+	if opts.CreatePrimaryKey != nil {
+		webhook.CreatePrimaryKey = *opts.CreatePrimaryKey
+	}
+	if opts.ColumnTypes != nil {
+		columnTypes, err := model.NewColumnTypes(opts.ColumnTypes)
+		if err != nil {
+			return err
+		}
+		webhook.ColumnTypes = columnTypes
+	}
+	if opts.Description != nil {
+		webhook.Description = *opts.Description
+	}
+	if opts.Trigger != nil {
+		if err := setTrigger(webhook, opts.Trigger); err != nil {
+			return err
+		}
+	}
+	if opts.BranchID != nil {
+		webhook.BranchId = *opts.BranchID
+	}
+	return webhook.ValidateLoad()
+}
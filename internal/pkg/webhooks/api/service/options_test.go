@@ -0,0 +1,42 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyOptions(t *testing.T) {
+	t.Parallel()
+	count := uint(100)
+	description := "Orders"
+	webhook := &model.Webhook{
+		Conditions: model.NewConditions(),
+		Methods:    http.MethodPost,
+		Response:   model.ResponseJson,
+		BodyFormat: model.BodyFormatAuto,
+		SampleRate: model.DefaultSampleRate,
+		LoadType:   model.LoadTypeAppend,
+	}
+
+	// The sent options are set
+	assert.NoError(t, applyOptions(webhook, updateOptions(&webhooks.UpdatePayload{
+		Conditions:  &webhooks.Conditions{Count: &count},
+		Description: &description,
+	})))
+	assert.Equal(t, &count, webhook.Conditions.Count)
+	assert.Equal(t, "Orders", webhook.Description)
+
+	// The options not sent are kept
+	flatten := true
+	assert.NoError(t, applyOptions(webhook, updateOptions(&webhooks.UpdatePayload{Flatten: &flatten})))
+	assert.Equal(t, &count, webhook.Conditions.Count)
+	assert.Equal(t, "Orders", webhook.Description)
+	assert.True(t, webhook.Flatten)
+
+	// An invalid option is rejected
+	assert.Error(t, applyOptions(webhook, registerOptions(&webhooks.RegisterPayload{Methods: []string{"DELETE"}})))
+}
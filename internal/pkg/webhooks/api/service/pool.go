@@ -0,0 +1,274 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/env"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
+)
+
+// Default limits of the importPool, they can be overridden by ENVs, see importPoolFromEnvs.
+const (
+	// ImportWorkers is the max number of imports running in parallel.
+	ImportWorkers = 10
+	// ImportsPerProject is the max number of imports of one project running in parallel.
+	ImportsPerProject = 3
+	// ImportsPerTable is the max number of imports to one table running in parallel.
+	ImportsPerTable = 1
+	// ThrottleRetries is the max number of retries of a throttled API call.
+	ThrottleRetries = 3
+	// ThrottleDelay is used, if a throttled response has no "Retry-After" header.
+	ThrottleDelay = 30 * time.Second
+)
+
+// importTask is one import run by the importPool.
+type importTask struct {
+	project string
+	table   string
+	// run is called by a worker, throttled API calls are repeated by importPool.call
+	run func() error
+	// done is called with the error of the run
+	done func(err error)
+}
+
+// importPool runs imports by a limited number of workers, with concurrency limits per project and per table.
+// Projects are scheduled in the round-robin order, so a project with many webhooks cannot block the others.
+// If Storage API throttles a call, the project is paused for the requested time and the call is repeated, see importPool.call.
+type importPool struct {
+	lock              *sync.Mutex
+	workers           int
+	perProject        int
+	perTable          int
+	throttleDelay     time.Duration
+	running           int
+	runningPerProject map[string]int
+	runningPerTable   map[string]int
+	pausedUntil       map[string]time.Time
+	queues            map[string][]*importTask
+	projects          []string
+	next              int
+	// stopErr is set on shutdown, queued and new tasks are done with the error
+	stopErr error
+	// stopped is closed on shutdown, it interrupts waiting for a throttled call
+	stopped chan struct{}
+}
+
+// importPoolFromEnvs creates the pool, the default limits can be overridden by ENVs:
+// IMPORT_WORKERS, IMPORTS_PER_PROJECT, IMPORTS_PER_TABLE and IMPORT_THROTTLE_DELAY, for example "30s".
+func importPoolFromEnvs(envs *env.Map) (*importPool, error) {
+	limits := map[string]int{"IMPORT_WORKERS": ImportWorkers, "IMPORTS_PER_PROJECT": ImportsPerProject, "IMPORTS_PER_TABLE": ImportsPerTable}
+	for name := range limits {
+		if value := envs.Get(name); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				return nil, fmt.Errorf(`ENV "%s" must be a positive integer, found "%s"`, name, value)
+			}
+			limits[name] = limit
+		}
+	}
+
+	pool := newImportPool(limits["IMPORT_WORKERS"], limits["IMPORTS_PER_PROJECT"], limits["IMPORTS_PER_TABLE"])
+	if value := envs.Get("IMPORT_THROTTLE_DELAY"); value != "" {
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay <= 0 {
+			return nil, fmt.Errorf(`ENV "IMPORT_THROTTLE_DELAY" must be a positive duration, found "%s"`, value)
+		}
+		pool.throttleDelay = delay
+	}
+	return pool, nil
+}
+
+func newImportPool(workers, perProject, perTable int) *importPool {
+	return &importPool{
+		lock:              &sync.Mutex{},
+		workers:           workers,
+		perProject:        perProject,
+		perTable:          perTable,
+		throttleDelay:     ThrottleDelay,
+		runningPerProject: make(map[string]int),
+		runningPerTable:   make(map[string]int),
+		pausedUntil:       make(map[string]time.Time),
+		queues:            make(map[string][]*importTask),
+		stopped:           make(chan struct{}),
+	}
+}
+
+// submit queues the task, it is started when a worker and the limits allow it.
+func (p *importPool) submit(task *importTask) {
+	p.lock.Lock()
+	if p.stopErr != nil {
+		p.lock.Unlock()
+		task.done(p.stopErr)
+		return
+	}
+	p.enqueue(task, false)
+	p.dispatch()
+	p.lock.Unlock()
+}
+
+// call runs one API call of a running task, or of the job tracker, see Service.checkJob.
+// The call doesn't use a worker, but it waits while the project is paused.
+// A throttled call pauses the project, so no other task of the project is started, and it is repeated after the delay.
+// The call is not repeated after ThrottleRetries or on shutdown.
+func (p *importPool) call(project string, fn func() error) error {
+	for retries := 0; ; retries++ {
+		p.lock.Lock()
+		wait := time.Until(p.pausedUntil[project])
+		p.lock.Unlock()
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-p.stopped:
+				return p.stopErr
+			}
+		}
+
+		err := fn()
+		delay, ok := throttled(err, p.throttleDelay)
+		if !ok || retries >= ThrottleRetries {
+			return err
+		}
+		p.pause(project, delay)
+	}
+}
+
+// pause pauses starting of the project tasks, the queued tasks are dispatched after the delay.
+func (p *importPool) pause(project string, delay time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if until := time.Now().Add(delay); until.After(p.pausedUntil[project]) {
+		p.pausedUntil[project] = until
+	}
+	time.AfterFunc(delay, func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		p.dispatch()
+	})
+}
+
+// stop stops scheduling of the tasks, the queued tasks are done with the error.
+// Running tasks are not affected, but a throttled call is not repeated.
+func (p *importPool) stop(err error) {
+	p.lock.Lock()
+	if p.stopErr != nil {
+		p.lock.Unlock()
+		return
+	}
+	p.stopErr = err
+	close(p.stopped)
+	var queued []*importTask
+	for _, project := range p.projects {
+		queued = append(queued, p.queues[project]...)
+	}
+	p.projects = nil
+	p.queues = make(map[string][]*importTask)
+	p.next = 0
+	p.lock.Unlock()
+
+	for _, task := range queued {
+		task.done(err)
+	}
+}
+
+func (p *importPool) enqueue(task *importTask, front bool) {
+	if _, found := p.queues[task.project]; !found {
+		p.projects = append(p.projects, task.project)
+	}
+	if front {
+		p.queues[task.project] = append([]*importTask{task}, p.queues[task.project]...)
+	} else {
+		p.queues[task.project] = append(p.queues[task.project], task)
+	}
+}
+
+// dispatch starts queued tasks while there is a free worker, the lock must be held.
+func (p *importPool) dispatch() {
+	for p.running < p.workers && p.stopErr == nil {
+		task := p.pick()
+		if task == nil {
+			return
+		}
+		p.running++
+		p.runningPerProject[task.project]++
+		p.runningPerTable[task.table]++
+		go p.execute(task)
+	}
+}
+
+// pick removes the first task, which can be started, from the queue of the next project in the round-robin order.
+func (p *importPool) pick() *importTask {
+	now := time.Now()
+	for i := 0; i < len(p.projects); i++ {
+		index := (p.next + i) % len(p.projects)
+		project := p.projects[index]
+		if until, found := p.pausedUntil[project]; found {
+			if now.Before(until) {
+				continue
+			}
+			delete(p.pausedUntil, project)
+		}
+		if p.runningPerProject[project] >= p.perProject {
+			continue
+		}
+
+		queue := p.queues[project]
+		for j, task := range queue {
+			if p.runningPerTable[task.table] >= p.perTable {
+				continue
+			}
+
+			// Remove the task, remove the project if it has no queued task
+			queue = append(queue[:j:j], queue[j+1:]...)
+			if len(queue) > 0 {
+				p.queues[project] = queue
+				p.next = index + 1
+			} else {
+				delete(p.queues, project)
+				p.projects = append(p.projects[:index:index], p.projects[index+1:]...)
+				p.next = index
+			}
+			if len(p.projects) > 0 {
+				p.next %= len(p.projects)
+			} else {
+				p.next = 0
+			}
+			return task
+		}
+	}
+	return nil
+}
+
+func (p *importPool) execute(task *importTask) {
+	err := task.run()
+
+	p.lock.Lock()
+	p.running--
+	p.runningPerProject[task.project]--
+	if p.runningPerProject[task.project] == 0 {
+		delete(p.runningPerProject, task.project)
+	}
+	p.runningPerTable[task.table]--
+	if p.runningPerTable[task.table] == 0 {
+		delete(p.runningPerTable, task.table)
+	}
+	p.dispatch()
+	p.lock.Unlock()
+
+	task.done(err)
+}
+
+// throttled returns the delay, if the error is caused by a throttled API request, see client.IsThrottled.
+func throttled(err error, defaultDelay time.Duration) (time.Duration, bool) {
+	var errWithResponse client.ErrorWithResponse
+	if err == nil || !errors.As(err, &errWithResponse) || !errWithResponse.IsThrottled() {
+		return 0, false
+	}
+	if delay := errWithResponse.RetryAfter(); delay > 0 {
+		return delay, true
+	}
+	return defaultDelay, true
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/env"
+	"github.com/stretchr/testify/assert"
+)
+
+type throttledErr struct {
+	retryAfter time.Duration
+}
+
+func (e *throttledErr) Error() string                 { return "too many requests" }
+func (e *throttledErr) SetResponse(_ *resty.Response) {}
+func (e *throttledErr) HttpStatus() int               { return 429 }
+func (e *throttledErr) IsBadRequest() bool            { return false }
+func (e *throttledErr) IsUnauthorized() bool          { return false }
+func (e *throttledErr) IsForbidden() bool             { return false }
+func (e *throttledErr) IsNotFound() bool              { return false }
+func (e *throttledErr) IsThrottled() bool             { return true }
+func (e *throttledErr) RetryAfter() time.Duration     { return e.retryAfter }
+
+// poolRecorder records the order of started tasks and the max concurrency.
+type poolRecorder struct {
+	lock       sync.Mutex
+	started    []string
+	running    map[string]int
+	maxRunning map[string]int
+}
+
+func newPoolRecorder() *poolRecorder {
+	return &poolRecorder{running: make(map[string]int), maxRunning: make(map[string]int)}
+}
+
+func (r *poolRecorder) task(wg *sync.WaitGroup, project, table, name string) *importTask {
+	wg.Add(1)
+	return &importTask{
+		project: project,
+		table:   table,
+		run: func() error {
+			r.lock.Lock()
+			r.started = append(r.started, name)
+			for _, key := range []string{"all", project, table} {
+				r.running[key]++
+				if r.running[key] > r.maxRunning[key] {
+					r.maxRunning[key] = r.running[key]
+				}
+			}
+			r.lock.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			r.lock.Lock()
+			for _, key := range []string{"all", project, table} {
+				r.running[key]--
+			}
+			r.lock.Unlock()
+			return nil
+		},
+		done: func(err error) {
+			wg.Done()
+		},
+	}
+}
+
+func TestImportPoolLimits(t *testing.T) {
+	t.Parallel()
+	pool := newImportPool(4, 2, 1)
+	recorder := newPoolRecorder()
+	wg := &sync.WaitGroup{}
+
+	// Block the pool, so all tasks are queued before the scheduling starts
+	pool.lock.Lock()
+	for i := 0; i < 6; i++ {
+		pool.enqueue(recorder.task(wg, "p1", fmt.Sprintf("p1/t%d", i%3), fmt.Sprintf("p1-%d", i)), false)
+	}
+	for i := 0; i < 2; i++ {
+		pool.enqueue(recorder.task(wg, "p2", "p2/t", fmt.Sprintf("p2-%d", i)), false)
+	}
+	pool.dispatch()
+	pool.lock.Unlock()
+	wg.Wait()
+
+	assert.Len(t, recorder.started, 8)
+	assert.LessOrEqual(t, recorder.maxRunning["all"], 4)
+	assert.Equal(t, 2, recorder.maxRunning["p1"])
+	assert.Equal(t, 1, recorder.maxRunning["p2"])
+	for _, table := range []string{"p1/t0", "p1/t1", "p1/t2", "p2/t"} {
+		assert.Equal(t, 1, recorder.maxRunning[table], table)
+	}
+}
+
+func TestImportPoolRoundRobin(t *testing.T) {
+	t.Parallel()
+	pool := newImportPool(10, 10, 10)
+	for _, item := range [][]string{{"p1", "a"}, {"p1", "b"}, {"p1", "c"}, {"p2", "d"}, {"p3", "e"}} {
+		pool.enqueue(&importTask{project: item[0], table: item[1]}, false)
+	}
+
+	var tables []string
+	for task := pool.pick(); task != nil; task = pool.pick() {
+		tables = append(tables, task.table)
+	}
+	assert.Equal(t, []string{"a", "d", "e", "b", "c"}, tables)
+	assert.Empty(t, pool.projects)
+	assert.Empty(t, pool.queues)
+}
+
+func TestImportPoolThrottled(t *testing.T) {
+	t.Parallel()
+	pool := newImportPool(4, 2, 1)
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	// Only the throttled call is repeated, not the whole task
+	runs, attempts := 0, 0
+	var result error
+	var otherStartedAt time.Time
+	start := time.Now()
+	pool.submit(&importTask{
+		project: "p1",
+		table:   "p1/t1",
+		run: func() error {
+			runs++
+			return pool.call("p1", func() error {
+				attempts++
+				if attempts == 1 {
+					// The project is paused, the next task waits
+					time.AfterFunc(5*time.Millisecond, func() {
+						pool.submit(&importTask{
+							project: "p1",
+							table:   "p1/t2",
+							run: func() error {
+								otherStartedAt = time.Now()
+								return nil
+							},
+							done: func(err error) { wg.Done() },
+						})
+					})
+				}
+				if attempts < 3 {
+					return fmt.Errorf("cannot import: %w", &throttledErr{retryAfter: 20 * time.Millisecond})
+				}
+				return nil
+			})
+		},
+		done: func(err error) {
+			result = err
+			wg.Done()
+		},
+	})
+	wg.Wait()
+
+	assert.NoError(t, result)
+	assert.Equal(t, 1, runs)
+	assert.Equal(t, 3, attempts)
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	assert.GreaterOrEqual(t, otherStartedAt.Sub(start), 20*time.Millisecond)
+}
+
+func TestImportPoolThrottledRetries(t *testing.T) {
+	t.Parallel()
+	pool := newImportPool(4, 2, 1)
+	pool.throttleDelay = time.Millisecond
+
+	attempts := 0
+	err := pool.call("p1", func() error {
+		attempts++
+		return &throttledErr{}
+	})
+	assert.EqualError(t, err, "too many requests")
+	assert.Equal(t, 1+ThrottleRetries, attempts)
+}
+
+func TestImportPoolThrottledStop(t *testing.T) {
+	t.Parallel()
+	pool := newImportPool(4, 2, 1)
+	stopErr := errors.New("stopped")
+
+	// The throttled call is not repeated on shutdown
+	attempts := 0
+	err := pool.call("p1", func() error {
+		attempts++
+		pool.stop(stopErr)
+		return &throttledErr{retryAfter: time.Minute}
+	})
+	assert.Equal(t, stopErr, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestImportPoolFromEnvs(t *testing.T) {
+	t.Parallel()
+	pool, err := importPoolFromEnvs(env.Empty())
+	assert.NoError(t, err)
+	assert.Equal(t, ImportWorkers, pool.workers)
+	assert.Equal(t, ImportsPerProject, pool.perProject)
+	assert.Equal(t, ImportsPerTable, pool.perTable)
+	assert.Equal(t, ThrottleDelay, pool.throttleDelay)
+
+	pool, err = importPoolFromEnvs(env.FromMap(map[string]string{
+		"IMPORT_WORKERS":        "20",
+		"IMPORTS_PER_PROJECT":   "5",
+		"IMPORTS_PER_TABLE":     "2",
+		"IMPORT_THROTTLE_DELAY": "1m",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 20, pool.workers)
+	assert.Equal(t, 5, pool.perProject)
+	assert.Equal(t, 2, pool.perTable)
+	assert.Equal(t, time.Minute, pool.throttleDelay)
+
+	_, err = importPoolFromEnvs(env.FromMap(map[string]string{"IMPORTS_PER_PROJECT": "0"}))
+	assert.EqualError(t, err, `ENV "IMPORTS_PER_PROJECT" must be a positive integer, found "0"`)
+	_, err = importPoolFromEnvs(env.FromMap(map[string]string{"IMPORT_THROTTLE_DELAY": "abc"}))
+	assert.EqualError(t, err, `ENV "IMPORT_THROTTLE_DELAY" must be a positive duration, found "abc"`)
+}
+
+func TestThrottled(t *testing.T) {
+	t.Parallel()
+	_, ok := throttled(nil, time.Second)
+	assert.False(t, ok)
+	_, ok = throttled(errors.New("some error"), time.Second)
+	assert.False(t, ok)
+	delay, ok := throttled(&throttledErr{}, time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, delay)
+	delay, ok = throttled(fmt.Errorf("wrapped: %w", &throttledErr{retryAfter: time.Minute}), time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, delay)
+}
+
+func TestImportPoolStop(t *testing.T) {
+	t.Parallel()
+	pool := newImportPool(1, 1, 1)
+	stopErr := errors.New("stopped")
+	release := make(chan struct{})
+	started := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(3)
+
+	results := make([]error, 3)
+	var lock sync.Mutex
+	task := func(i int, run func() error) *importTask {
+		return &importTask{
+			project: "p1",
+			table:   "p1/t",
+			run:     run,
+			done: func(err error) {
+				lock.Lock()
+				results[i] = err
+				lock.Unlock()
+				wg.Done()
+			},
+		}
+	}
+
+	// The first task is running, the second one is queued
+	pool.submit(task(0, func() error {
+		close(started)
+		<-release
+		return nil
+	}))
+	<-started
+	pool.submit(task(1, func() error { return nil }))
+	pool.stop(stopErr)
+
+	// A new task is not started after the stop
+	pool.submit(task(2, func() error { return nil }))
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, []error{nil, stopErr, stopErr}, results)
+	assert.Empty(t, pool.queues)
+}
+
+func TestImportPoolCallNotBlocked(t *testing.T) {
+	t.Parallel()
+	pool := newImportPool(1, 1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	// The project budget and the only worker are used by an import
+	pool.submit(&importTask{
+		project: "p1",
+		table:   "p1/t",
+		run: func() error {
+			close(started)
+			<-release
+			return nil
+		},
+		done: func(err error) { wg.Done() },
+	})
+	<-started
+
+	// The call doesn't wait for the import
+	assert.EqualError(t, pool.call("p1", func() error { return errors.New("some error") }), "some error")
+
+	close(release)
+	wg.Wait()
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+)
+
+// pixel is a transparent 1x1 GIF image.
+var pixel = []byte{ // nolint: gochecknoglobals
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// Response allows the service to replace the response body encoded by goa.
+// It is stored in the request context under ResponseCtxKey.
+type Response struct {
+	ContentType string
+	Body        []byte
+}
+
+func (r *Response) IsReplaced() bool {
+	return r.Body != nil
+}
+
+func setPixelResponse(ctx context.Context) {
+	if r, ok := ctx.Value(ResponseCtxKey).(*Response); ok {
+		r.ContentType = "image/gif"
+		r.Body = pixel
+	}
+}
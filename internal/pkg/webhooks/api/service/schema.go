@@ -0,0 +1,44 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/payload"
+)
+
+// schemaCache holds the compiled JSON Schema of each webhook, so the schema is not compiled on each request.
+// The entry is replaced, if the schema of the webhook has been changed.
+type schemaCache struct {
+	lock  *sync.RWMutex
+	items map[model.WebhookHash]cachedSchema
+}
+
+type cachedSchema struct {
+	source   string
+	compiled *payload.Schema
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{lock: &sync.RWMutex{}, items: make(map[model.WebhookHash]cachedSchema)}
+}
+
+// get returns the compiled schema of the webhook.
+func (c *schemaCache) get(webhook *model.Webhook) (*payload.Schema, error) {
+	c.lock.RLock()
+	item, found := c.items[webhook.Hash]
+	c.lock.RUnlock()
+	if found && item.source == webhook.Schema {
+		return item.compiled, nil
+	}
+
+	compiled, err := payload.CompileSchema(webhook.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.items[webhook.Hash] = cachedSchema{source: webhook.Schema, compiled: compiled}
+	return compiled, nil
+}
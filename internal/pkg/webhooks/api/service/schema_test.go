@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaCache(t *testing.T) {
+	t.Parallel()
+	cache := newSchemaCache()
+	webhook := &model.Webhook{Hash: "hash1", Schema: `{"type": "object"}`}
+
+	// The schema is compiled once
+	schema1, err := cache.get(webhook)
+	assert.NoError(t, err)
+	schema2, err := cache.get(webhook)
+	assert.NoError(t, err)
+	assert.Same(t, schema1, schema2)
+	assert.Empty(t, schema1.Validate(`{}`))
+
+	// The changed schema is compiled again
+	webhook.Schema = `{"type": "array"}`
+	schema3, err := cache.get(webhook)
+	assert.NoError(t, err)
+	assert.NotSame(t, schema1, schema3)
+	assert.NotEmpty(t, schema3.Validate(`{}`))
+
+	// Another webhook has its own schema
+	other, err := cache.get(&model.Webhook{Hash: "hash2", Schema: `{"type": "object"}`})
+	assert.NoError(t, err)
+	assert.NotSame(t, schema1, other)
+}
+
+func TestValidateRows(t *testing.T) {
+	t.Parallel()
+	s := &Service{schemas: newSchemaCache()}
+	webhook := &model.Webhook{Hash: "hash", Schema: `{"type": "object", "required": ["id"]}`}
+	assert.NoError(t, s.validateRows(webhook, []*model.Row{{Body: `{"id": 1}`}}))
+	assert.Error(t, s.validateRows(webhook, []*model.Row{{Body: `{"id": 1}`}, {Body: `{}`}}))
+	assert.NoError(t, s.validateRows(&model.Webhook{Hash: "hash"}, []*model.Row{{Body: `foo`}}))
+}
@@ -2,12 +2,11 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	stdLog "log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,11 +15,10 @@ import (
 	"github.com/avast/retry-go/v4"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/api/storageapi"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/env"
-	"github.com/keboola/temp-webhooks-api/internal/pkg/json"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
-	"github.com/keboola/temp-webhooks-api/internal/pkg/s3"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/storage"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils"
 	"github.com/keboola/temp-webhooks-api/internal/pkg/webhooks/api/gen/webhooks"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -30,28 +28,51 @@ import (
 const (
 	WebhookCheckInterval = 15 * time.Second
 	HeadersCtxKey        = ctxKey("headers")
+	RequestCtxKey        = ctxKey("request")
+	ResponseCtxKey       = ctxKey("response")
 )
 
 type ctxKey string
 
 type Service struct {
-	lock       *sync.Mutex
-	updating   map[model.WebhookHash]bool
-	ctx        context.Context
-	host       string
-	envs       *env.Map
-	logger     log.Logger
-	storage    *storage.Storage
-	storageApi *storageapi.Api
+	lock    *sync.Mutex
+	ctx     context.Context
+	host    string
+	envs    *env.Map
+	logger  log.Logger
+	storage *storage.Storage
+	// leaseOwner identifies the replica, imports are locked by leases in the database, see model.Lease
+	leaseOwner     string
+	leaseHeartbeat time.Duration
+	// stacks by Storage API host, see model.Webhook.StorageApiHost
+	stacks                map[string]*stack
+	defaultStorageApiHost string
+	// triggerLock serializes the trigger checks, so the job of an import is created once, see Service.triggerAfterImport
+	triggerLock *sync.Mutex
+	// schemas are compiled JSON Schemas of the webhooks, see Service.validateRows
+	schemas *schemaCache
+	imports *importPool
+	// importCtx is cancelled, if the running imports don't finish in the shutdown timeout, see Shutdown.
+	// It cancels the uploads and the API requests.
+	importCtx     context.Context
+	cancelImports context.CancelFunc
+	// running tracks background goroutines and running imports, so they can be drained on shutdown
+	runningLock *sync.Mutex
+	running     *sync.WaitGroup
+	stopping    bool
+	// importing contains IDs of the batches imported by this replica, see Service.importingBatches
+	importing map[string]bool
 }
 
-func New(ctx context.Context, envs *env.Map, stdLogger *stdLog.Logger) (webhooks.Service, error) {
+func New(ctx context.Context, envs *env.Map, stdLogger *stdLog.Logger) (*Service, error) {
 	logger := log.NewApiLogger(stdLogger, "", false)
 
 	// Load ENVs
-	storageApiHost := envs.MustGet("KBC_STORAGE_API_HOST")
+	storageApiHost := normalizeHost(envs.MustGet("KBC_STORAGE_API_HOST"))
+	allowedHosts := envs.Get("KBC_STORAGE_API_HOSTS")
 	serviceHost := envs.MustGet("SERVICE_HOST")
 	mysqlDsn := envs.MustGet("SERVICE_MYSQL_DSN")
+	queueApiHost := envs.Get("KBC_QUEUE_API_HOST")
 
 	// Connect to DB
 	db, err := connectToDb(mysqlDsn, stdLogger)
@@ -65,26 +86,47 @@ func New(ctx context.Context, envs *env.Map, stdLogger *stdLog.Logger) (webhooks
 		return nil, err
 	}
 
-	// Create API
-	api := storageapi.New(context.Background(), logger, storageApiHost, false)
+	// Create APIs, one set per stack, requests are cancelled on shutdown
+	importCtx, cancelImports := context.WithCancel(context.Background())
+	stacks := newStacks(importCtx, logger, storageApiHost, allowedHosts, queueApiHost)
+
+	// Create pool of the imports, limits can be set by ENVs
+	imports, err := importPoolFromEnvs(envs)
+	if err != nil {
+		cancelImports()
+		return nil, err
+	}
 
 	// Create service
 	s := &Service{
-		lock:       &sync.Mutex{},
-		updating:   make(map[model.WebhookHash]bool),
-		ctx:        ctx,
-		host:       serviceHost,
-		envs:       envs,
-		logger:     logger,
-		storage:    stg,
-		storageApi: api,
+		lock:                  &sync.Mutex{},
+		leaseOwner:            leaseOwner(),
+		leaseHeartbeat:        LeaseHeartbeat,
+		ctx:                   ctx,
+		host:                  serviceHost,
+		envs:                  envs,
+		logger:                logger,
+		storage:               stg,
+		stacks:                stacks,
+		defaultStorageApiHost: storageApiHost,
+		triggerLock:           &sync.Mutex{},
+		schemas:               newSchemaCache(),
+		imports:               imports,
+		importCtx:             importCtx,
+		cancelImports:         cancelImports,
+		runningLock:           &sync.Mutex{},
+		running:               &sync.WaitGroup{},
+		importing:             make(map[string]bool),
 	}
 	s.StartCron()
+	s.StartJobTracker()
 	return s, nil
 }
 
 func (s *Service) StartCron() {
+	s.running.Add(1)
 	go func() {
+		defer s.running.Done()
 		ticker := time.NewTicker(WebhookCheckInterval)
 		for {
 			select {
@@ -92,6 +134,7 @@ func (s *Service) StartCron() {
 				return
 			case <-ticker.C:
 				s.checkWebhooks()
+				s.deleteExpiredReceipts()
 			}
 		}
 	}()
@@ -102,6 +145,11 @@ func (s *Service) checkWebhooks() {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
+	// No new import on shutdown
+	if s.isStopping() {
+		return
+	}
+
 	// Get all
 	items, err := s.storage.AllWebhooks()
 	if err != nil {
@@ -109,13 +157,9 @@ func (s *Service) checkWebhooks() {
 	}
 
 	// Check each
+	var due []model.WebhookHash
+	var leases []string
 	for _, webhook := range items {
-		// Only once
-		if s.updating[webhook.Hash] {
-			s.logger.Infof(`skipped import "%s": in progress`, webhook.Hash)
-			continue
-		}
-
 		// Count rows
 		count, err := s.storage.CountRows(webhook.Id)
 		if err != nil {
@@ -127,24 +171,55 @@ func (s *Service) checkWebhooks() {
 			continue
 		}
 
+		// Wait after a failed import
+		if webhook.RetryAt != nil && time.Now().Before(*webhook.RetryAt) {
+			s.logger.Infof(`skipped import "%s": retry at %s`, webhook.Hash, webhook.RetryAt.UTC().Format(time.RFC3339))
+			continue
+		}
+
 		// Check
 		if webhook.Conditions.ShouldImport(count, time.Since(webhook.ImportedAt), webhook.Size) {
-			s.updating[webhook.Hash] = true
-			go func() {
-				defer func() {
-					s.updating[webhook.Hash] = false
-				}()
-				if err := s.importToKbc(string(webhook.Hash)); err != nil {
-					s.logger.Errorf(`cannot import "%s": %w`, webhook.Hash, err)
-					return
-				}
-				s.logger.Infof(`IMPORTED to "%s"`, webhook.Hash)
-			}()
+			// Only once, across all replicas
+			lease := model.ImportLease(webhook.Hash)
+			if !s.acquireLease(lease) {
+				s.logger.Infof(`skipped import "%s": in progress`, webhook.Hash)
+				continue
+			}
+			due = append(due, webhook.Hash)
+			leases = append(leases, lease)
 		} else {
 			s.logger.Infof(`skipped import "%s": condition=false`, webhook.Hash)
 			continue
 		}
 	}
+
+	// Import all due webhooks together, so batches targeting the same table are merged
+	if len(due) == 0 {
+		return
+	}
+	ctx, release := s.holdLeases(s.importCtx, leases...)
+	if !s.startImport() {
+		release()
+		return
+	}
+	go func() {
+		defer s.finishImport()
+		defer release()
+		if err := s.importWebhooks(ctx, due); err != nil {
+			s.logger.Errorf(`cannot import: %s`, err)
+			return
+		}
+		s.logger.Infof(`IMPORTED %d webhooks`, len(due))
+	}()
+}
+
+func (s *Service) deleteExpiredReceipts() {
+	count, err := s.storage.DeleteExpiredReceipts()
+	if err != nil {
+		s.logger.Error(err)
+	} else if count > 0 {
+		s.logger.Infof(`deleted %d expired receipts`, count)
+	}
 }
 
 func (s *Service) IndexRoot(_ context.Context) (res *webhooks.Index, err error) {
@@ -160,27 +235,51 @@ func (s *Service) HealthCheck(_ context.Context) (res string, err error) {
 }
 
 func (s *Service) Register(_ context.Context, payload *webhooks.RegisterPayload) (res *webhooks.RegistrationResult, err error) {
+	// Get stack
+	storageApiHost := s.defaultStorageApiHost
+	if payload.StorageAPIHost != nil {
+		storageApiHost = normalizeHost(*payload.StorageAPIHost)
+	}
+	stack, err := s.stackByHost(storageApiHost)
+	if err != nil {
+		return nil, err
+	}
+
 	// Validate token
-	token, err := s.storageApi.GetToken(payload.Token)
+	token, err := stack.storageApi.GetToken(payload.Token)
 	if err != nil {
 		return nil, &webhooks.UnauthorizedError{Message: fmt.Sprintf(`Invalid storage token "%s" supplied.`, payload.Token)}
 	}
 
 	// Validate table ID
-	parts := strings.Split(payload.TableID, ".")
-	if len(parts) != 3 {
-		return nil, fmt.Errorf(`invalid table ID: %s`, payload.TableID)
-	}
-
-	// Create conditions
-	conditions, err := conditionsFromPayload(payload.Conditions)
-	if err != nil {
+	if err := model.ValidateTableId(payload.TableID); err != nil {
 		return nil, err
 	}
 
 	// Create webhook
-	webhook, err := s.storage.RegisterWebhook(token, payload.TableID, conditions)
-	if err != nil {
+	webhook := &model.Webhook{
+		StorageApiHost: storageApiHost,
+		ProjectId:      uint32(token.ProjectId()),
+		Token:          token.Token,
+		RegisteredBy:   registeredBy(token),
+		TableId:        payload.TableID,
+		Conditions:     model.NewConditions(),
+		Methods:        http.MethodPost,
+		Response:       model.ResponseJson,
+		BodyFormat:     model.BodyFormatAuto,
+		SampleRate:     model.DefaultSampleRate,
+		LoadType:       model.LoadTypeAppend,
+	}
+
+	// Set options
+	opts := registerOptions(payload)
+	if err := s.validateOptions(webhook, opts); err != nil {
+		return nil, err
+	}
+	if err := applyOptions(webhook, opts); err != nil {
+		return nil, err
+	}
+	if err := s.storage.RegisterWebhook(webhook); err != nil {
 		return nil, err
 	}
 
@@ -191,122 +290,513 @@ func (s *Service) Register(_ context.Context, payload *webhooks.RegisterPayload)
 }
 
 func (s *Service) Update(_ context.Context, payload *webhooks.UpdatePayload) (res *webhooks.UpdateResult, err error) {
-	// Create conditions
-	conditions, err := conditionsFromPayload(payload.Conditions)
+	// Validate options before the webhook is locked
+	opts := updateOptions(payload)
+	webhook, err := s.storage.Get(payload.Hash)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.validateOptions(webhook, opts); err != nil {
+		return nil, err
+	}
 
-	webhook, err := s.storage.UpdateWebhook(payload.Hash, conditions)
+	// Update webhook, only the sent options are changed
+	webhook, err = s.storage.UpdateWebhook(payload.Hash, func(webhook *model.Webhook) error {
+		return applyOptions(webhook, opts)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &webhooks.UpdateResult{Conditions: webhook.Conditions.Payload()}, nil
+	var schema *string
+	if webhook.Schema != "" {
+		schema = &webhook.Schema
+	}
+	return &webhooks.UpdateResult{
+		Conditions:       webhook.Conditions.Payload(),
+		Methods:          webhook.MethodsSlice(),
+		Response:         webhooks.ResponseType(webhook.Response),
+		BodyFormat:       webhooks.BodyFormat(webhook.BodyFormat),
+		CloudEvents:      webhook.CloudEvents,
+		Schema:           schema,
+		Idempotency:      webhook.Idempotency.Payload(),
+		EventTime:        webhook.EventTime.Payload(),
+		Routes:           webhook.Routes.Payload(),
+		DropRules:        webhook.DropRules.Payload(),
+		SampleRate:       webhook.SampleRate,
+		Flatten:          webhook.Flatten,
+		AddColumns:       !webhook.FixedColumns,
+		PrimaryKey:       webhook.PrimaryKeySlice(),
+		LoadType:         webhooks.LoadType(webhook.LoadType),
+		CreatePrimaryKey: webhook.CreatePrimaryKey,
+		ColumnTypes:      webhook.ColumnTypes.Payload(),
+		Description:      webhook.Description,
+		Trigger:          webhook.Trigger.Payload(),
+		BranchID:         webhook.BranchId,
+		StorageAPIHost:   s.storageApiHostOf(webhook),
+	}, nil
 }
 
 func (s *Service) Flush(_ context.Context, payload *webhooks.FlushPayload) (res string, err error) {
+	// Get webhook
+	webhook, err := s.storage.Get(payload.Hash)
+	if err != nil {
+		return "", err
+	}
+
+	// No new import on shutdown
+	if !s.startImport() {
+		return "", errShuttingDown
+	}
+	defer s.finishImport()
+
+	// Only once, across all replicas
+	lease := model.ImportLease(webhook.Hash)
+	if !s.acquireLease(lease) {
+		return "", &webhooks.ImportInProgressError{Message: fmt.Sprintf(`Import of the webhook "%s" is in progress.`, webhook.Hash)}
+	}
+	leaseCtx, release := s.holdLeases(s.importCtx, lease)
+	defer release()
+
 	// Import to KBC
-	if err = s.importToKbc(payload.Hash); err != nil {
+	if err = s.importWebhooks(leaseCtx, []model.WebhookHash{webhook.Hash}); err != nil {
 		return "", err
 	}
 	return "OK", nil
 }
 
-func (s *Service) Import(ctx context.Context, payload *webhooks.ImportPayload, bodyStream io.ReadCloser) (res *webhooks.ImportResult, err error) {
-	// Read body
-	body, err := io.ReadAll(bodyStream)
+func (s *Service) Import(ctx context.Context, importPayload *webhooks.ImportPayload, bodyStream io.ReadCloser) (res *webhooks.ImportResult, err error) {
+	// Get webhook
+	webhook, err := s.storage.Get(importPayload.Hash)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read request body: %w", err)
+		return nil, err
+	}
+
+	// Check method
+	req := ctx.Value(RequestCtxKey).(*http.Request)
+	if !webhook.AllowsMethod(req.Method) {
+		return nil, &webhooks.MethodNotAllowedError{Message: fmt.Sprintf(`Method "%s" is not allowed for webhook "%s".`, req.Method, webhook.Hash)}
+	}
+
+	// Read rows
+	headers := ctx.Value(HeadersCtxKey).(http.Header)
+	rows, form, err := s.readRows(webhook, req, headers, bodyStream)
+	if err != nil {
+		return nil, err
+	}
+	defer removeForm(form)
+
+	// Drop unwanted rows
+	rows, dropped := dropRows(webhook, headers, rows)
+
+	// Validate rows
+	if err := s.validateRows(webhook, rows); err != nil {
+		return nil, err
+	}
+
+	// Check flattened rows
+	if err := flattenRows(webhook, rows); err != nil {
+		return nil, err
 	}
 
-	// Write CSV row
-	headers := json.MustEncodeString(ctx.Value(HeadersCtxKey).(http.Header), true)
-	webhook, count, err := s.storage.WriteRow(payload.Hash, headers, string(body))
+	// Set idempotency keys
+	if err := setIdempotencyKeys(webhook, headers, rows); err != nil {
+		return nil, err
+	}
+
+	// Set event times
+	if err := setEventTimes(webhook, headers, rows); err != nil {
+		return nil, err
+	}
+
+	// Route rows to tables
+	for _, row := range rows {
+		row.TableId = webhook.TableIdOf(headers, row.Body)
+	}
+
+	// Upload files of the accepted rows
+	if err := s.uploadFiles(req.Context(), webhook, rows, form); err != nil {
+		return nil, err
+	}
+
+	// Write CSV rows
+	webhook, receipts, count, err := s.storage.WriteRow(importPayload.Hash, rows...)
 	if err != nil {
 		return nil, err
 	}
 
+	// Count repeated deliveries
+	var duplicates uint
+	receiptIds := make([]string, 0, len(receipts))
+	for _, receipt := range receipts {
+		receiptIds = append(receiptIds, receipt.Id)
+		if receipt.Duplicate {
+			duplicates++
+		}
+	}
+	if duplicates > 0 {
+		s.logger.Infof(`skipped %d repeated deliveries, tableId="%s"`, duplicates, webhook.TableId)
+	}
+
+	// Count dropped rows
+	if dropped > 0 {
+		if err := s.storage.WriteDropped(webhook, dropped); err != nil {
+			return nil, err
+		}
+		s.logger.Infof(`dropped %d records, tableId="%s"`, dropped, webhook.TableId)
+	}
+
+	if webhook.Response == model.ResponsePixel {
+		setPixelResponse(ctx)
+	}
+
 	s.logger.Infof("RECEIVED webhook, tableId=\"%s\"", webhook.TableId)
-	return &webhooks.ImportResult{RecordsInBatch: count}, nil
+	return &webhooks.ImportResult{RecordsInBatch: count, Duplicates: duplicates, Receipts: receiptIds, Dropped: dropped}, nil
 }
 
-func (s *Service) importToKbc(webhookHash string) error {
-	// Get webhook
-	webhook, err := s.storage.Get(webhookHash)
+func (s *Service) Stats(_ context.Context, payload *webhooks.StatsPayload) (res *webhooks.StatsResult, err error) {
+	webhook, err := s.storage.Get(payload.Hash)
 	if err != nil {
+		return nil, err
+	}
+	count, err := s.storage.CountRows(webhook.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &webhooks.StatsResult{
+		Received:       webhook.Stats.Received,
+		Dropped:        webhook.Stats.Dropped,
+		Duplicates:     webhook.Stats.Duplicates,
+		RecordsInBatch: count,
+	}, nil
+}
+
+func (s *Service) Receipt(_ context.Context, payload *webhooks.ReceiptPayload) (res *webhooks.ReceiptResult, err error) {
+	receipt, batch, err := s.storage.GetReceipt(payload.Hash, payload.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res = &webhooks.ReceiptResult{
+		ID:         receipt.Id,
+		Status:     model.ReceiptStatusBuffered,
+		ReceivedAt: receipt.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if batch != nil {
+		res.Status = batch.Status
+		res.BatchID = &batch.Id
+		if batch.JobId != 0 {
+			res.JobID = &batch.JobId
+		}
+		if batch.Error != "" {
+			res.Error = &batch.Error
+		}
+		if batch.TriggerStatus != "" {
+			res.TriggerStatus = &batch.TriggerStatus
+		}
+		if batch.TriggerJobId != "" {
+			res.TriggerJobID = &batch.TriggerJobId
+		}
+		if batch.TriggerError != "" {
+			res.TriggerError = &batch.TriggerError
+		}
+	}
+	return res, nil
+}
+
+// importWebhooks moves buffered rows of the webhooks to batches and imports them.
+// Batches of webhooks targeting the same table are merged to one CSV file and imported by one Storage job, see importKey.
+// The created Storage jobs are tracked in the background, see Service.trackJobs.
+// The import is stopped, if the context is cancelled, see Service.holdLeases.
+func (s *Service) importWebhooks(ctx context.Context, webhookHashes []model.WebhookHash) error {
+	errs := utils.NewMultiError()
+
+	// Move rows to batches, one per webhook and target table
+	groups := newImportGroups()
+	for _, webhookHash := range webhookHashes {
+		// Rows stay in the buffer on shutdown
+		if s.isStopping() {
+			errs.Append(errShuttingDown)
+			break
+		}
+		if err := s.importStopped(ctx); err != nil {
+			errs.Append(err)
+			break
+		}
+
+		webhook, batches, err := s.storage.Fetch(string(webhookHash))
+		if err != nil {
+			errs.Append(fmt.Errorf(`cannot fetch "%s": %w`, webhookHash, err))
+			continue
+		}
+		for _, batch := range batches {
+			s.logger.Infof(`fetched "%s" to batch "%s", tableId="%s", size=%d`, webhook.Hash, batch.Id, batch.TableId, batch.Size)
+			s.startBatch(batch)
+			groups.add(newImportKey(s.storageApiHostOf(webhook), webhook, batch), webhook, batch)
+		}
+	}
+
+	// Import groups by the pool, each group by one Storage job
+	wg := &sync.WaitGroup{}
+	for _, group := range s.splitGroups(groups.all()) {
+		group := group
+		var job model.Job
+		wg.Add(1)
+		s.imports.submit(&importTask{
+			project: group.key.project(),
+			table:   group.key.table(),
+			run: func() (err error) {
+				job, err = s.importGroup(ctx, group)
+				return err
+			},
+			done: func(err error) {
+				defer wg.Done()
+				s.finishGroup(ctx, group, job, err)
+				if err != nil {
+					errs.Append(err)
+				}
+			},
+		})
+	}
+	wg.Wait()
+
+	if errs.Len() > 0 {
+		return errs
+	}
+	return nil
+}
+
+// splitGroups verifies the write access of the merged webhooks with different tokens, see importGroup.split.
+// Tokens are verified once per import, a token which cannot be verified is handled as without the access.
+func (s *Service) splitGroups(groups []*importGroup) (out []*importGroup) {
+	access := make(map[string]bool)
+	for _, group := range groups {
+		bucketId := model.BucketIdOf(group.key.tableId)
+		out = append(out, group.split(func(webhook *model.Webhook) bool {
+			key := fmt.Sprintf("%s/%s", webhook.Token, bucketId)
+			if canWrite, found := access[key]; found {
+				return canWrite
+			}
+			token, err := s.verifyToken(webhook)
+			if err != nil {
+				s.logger.Warnf(`cannot verify token of webhook "%s": %s`, webhook.Hash, err)
+			}
+			access[key] = err == nil && token.CanWriteBucket(bucketId)
+			return access[key]
+		})...)
+	}
+	return out
+}
+
+// verifyToken loads details of the webhook token.
+func (s *Service) verifyToken(webhook *model.Webhook) (token model.Token, err error) {
+	stack, err := s.stackOf(webhook)
+	if err != nil {
+		return token, err
+	}
+	err = s.callApi(webhook, func() (err error) {
+		token, err = stack.storageApi.GetToken(webhook.Token)
 		return err
+	})
+	return token, err
+}
+
+// importGroup imports the batches by one Storage job.
+func (s *Service) importGroup(ctx context.Context, group *importGroup) (model.Job, error) {
+	webhook := group.webhook()
+	if len(group.batches) > 1 {
+		var hashes []string
+		for _, w := range group.webhooks {
+			hashes = append(hashes, string(w.Hash))
+		}
+		s.logger.Infof(`merged %d batches to table "%s", webhooks: "%s"`, len(group.batches), group.batches[0].TableId, strings.Join(hashes, `", "`))
+	}
+
+	// Set stack, token and branch
+	stack, err := s.stackOf(webhook)
+	if err != nil {
+		return model.Job{}, err
+	}
+	apiWithToken := stack.storageApi.WithToken(model.Token{Token: group.token}).WithBranch(webhook.BranchId)
+	return s.importBatches(ctx, apiWithToken, group)
+}
+
+// finishGroup stores the job, or the import error, to each batch of the group.
+// A failed batch can finish the import of its webhook, so the trigger is checked, see Service.triggerAfterImport.
+// If the import lease has been lost and no job has been created, the batches are not modified,
+// another replica can hold the lease, the batches are recovered later, see Service.recoverStaleBatches.
+// If the import has been interrupted by the shutdown, rows are returned to the buffer and the attempt is not counted.
+func (s *Service) finishGroup(ctx context.Context, group *importGroup, job model.Job, importErr error) {
+	defer s.finishBatches(group.batches)
+	stopErr := s.importStopped(ctx)
+	if job.Id == 0 && errors.Is(stopErr, errLeaseLost) {
+		s.logger.Warnf(`batch "%s" of table "%s" has not been finished: %s`, group.batches[0].Id, group.batches[0].TableId, errLeaseLost)
+		return
+	}
+	shuttingDown := errors.Is(importErr, errShuttingDown) || errors.Is(stopErr, errShuttingDown)
+	for i, batch := range group.batches {
+		switch {
+		case importErr != nil && shuttingDown:
+			if err := s.storage.ReturnBatch(batch, errShuttingDown); err != nil {
+				s.logger.Errorf(`cannot return batch "%s": %s`, batch.Id, err)
+				continue
+			}
+			s.logger.Infof(`returned batch "%s" to the buffer: %s`, batch.Id, errShuttingDown)
+			s.triggerAfterImports(group.webhooks[i], []*model.Batch{batch})
+		case importErr != nil:
+			if err := s.storage.FinishBatch(batch, job.Id, importErr); err != nil {
+				s.logger.Errorf(`cannot finish batch "%s": %s`, batch.Id, err)
+				continue
+			}
+			s.triggerAfterImports(group.webhooks[i], []*model.Batch{batch})
+		default:
+			if err := s.storage.StartJob(batch, job.Id); err != nil {
+				s.logger.Errorf(`cannot store job "%d" of batch "%s": %s`, job.Id, batch.Id, err)
+			}
+		}
 	}
+}
+
+// importBatches uploads rows of all batches of the group to one file and imports it to the table.
+// Settings of the table are defined by the first webhook of the group.
+func (s *Service) importBatches(ctx context.Context, apiWithToken *storageapi.Api, group *importGroup) (model.Job, error) {
+	webhook := group.webhook()
+	batch := group.target()
 
 	// Parse tableID
-	parts := strings.Split(webhook.TableId, ".")
+	parts := strings.Split(batch.TableId, ".")
 	if len(parts) != 3 {
-		return fmt.Errorf(`invalid table ID: %s`, webhook.TableId)
+		return model.Job{}, fmt.Errorf(`invalid table ID: %s`, batch.TableId)
 	}
 	bucketId := strings.Join(parts[0:2], ".")
 	tableName := parts[2]
 
-	// Set token
-	apiWithToken := s.storageApi.WithToken(model.Token{Token: webhook.Token})
-
 	// Create bucket if not exists
 	if !apiWithToken.BucketExists(bucketId) {
 		bucketName := strings.TrimPrefix(parts[1], "c-")
-		if _, err := apiWithToken.CreateBucket(bucketName, parts[0], parts[1]); err != nil {
-			return fmt.Errorf(`cannot create bucket "%s": %w`, bucketId, err)
+		if err := s.callApi(webhook, func() error {
+			_, err := apiWithToken.CreateBucket(bucketName, parts[0], parts[1])
+			return err
+		}); err != nil {
+			return model.Job{}, fmt.Errorf(`cannot create bucket "%s": %w`, bucketId, err)
 		}
 		s.logger.Infof(`created bucket "%s"`, bucketId)
 	} else {
 		s.logger.Infof(`bucket "%s" exists`, bucketId)
 	}
 
-	// Create temp file
-	csvFile, err := ioutil.TempFile(os.TempDir(), "keboola-csv")
-	if err != nil {
-		return fmt.Errorf(`cannot create temp file: %w`, err)
+	// Reconcile columns of the existing table
+	var table *model.Table
+	if err := s.callApi(webhook, func() (err error) {
+		table, err = getTable(apiWithToken, batch.TableId)
+		return err
+	}); err != nil {
+		return model.Job{}, err
 	}
-	defer func() {
-		if err := os.Remove(csvFile.Name()); err != nil {
-			s.logger.Error(err.Error())
+	if table != nil {
+		if err := s.reconcileColumns(apiWithToken, webhook, batch, table); err != nil {
+			return model.Job{}, err
 		}
-	}()
-
-	// Create CSV file
-	if _, err = s.storage.Fetch(webhookHash, csvFile); err != nil {
-		return err
+		if webhook.LoadType == model.LoadTypeUpsert && !webhook.SamePrimaryKey(table.PrimaryKey) {
+			return model.Job{}, fmt.Errorf(`table "%s" has primary key "%s", but load type "%s" expects primary key "%s"`, table.Id, strings.Join(table.PrimaryKey, ","), webhook.LoadType, webhook.PrimaryKey)
+		}
+	} else if webhook.LoadType == model.LoadTypeUpsert && !webhook.CreatePrimaryKey {
+		return model.Job{}, fmt.Errorf(`table "%s" does not exist and it cannot be created without the primary key required by load type "%s"`, batch.TableId, webhook.LoadType)
 	}
-	s.logger.Infof(`fetched "%s" to CSV file "%s"`, webhook.Hash, csvFile.Name())
 
-	// Create file resource
-	fileResource, err := apiWithToken.CreateFileResource(fmt.Sprintf("webhook-%s.csv", webhook.Hash))
-	if err != nil {
-		return fmt.Errorf(`cannot create file resource: %w`, err)
+	// Upload rows of all batches in the order of the merged columns
+	if err := s.importStopped(ctx); err != nil {
+		return model.Job{}, err
 	}
-
-	// Upload to S3
-	err = s3.UploadFileToS3(csvFile.Name(), fileResource)
+	fileResource, err := s.uploadBatch(ctx, apiWithToken, webhook, batch, func(w storage.RowWriter) error {
+		for i, item := range group.batches {
+			if err := s.storage.WriteBatch(group.webhooks[i], item, newColumnMapper(w, item.Columns, batch.Columns)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf(`cannot upload to S3: %w`, err)
+		return model.Job{}, err
 	}
 
 	// Import CSV
+	if err := s.importStopped(ctx); err != nil {
+		return model.Job{}, err
+	}
 	fileId := strconv.Itoa(fileResource.Id)
-	if apiWithToken.TableExists(webhook.TableId) {
+	if table != nil {
 		// Import table
-		_, err = apiWithToken.ImportTableAsync(webhook.TableId, fileId, true)
-		if err != nil {
-			return fmt.Errorf(`cannot import to table "%s": %w`, webhook.TableId, err)
+		var job model.Job
+		if err := s.callApi(webhook, func() (err error) {
+			job, err = apiWithToken.ImportTableAsync(batch.TableId, fileId, webhook.Incremental(), importColumns(batch, fileResource))
+			return err
+		}); err != nil {
+			return job, fmt.Errorf(`cannot import to table "%s": %w`, batch.TableId, err)
 		}
-	} else {
-		// Create table
-		_, err = apiWithToken.CreateTableAsync(bucketId, tableName, fileId)
-		if err != nil {
-			return fmt.Errorf(`cannot create table "%s": %w`, webhook.TableId, err)
+		return job, nil
+	}
+
+	// Create table
+	job, err := s.createTable(apiWithToken, webhook, batch, fileResource, bucketId, tableName)
+	if err != nil {
+		return job, fmt.Errorf(`cannot create table "%s": %w`, batch.TableId, err)
+	}
+	return job, nil
+}
+
+// createTable creates the table from the CSV file.
+// If column types are declared or the file is sliced, the table is created from a table definition and the CSV file is imported to it.
+// Metadata of a table created from the CSV file are added when the job is finished, see Service.finishJob.
+func (s *Service) createTable(apiWithToken *storageapi.Api, webhook *model.Webhook, batch *model.Batch, fileResource model.FileResource, bucketId, tableName string) (model.Job, error) {
+	fileId := strconv.Itoa(fileResource.Id)
+	var job model.Job
+	if len(webhook.ColumnTypes) == 0 && !fileResource.IsSliced {
+		var primaryKey []string
+		if webhook.CreatePrimaryKey {
+			primaryKey = webhook.PrimaryKeySlice()
 		}
+		err := s.callApi(webhook, func() (err error) {
+			job, err = apiWithToken.CreateTableAsync(bucketId, tableName, fileId, primaryKey)
+			return err
+		})
+		return job, err
 	}
 
+	if err := s.callApi(webhook, func() error {
+		_, err := apiWithToken.CreateTableDefinitionAsync(bucketId, webhook.TableDefinition(tableName, batch.Columns))
+		return err
+	}); err != nil {
+		return model.Job{}, err
+	}
+	s.addTableMetadata(apiWithToken, webhook, batch.TableId)
+	err := s.callApi(webhook, func() (err error) {
+		job, err = apiWithToken.ImportTableAsync(batch.TableId, fileId, webhook.Incremental(), importColumns(batch, fileResource))
+		return err
+	})
+	return job, err
+}
+
+// callApi runs the Storage API call in the project of the webhook, a throttled call is repeated, see importPool.call.
+func (s *Service) callApi(webhook *model.Webhook, fn func() error) error {
+	return s.imports.call(projectKey(s.storageApiHostOf(webhook), webhook.ProjectId), fn)
+}
+
+// importColumns returns columns of the sliced file, its slices have no header.
+func importColumns(batch *model.Batch, fileResource model.FileResource) []string {
+	if fileResource.IsSliced {
+		return batch.Columns
+	}
 	return nil
 }
 
+// registeredBy returns description of the token used to register the webhook.
+func registeredBy(token model.Token) string {
+	if token.Description != "" {
+		return token.Description
+	}
+	return fmt.Sprintf("token %s", token.Id)
+}
+
 func conditionsFromPayload(payload *webhooks.Conditions) (model.Conditions, error) {
 	// Create conditions
 	conditions := model.NewConditions()
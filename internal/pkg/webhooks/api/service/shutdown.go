@@ -0,0 +1,99 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+// DefaultShutdownTimeout is the default max time of the graceful shutdown, see Service.Shutdown.
+const DefaultShutdownTimeout = 60 * time.Second
+
+var errShuttingDown = errors.New("the service is shutting down")
+
+// Shutdown stops scheduling of new imports and waits for the running imports and background goroutines.
+// The context passed to New should be cancelled before, it stops the cron and the job tracker.
+// Shutdown can be called while the HTTP server is draining, an import requested after that is not started.
+// Queued imports are not started, their batches are returned to the buffer.
+// If the running imports don't finish in the timeout, their uploads and API requests are cancelled
+// and the batches are returned to the buffer too.
+// If the imports don't stop in the next timeout, Shutdown returns,
+// the remaining batches are recovered after the restart, see Service.recoverStaleBatches.
+// So Shutdown waits up to twice the timeout.
+func (s *Service) Shutdown(timeout time.Duration) {
+	s.runningLock.Lock()
+	s.stopping = true
+	s.runningLock.Unlock()
+	s.imports.stop(errShuttingDown)
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("all imports finished")
+	case <-time.After(timeout):
+		s.logger.Warnf("imports did not finish in %s, cancelling", timeout)
+		s.cancelImports()
+		select {
+		case <-done:
+			s.logger.Info("all imports cancelled")
+		case <-time.After(timeout):
+			s.logger.Warnf(`imports did not stop in %s, batches "%s" will be recovered after the restart`, timeout, strings.Join(s.importingBatches(), `", "`))
+		}
+	}
+}
+
+// startImport registers a running import, it returns false on shutdown.
+func (s *Service) startImport() bool {
+	s.runningLock.Lock()
+	defer s.runningLock.Unlock()
+	if s.stopping {
+		return false
+	}
+	s.running.Add(1)
+	return true
+}
+
+func (s *Service) finishImport() {
+	s.running.Done()
+}
+
+// startBatch registers the batch imported by this replica, see Service.importingBatches.
+func (s *Service) startBatch(batch *model.Batch) {
+	s.runningLock.Lock()
+	defer s.runningLock.Unlock()
+	s.importing[batch.Id] = true
+}
+
+func (s *Service) finishBatches(batches []*model.Batch) {
+	s.runningLock.Lock()
+	defer s.runningLock.Unlock()
+	for _, batch := range batches {
+		delete(s.importing, batch.Id)
+	}
+}
+
+// importingBatches returns sorted IDs of the batches imported by this replica.
+func (s *Service) importingBatches() []string {
+	s.runningLock.Lock()
+	defer s.runningLock.Unlock()
+	out := make([]string, 0, len(s.importing))
+	for id := range s.importing {
+		out = append(out, id)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *Service) isStopping() bool {
+	s.runningLock.Lock()
+	defer s.runningLock.Unlock()
+	return s.stopping
+}
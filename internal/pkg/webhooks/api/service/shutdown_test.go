@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newShutdownService() *Service {
+	importCtx, cancelImports := context.WithCancel(context.Background())
+	return &Service{
+		logger:        log.NewDebugLogger(),
+		imports:       newImportPool(ImportWorkers, ImportsPerProject, ImportsPerTable),
+		importCtx:     importCtx,
+		cancelImports: cancelImports,
+		runningLock:   &sync.Mutex{},
+		running:       &sync.WaitGroup{},
+		importing:     make(map[string]bool),
+	}
+}
+
+func TestShutdownWaitsForImports(t *testing.T) {
+	t.Parallel()
+	s := newShutdownService()
+	assert.True(t, s.startImport())
+
+	finished := false
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		finished = true
+		s.finishImport()
+	}()
+	s.Shutdown(time.Minute)
+
+	assert.True(t, finished)
+	assert.NoError(t, s.importCtx.Err())
+	assert.True(t, s.isStopping())
+	assert.False(t, s.startImport())
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	t.Parallel()
+	s := newShutdownService()
+	assert.True(t, s.startImport())
+
+	// The import is cancelled after the timeout
+	go func() {
+		<-s.importCtx.Done()
+		s.finishImport()
+	}()
+	s.Shutdown(10 * time.Millisecond)
+
+	assert.ErrorIs(t, s.importCtx.Err(), context.Canceled)
+	assert.False(t, s.startImport())
+}
+
+func TestShutdownStopWaiting(t *testing.T) {
+	t.Parallel()
+	logger := log.NewDebugLogger()
+	s := newShutdownService()
+	s.logger = logger
+	assert.True(t, s.startImport())
+	s.startBatch(&model.Batch{Id: "batch2"})
+	s.startBatch(&model.Batch{Id: "batch1"})
+
+	// The import doesn't stop after the cancellation, Shutdown returns after the next timeout
+	start := time.Now()
+	s.Shutdown(10 * time.Millisecond)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.ErrorIs(t, s.importCtx.Err(), context.Canceled)
+	assert.Contains(t, logger.WarnMessages(), `imports did not stop in 10ms, batches "batch1", "batch2" will be recovered after the restart`)
+}
+
+func TestShutdownReturnsBatches(t *testing.T) {
+	t.Parallel()
+	s, storageTransport, _ := testService(t)
+	webhook := &model.Webhook{Token: "my-token", TableId: "in.c-bucket.table", Conditions: model.NewConditions()}
+	if err := s.storage.RegisterWebhook(webhook); err != nil {
+		t.Fatal(err)
+	}
+	hash := string(webhook.Hash)
+	_, receipts, _, err := s.storage.WriteRow(hash, &model.Row{Headers: `{}`, Body: `{"id":1}`}, &model.Row{Headers: `{}`, Body: `{"id":2}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Storage API doesn't respond until the request is cancelled
+	requested := make(chan struct{}, 10)
+	storageTransport.RegisterNoResponder(func(req *http.Request) (*http.Response, error) {
+		requested <- struct{}{}
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+
+	// The import is running
+	assert.True(t, s.startImport())
+	importErr := make(chan error, 1)
+	go func() {
+		defer s.finishImport()
+		importErr <- s.importWebhooks(s.importCtx, []model.WebhookHash{webhook.Hash})
+	}()
+	<-requested
+
+	// The API request is cancelled after the timeout, the import is finished
+	s.Shutdown(10 * time.Millisecond)
+	err = <-importErr
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "context canceled")
+	}
+	assert.Empty(t, s.importingBatches())
+
+	// Rows are returned to the buffer, the next import is not delayed
+	count, err := s.storage.CountRows(webhook.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), count)
+	_, batch, err := s.storage.GetReceipt(hash, receipts[0].Id)
+	assert.NoError(t, err)
+	assert.Nil(t, batch)
+	updated, err := s.storage.Get(hash)
+	assert.NoError(t, err)
+	if updated.RetryAt != nil {
+		assert.False(t, updated.RetryAt.After(time.Now()))
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/api/queueapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/api/storageapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+// stack contains APIs of one Keboola stack, they are shared by all webhooks of the stack.
+type stack struct {
+	storageApi *storageapi.Api
+	queueApi   *queueapi.Api
+}
+
+// newStacks creates APIs for the default host and for each allowed host.
+// The Queue API host can be overridden only for the default host.
+// Requests of the APIs are cancelled by the context, see Service.Shutdown.
+func newStacks(ctx context.Context, logger log.Logger, defaultHost, allowedHosts, defaultQueueHost string) map[string]*stack {
+	stacks := make(map[string]*stack)
+	for _, host := range parseHosts(defaultHost, allowedHosts) {
+		queueHost := queueapi.HostFromStorageHost(host)
+		if host == defaultHost && defaultQueueHost != "" {
+			queueHost = defaultQueueHost
+		}
+		stacks[host] = &stack{
+			storageApi: storageapi.New(ctx, logger, host, false),
+			queueApi:   queueapi.New(ctx, logger, queueHost, false),
+		}
+	}
+	return stacks
+}
+
+// parseHosts parses the comma separated list of Storage API hosts, the default host is always allowed.
+func parseHosts(defaultHost, hosts string) []string {
+	out := []string{defaultHost}
+	seen := map[string]bool{defaultHost: true}
+	for _, host := range strings.Split(hosts, ",") {
+		host = normalizeHost(host)
+		if host != "" && !seen[host] {
+			seen[host] = true
+			out = append(out, host)
+		}
+	}
+	return out
+}
+
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimPrefix(host, "https://")
+	return strings.TrimSuffix(host, "/")
+}
+
+// stackByHost returns APIs of the stack, if the host is allowed.
+func (s *Service) stackByHost(host string) (*stack, error) {
+	if v, found := s.stacks[host]; found {
+		return v, nil
+	}
+	allowed := make([]string, 0, len(s.stacks))
+	for h := range s.stacks {
+		allowed = append(allowed, h)
+	}
+	sort.Strings(allowed)
+	return nil, fmt.Errorf(`storage API host "%s" is not allowed, allowed values: %s`, host, strings.Join(allowed, ", "))
+}
+
+// stackOf returns APIs of the webhook stack, empty host means the default stack.
+func (s *Service) stackOf(webhook *model.Webhook) (*stack, error) {
+	return s.stackByHost(s.storageApiHostOf(webhook))
+}
+
+// storageApiHostOf returns Storage API host of the webhook stack.
+func (s *Service) storageApiHostOf(webhook *model.Webhook) string {
+	if webhook.StorageApiHost == "" {
+		return s.defaultStorageApiHost
+	}
+	return webhook.StorageApiHost
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHosts(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []string{"connection.keboola.com"}, parseHosts("connection.keboola.com", ""))
+	assert.Equal(t,
+		[]string{"connection.keboola.com", "connection.eu-central-1.keboola.com", "connection.north-europe.azure.keboola.com"},
+		parseHosts("connection.keboola.com", " https://connection.eu-central-1.keboola.com/,connection.keboola.com, Connection.North-Europe.Azure.Keboola.com"),
+	)
+}
+
+func TestStackOf(t *testing.T) {
+	t.Parallel()
+	s := &Service{
+		defaultStorageApiHost: "connection.keboola.com",
+		stacks:                newStacks(context.Background(), log.NewDebugLogger(), "connection.keboola.com", "connection.eu-central-1.keboola.com", "queue.example.com"),
+	}
+
+	v, err := s.stackOf(&model.Webhook{})
+	assert.NoError(t, err)
+	assert.Equal(t, "connection.keboola.com", v.storageApi.Host())
+	assert.Equal(t, "queue.example.com", v.queueApi.Host())
+
+	v, err = s.stackOf(&model.Webhook{StorageApiHost: "connection.eu-central-1.keboola.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "connection.eu-central-1.keboola.com", v.storageApi.Host())
+	assert.Equal(t, "queue.eu-central-1.keboola.com", v.queueApi.Host())
+
+	_, err = s.stackOf(&model.Webhook{StorageApiHost: "connection.example.com"})
+	assert.EqualError(t, err, `storage API host "connection.example.com" is not allowed, allowed values: connection.eu-central-1.keboola.com, connection.keboola.com`)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/api/storageapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/http/client"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+// getTable returns the table detail, or nil if the table doesn't exist.
+func getTable(apiWithToken *storageapi.Api, tableId string) (*model.Table, error) {
+	table, err := apiWithToken.GetTable(tableId)
+	if err != nil {
+		var errWithResponse client.ErrorWithResponse
+		if errors.As(err, &errWithResponse) && errWithResponse.IsNotFound() {
+			return nil, nil
+		}
+		return nil, fmt.Errorf(`cannot get table "%s": %w`, tableId, err)
+	}
+	return table, nil
+}
+
+// reconcileColumns makes the table columns and the CSV file compatible, column names are case-insensitive:
+//   - columns missing in the table are added to the table, if it is allowed, see model.Webhook.FixedColumns,
+//   - columns missing in the CSV file are added to the batch columns, they are written with empty values, it is not allowed for primary key columns.
+func (s *Service) reconcileColumns(apiWithToken *storageapi.Api, webhook *model.Webhook, batch *model.Batch, table *model.Table) error {
+	inTable := make(map[string]bool)
+	for _, column := range table.Columns {
+		inTable[strings.ToLower(column)] = true
+	}
+	inCsv := make(map[string]bool)
+	for _, column := range batch.Columns {
+		inCsv[strings.ToLower(column)] = true
+	}
+
+	// Primary key must be present in the CSV file
+	for _, column := range table.PrimaryKey {
+		if !inCsv[strings.ToLower(column)] {
+			return fmt.Errorf(`primary key column "%s" of table "%s" is not present in the CSV file, columns: "%s"`, column, table.Id, strings.Join(batch.Columns, `", "`))
+		}
+	}
+
+	// Add columns missing in the table
+	var missingInTable []string
+	for _, column := range batch.Columns {
+		if !inTable[strings.ToLower(column)] {
+			missingInTable = append(missingInTable, column)
+		}
+	}
+	if len(missingInTable) > 0 {
+		if webhook.FixedColumns {
+			return fmt.Errorf(`table "%s" has no columns "%s" and adding columns is disabled`, table.Id, strings.Join(missingInTable, `", "`))
+		}
+		for _, column := range missingInTable {
+			column := column
+			if err := s.callApi(webhook, func() error {
+				_, err := apiWithToken.AddColumnAsync(table.Id, column)
+				return err
+			}); err != nil {
+				return fmt.Errorf(`cannot add column "%s" to table "%s": %w`, column, table.Id, err)
+			}
+		}
+		s.logger.Infof(`added columns "%s" to table "%s"`, strings.Join(missingInTable, `", "`), table.Id)
+	}
+
+	// Add columns missing in the CSV file
+	var missingInCsv []string
+	for _, column := range table.Columns {
+		if !inCsv[strings.ToLower(column)] {
+			missingInCsv = append(missingInCsv, column)
+		}
+	}
+	if len(missingInCsv) > 0 {
+		batch.Columns = append(batch.Columns, missingInCsv...)
+		s.logger.Infof(`columns "%s" of table "%s" are not present in the batch, they will be empty`, strings.Join(missingInCsv, `", "`), table.Id)
+	}
+
+	return nil
+}
+
+// addTableMetadata marks the table created by the webhook, see model.Webhook.TableMetadata.
+// The import continues if the metadata cannot be added.
+func (s *Service) addTableMetadata(apiWithToken *storageapi.Api, webhook *model.Webhook, tableId string) {
+	if err := apiWithToken.AddTableMetadata(tableId, model.MetadataProvider, webhook.TableMetadata()); err != nil {
+		s.logger.Errorf(`cannot add metadata to table "%s": %s`, tableId, err)
+	}
+}
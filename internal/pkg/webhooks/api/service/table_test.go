@@ -0,0 +1,29 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileColumnsMissingInCsv(t *testing.T) {
+	t.Parallel()
+	s := &Service{logger: log.NewDebugLogger()}
+	api, transport := testapi.NewMockedStorageApi(log.NewDebugLogger())
+	webhook := &model.Webhook{FixedColumns: true}
+	batch := &model.Batch{Id: "batch1", Columns: []string{"timestamp", "headers", "body"}}
+	table := &model.Table{Id: "in.c-bucket.table", Columns: []string{"Timestamp", "headers", "body", "note", "source"}}
+
+	// Columns missing in the CSV file are appended to the batch, they are written with empty values
+	assert.NoError(t, s.reconcileColumns(api, webhook, batch, table))
+	assert.Equal(t, []string{"timestamp", "headers", "body", "note", "source"}, batch.Columns)
+	assert.Equal(t, 0, transport.GetTotalCallCount())
+
+	// Primary key column cannot be empty
+	batch = &model.Batch{Id: "batch2", Columns: []string{"timestamp", "headers", "body"}}
+	table.PrimaryKey = []string{"note"}
+	assert.EqualError(t, s.reconcileColumns(api, webhook, batch, table), `primary key column "note" of table "in.c-bucket.table" is not present in the CSV file, columns: "timestamp", "headers", "body"`)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+)
+
+// triggerAfterImport creates the Queue job when all batches of the import are finished, see model.Batch.FetchId.
+// The job is created only if all batches have been imported, so the job doesn't process partial data.
+// The result is stored to the batches, so it is processed once per import.
+func (s *Service) triggerAfterImport(webhook *model.Webhook, batch *model.Batch) {
+	s.triggerLock.Lock()
+	defer s.triggerLock.Unlock()
+
+	// Batches created before the FetchId was introduced are processed one by one
+	batches := []*model.Batch{batch}
+	if batch.FetchId != "" {
+		var err error
+		if batches, err = s.storage.FetchBatches(batch.FetchId); err != nil {
+			s.logger.Errorf(`cannot load batches of import "%s": %s`, webhook.Hash, err)
+			return
+		}
+	}
+
+	var failed []string
+	for _, item := range batches {
+		switch {
+		case item.TriggerStatus != "":
+			// Already processed
+			return
+		case item.Status == model.BatchStatusImporting:
+			// Wait for the other batches
+			return
+		case item.Status == model.BatchStatusFailed:
+			failed = append(failed, item.Id)
+		}
+	}
+
+	if len(failed) > 0 {
+		errMsg := fmt.Sprintf(`batches "%s" of the import failed`, strings.Join(failed, `", "`))
+		s.logger.Infof(`skipped job of "%s/%s" after import "%s": %s`, webhook.Trigger.ComponentId, webhook.Trigger.ConfigId, webhook.Hash, errMsg)
+		s.finishTrigger(webhook, batches, model.TriggerStatusSkipped, "", errMsg)
+		return
+	}
+	s.trigger(webhook, batches)
+}
+
+// trigger creates the Queue job after a successful import and stores the result to the batches, see model.Trigger.
+// The job is skipped if the previous job has been created within the minimal interval.
+func (s *Service) trigger(webhook *model.Webhook, batches []*model.Batch) {
+	now := time.Now()
+	status, jobId, errMsg := model.TriggerStatusSkipped, "", ""
+	if webhook.Trigger.Due(now) {
+		job, err := s.createJob(webhook)
+		if err != nil {
+			status, errMsg = model.TriggerStatusFailed, err.Error()
+			s.logger.Errorf(`cannot create job "%s/%s" after import "%s": %s`, webhook.Trigger.ComponentId, webhook.Trigger.ConfigId, webhook.Hash, err)
+		} else {
+			status, jobId = model.TriggerStatusTriggered, job.Id
+			webhook.Trigger.LastAt = &now
+			s.logger.Infof(`created job "%s" of "%s/%s" after import "%s"`, job.Id, webhook.Trigger.ComponentId, webhook.Trigger.ConfigId, webhook.Hash)
+		}
+	} else {
+		s.logger.Infof(`skipped job of "%s/%s" after import "%s": min interval`, webhook.Trigger.ComponentId, webhook.Trigger.ConfigId, webhook.Hash)
+	}
+	s.finishTrigger(webhook, batches, status, jobId, errMsg)
+}
+
+func (s *Service) finishTrigger(webhook *model.Webhook, batches []*model.Batch, status, jobId, errMsg string) {
+	for _, batch := range batches {
+		batch.TriggerStatus = status
+		batch.TriggerJobId = jobId
+		batch.TriggerError = errMsg
+	}
+	if err := s.storage.FinishTrigger(webhook, batches); err != nil {
+		s.logger.Errorf(`cannot store trigger result of "%s": %s`, webhook.Hash, err)
+	}
+}
+
+func (s *Service) createJob(webhook *model.Webhook) (*model.QueueJob, error) {
+	stack, err := s.stackOf(webhook)
+	if err != nil {
+		return nil, err
+	}
+	queueApi := stack.queueApi.WithToken(model.Token{Token: webhook.Token})
+	return queueApi.CreateJob(webhook.Trigger.ComponentId, webhook.Trigger.ConfigId, webhook.BranchId)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/log"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/storage"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/utils/testdb"
+	"github.com/stretchr/testify/assert"
+)
+
+// testService returns the service connected to the test database and to the mocked APIs, see testdb.New.
+func testService(t *testing.T) (*Service, *httpmock.MockTransport, *httpmock.MockTransport) {
+	t.Helper()
+	logger := log.NewDebugLogger()
+	stg := storage.New(testdb.New(t), logger)
+	if err := stg.MigrateDb(); err != nil {
+		t.Fatal(err)
+	}
+	importCtx, cancelImports := context.WithCancel(context.Background())
+	storageApi, storageTransport := testapi.NewMockedStorageApiWithContext(importCtx, logger)
+	queueApi, queueTransport := testapi.NewMockedQueueApi(logger)
+	s := &Service{
+		lock:                  &sync.Mutex{},
+		ctx:                   context.Background(),
+		logger:                logger,
+		storage:               stg,
+		leaseOwner:            leaseOwner(),
+		leaseHeartbeat:        LeaseHeartbeat,
+		stacks:                map[string]*stack{"connection.keboola.com": {storageApi: storageApi, queueApi: queueApi}},
+		defaultStorageApiHost: "connection.keboola.com",
+		triggerLock:           &sync.Mutex{},
+		schemas:               newSchemaCache(),
+		imports:               newImportPool(ImportWorkers, ImportsPerProject, ImportsPerTable),
+		importCtx:             importCtx,
+		cancelImports:         cancelImports,
+		runningLock:           &sync.Mutex{},
+		running:               &sync.WaitGroup{},
+		importing:             make(map[string]bool),
+	}
+	t.Cleanup(cancelImports)
+	return s, storageTransport, queueTransport
+}
+
+// testImport registers a webhook with the trigger and fetches two batches of one import.
+func testImport(t *testing.T, s *Service, minInterval time.Duration) (*model.Webhook, []*model.Batch) {
+	t.Helper()
+	webhook := &model.Webhook{
+		Token:      "my-token",
+		TableId:    "in.c-bucket.table",
+		Conditions: model.NewConditions(),
+		Routes:     model.Routes{{Source: model.RouteSourceJsonPath, Key: "type", Value: "order", TableId: "in.c-bucket.orders"}},
+		Trigger:    model.Trigger{ComponentId: "keboola.orchestrator", ConfigId: "123", MinInterval: minInterval},
+	}
+	if err := s.storage.RegisterWebhook(webhook); err != nil {
+		t.Fatal(err)
+	}
+	hash := string(webhook.Hash)
+	if _, _, _, err := s.storage.WriteRow(hash, &model.Row{Headers: `{}`, Body: `{"type":"user"}`}, &model.Row{Headers: `{}`, Body: `{"type":"order"}`}); err != nil {
+		t.Fatal(err)
+	}
+	webhook, batches, err := s.storage.Fetch(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, batches, 2) {
+		t.FailNow()
+	}
+	return webhook, batches
+}
+
+func TestTriggerAfterImport(t *testing.T) {
+	t.Parallel()
+	s, _, queueTransport := testService(t)
+	queueTransport.RegisterResponder("POST", `=~/jobs$`, httpmock.NewJsonResponderOrPanic(201, map[string]interface{}{"id": "1001", "status": "created"}))
+	webhook, batches := testImport(t, s, 0)
+
+	// The first batch is imported, the import is not finished
+	assert.NoError(t, s.storage.FinishBatch(batches[0], 1, nil))
+	s.triggerAfterImports(webhook, batches[:1])
+	assert.Equal(t, 0, queueTransport.GetTotalCallCount())
+
+	// All batches are imported, the job is created
+	assert.NoError(t, s.storage.FinishBatch(batches[1], 2, nil))
+	s.triggerAfterImports(webhook, batches[1:])
+	assert.Equal(t, 1, queueTransport.GetTotalCallCount())
+
+	// The result is stored
+	stored, err := s.storage.FetchBatches(batches[0].FetchId)
+	assert.NoError(t, err)
+	for _, batch := range stored {
+		assert.Equal(t, model.TriggerStatusTriggered, batch.TriggerStatus)
+		assert.Equal(t, "1001", batch.TriggerJobId)
+	}
+	updated, err := s.storage.Get(string(webhook.Hash))
+	assert.NoError(t, err)
+	assert.NotNil(t, updated.Trigger.LastAt)
+
+	// The import is processed once
+	s.triggerAfterImports(webhook, batches)
+	assert.Equal(t, 1, queueTransport.GetTotalCallCount())
+}
+
+func TestTriggerAfterImportFailedBatch(t *testing.T) {
+	t.Parallel()
+	s, _, queueTransport := testService(t)
+	queueTransport.RegisterResponder("POST", `=~/jobs$`, httpmock.NewJsonResponderOrPanic(201, map[string]interface{}{"id": "1001", "status": "created"}))
+	webhook, batches := testImport(t, s, 0)
+
+	// One batch failed, the job is skipped, so it doesn't process partial data
+	assert.NoError(t, s.storage.FinishBatch(batches[0], 1, nil))
+	assert.NoError(t, s.storage.FinishBatch(batches[1], 0, errors.New("access denied")))
+	s.triggerAfterImports(webhook, batches)
+	assert.Equal(t, 0, queueTransport.GetTotalCallCount())
+
+	stored, err := s.storage.FetchBatches(batches[0].FetchId)
+	assert.NoError(t, err)
+	for _, batch := range stored {
+		assert.Equal(t, model.TriggerStatusSkipped, batch.TriggerStatus)
+		assert.Equal(t, `batches "`+batches[1].Id+`" of the import failed`, batch.TriggerError)
+	}
+	updated, err := s.storage.Get(string(webhook.Hash))
+	assert.NoError(t, err)
+	assert.Nil(t, updated.Trigger.LastAt)
+}
+
+func TestTriggerAfterImportMinInterval(t *testing.T) {
+	t.Parallel()
+	s, _, queueTransport := testService(t)
+	queueTransport.RegisterResponder("POST", `=~/jobs$`, httpmock.NewJsonResponderOrPanic(201, map[string]interface{}{"id": "1001", "status": "created"}))
+	webhook, batches := testImport(t, s, time.Hour)
+	lastAt := time.Now().Add(-time.Minute)
+	webhook.Trigger.LastAt = &lastAt
+
+	// The previous job has been created within the min interval
+	assert.NoError(t, s.storage.FinishBatch(batches[0], 1, nil))
+	assert.NoError(t, s.storage.FinishBatch(batches[1], 2, nil))
+	s.triggerAfterImports(webhook, batches)
+	assert.Equal(t, 0, queueTransport.GetTotalCallCount())
+
+	stored, err := s.storage.FetchBatches(batches[0].FetchId)
+	assert.NoError(t, err)
+	for _, batch := range stored {
+		assert.Equal(t, model.TriggerStatusSkipped, batch.TriggerStatus)
+		assert.Empty(t, batch.TriggerError)
+	}
+}
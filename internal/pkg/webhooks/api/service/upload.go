@@ -0,0 +1,222 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/keboola/temp-webhooks-api/internal/pkg/api/storageapi"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/filestorage"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/model"
+	"github.com/keboola/temp-webhooks-api/internal/pkg/storage"
+)
+
+// SliceSize is the max uncompressed size of a slice in bytes.
+// A batch larger than the size is uploaded as a sliced file.
+const SliceSize = 64 * 1024 * 1024
+
+var errUploadStopped = errors.New("upload has been stopped")
+
+// uploadBatch streams gzipped rows, written by the write function, to a new file resource, the content is not buffered in a temp file.
+// Slices of a sliced file have no header, so the batch columns must be sent with the import.
+func (s *Service) uploadBatch(ctx context.Context, apiWithToken *storageapi.Api, webhook *model.Webhook, batch *model.Batch, write func(w storage.RowWriter) error) (model.FileResource, error) {
+	// Create file resource
+	name := fmt.Sprintf("webhook-%s.csv.gz", webhook.Hash)
+	sliced := batch.Size > SliceSize
+	var fileResource model.FileResource
+	err := s.callApi(webhook, func() (err error) {
+		if sliced {
+			fileResource, err = apiWithToken.CreateSlicedFileResource(name)
+		} else {
+			fileResource, err = apiWithToken.CreateFileResource(name)
+		}
+		return err
+	})
+	if err != nil {
+		return fileResource, fmt.Errorf(`cannot create file resource: %w`, err)
+	}
+	fileResource.IsSliced = sliced
+
+	// Stream rows to the file storage, the timeout is scaled by the batch size.
+	// The upload is cancelled, if the import doesn't finish in the shutdown timeout, see Service.Shutdown,
+	// or if the import lease is lost, see Service.holdLeases.
+	ctx, cancel := context.WithTimeout(ctx, filestorage.Timeout(batch.Size))
+	defer cancel()
+	writer := newSliceWriter(batch.Columns, sliced, func(r io.Reader, sliceName string) error {
+		return filestorage.UploadSlice(ctx, r, fileResource, sliceName)
+	})
+	if err := write(writer); err != nil {
+		writer.Abort(err)
+		return fileResource, fmt.Errorf(`cannot upload file: %w`, err)
+	}
+	sliceNames, err := writer.Close()
+	if err != nil {
+		return fileResource, fmt.Errorf(`cannot upload file: %w`, err)
+	}
+
+	// Manifest makes the slices visible as one file
+	if sliced {
+		if err := filestorage.UploadManifest(ctx, fileResource, sliceNames); err != nil {
+			return fileResource, fmt.Errorf(`cannot upload manifest: %w`, err)
+		}
+		s.logger.Infof(`uploaded %d slices of file "%d"`, len(sliceNames), fileResource.Id)
+	}
+	return fileResource, nil
+}
+
+// sliceWriter writes CSV records gzipped to the upload.
+// If the file is sliced, the header is omitted and a new slice is started when the uncompressed size reaches SliceSize.
+type sliceWriter struct {
+	header     []string
+	sliced     bool
+	sliceSize  int
+	upload     func(r io.Reader, sliceName string) error
+	sliceNames []string
+	slice      *pipeUpload
+	name       string
+	gzip       *gzip.Writer
+	counter    *countingWriter
+	csv        *csv.Writer
+}
+
+func newSliceWriter(header []string, sliced bool, upload func(r io.Reader, sliceName string) error) *sliceWriter {
+	return &sliceWriter{header: header, sliced: sliced, sliceSize: SliceSize, upload: upload}
+}
+
+func (w *sliceWriter) Write(record []string) error {
+	if w.slice == nil {
+		if err := w.openSlice(); err != nil {
+			return err
+		}
+	}
+	if err := w.csv.Write(record); err != nil {
+		return w.fail(err)
+	}
+	if w.sliced && w.counter.size >= w.sliceSize {
+		return w.closeSlice()
+	}
+	return nil
+}
+
+// Close finishes the last slice, waits for the upload and returns names of the uploaded slices.
+// At least one slice is always uploaded, so an empty batch creates a valid file.
+func (w *sliceWriter) Close() ([]string, error) {
+	if w.slice == nil && len(w.sliceNames) == 0 {
+		if err := w.openSlice(); err != nil {
+			return nil, err
+		}
+	}
+	if w.slice != nil {
+		if err := w.closeSlice(); err != nil {
+			return nil, err
+		}
+	}
+	return w.sliceNames, nil
+}
+
+// Abort stops the current upload, the file resource remains incomplete.
+func (w *sliceWriter) Abort(err error) {
+	if w.slice != nil {
+		w.slice.Abort(err)
+		w.slice = nil
+	}
+}
+
+func (w *sliceWriter) openSlice() error {
+	if w.sliced {
+		w.name = fmt.Sprintf("part%04d.csv.gz", len(w.sliceNames)+1)
+	}
+	name := w.name
+	w.slice = startUpload(func(r io.Reader) error {
+		return w.upload(r, name)
+	})
+	w.gzip = gzip.NewWriter(w.slice)
+	w.counter = &countingWriter{writer: w.gzip}
+	w.csv = csv.NewWriter(w.counter)
+	if !w.sliced {
+		if err := w.csv.Write(w.header); err != nil {
+			return w.fail(err)
+		}
+	}
+	return nil
+}
+
+func (w *sliceWriter) closeSlice() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return w.fail(err)
+	}
+	if err := w.gzip.Close(); err != nil {
+		return w.fail(err)
+	}
+	slice := w.slice
+	w.slice = nil
+	if err := slice.Close(); err != nil {
+		return err
+	}
+	w.sliceNames = append(w.sliceNames, w.name)
+	return nil
+}
+
+// fail stops the current upload. If the write failed because the upload has been stopped, the upload error is returned.
+func (w *sliceWriter) fail(err error) error {
+	slice := w.slice
+	w.slice = nil
+	if errors.Is(err, errUploadStopped) {
+		if uploadErr := slice.Close(); uploadErr != nil {
+			return uploadErr
+		}
+		return err
+	}
+	slice.Abort(err)
+	return err
+}
+
+// pipeUpload uploads the written content in the background.
+type pipeUpload struct {
+	writer *io.PipeWriter
+	errCh  chan error
+}
+
+func startUpload(upload func(r io.Reader) error) *pipeUpload {
+	reader, writer := io.Pipe()
+	u := &pipeUpload{writer: writer, errCh: make(chan error, 1)}
+	go func() {
+		err := upload(reader)
+		// Unblock the writer, if the upload has stopped reading
+		_ = reader.CloseWithError(errUploadStopped)
+		u.errCh <- err
+	}()
+	return u
+}
+
+func (u *pipeUpload) Write(p []byte) (int, error) {
+	return u.writer.Write(p)
+}
+
+// Close ends the content and waits for the upload.
+func (u *pipeUpload) Close() error {
+	_ = u.writer.Close()
+	return <-u.errCh
+}
+
+// Abort ends the content with the error and waits for the upload.
+func (u *pipeUpload) Abort(err error) {
+	_ = u.writer.CloseWithError(err)
+	<-u.errCh
+}
+
+// countingWriter counts the uncompressed size of a slice.
+type countingWriter struct {
+	writer io.Writer
+	size   int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.size += n
+	return n, err
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type uploadedSlices struct {
+	lock   sync.Mutex
+	slices map[string]string
+}
+
+func (u *uploadedSlices) upload(r io.Reader, sliceName string) error {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(gzipReader)
+	if err != nil {
+		return err
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.slices[sliceName] = string(data)
+	return nil
+}
+
+func TestSliceWriter(t *testing.T) {
+	t.Parallel()
+	uploaded := &uploadedSlices{slices: make(map[string]string)}
+	writer := newSliceWriter([]string{"id", "body"}, false, uploaded.upload)
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, writer.Write([]string{"123", "foo"}))
+	}
+	sliceNames, err := writer.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, sliceNames)
+	assert.Equal(t, map[string]string{"": "id,body\n" + strings.Repeat("123,foo\n", 1000)}, uploaded.slices)
+}
+
+func TestSliceWriterEmpty(t *testing.T) {
+	t.Parallel()
+	uploaded := &uploadedSlices{slices: make(map[string]string)}
+	writer := newSliceWriter([]string{"id", "body"}, false, uploaded.upload)
+	sliceNames, err := writer.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, sliceNames)
+	assert.Equal(t, map[string]string{"": "id,body\n"}, uploaded.slices)
+}
+
+func TestSliceWriterSliced(t *testing.T) {
+	t.Parallel()
+	uploaded := &uploadedSlices{slices: make(map[string]string)}
+	writer := newSliceWriter([]string{"id", "body"}, true, uploaded.upload)
+	writer.sliceSize = 10000
+	for i := 0; i < 3000; i++ {
+		assert.NoError(t, writer.Write([]string{"123", "foo"}))
+	}
+	sliceNames, err := writer.Close()
+	assert.NoError(t, err)
+	// The size is checked after the CSV buffer is flushed, so slices can be a little larger
+	assert.GreaterOrEqual(t, len(sliceNames), 2)
+	assert.Equal(t, "part0001.csv.gz", sliceNames[0])
+	assert.Equal(t, "part0002.csv.gz", sliceNames[1])
+	assert.Len(t, uploaded.slices, len(sliceNames))
+
+	// Slices have no header and they contain all rows
+	var content string
+	for _, sliceName := range sliceNames {
+		assert.NotContains(t, uploaded.slices[sliceName], "id,body")
+		content += uploaded.slices[sliceName]
+	}
+	assert.Equal(t, strings.Repeat("123,foo\n", 3000), content)
+}
+
+func TestSliceWriterUploadError(t *testing.T) {
+	t.Parallel()
+	writer := newSliceWriter([]string{"id", "body"}, false, func(r io.Reader, sliceName string) error {
+		_, _ = r.Read(make([]byte, 8))
+		return errors.New("access denied")
+	})
+
+	// The writer is blocked until the upload is stopped
+	var err error
+	for err == nil {
+		err = writer.Write([]string{"123", strings.Repeat("foo", 1000)})
+	}
+	assert.EqualError(t, err, "access denied")
+}
+
+func TestSliceWriterAbort(t *testing.T) {
+	t.Parallel()
+	var uploadErr error
+	writer := newSliceWriter([]string{"id", "body"}, false, func(r io.Reader, sliceName string) error {
+		_, uploadErr = io.ReadAll(r)
+		return uploadErr
+	})
+	assert.NoError(t, writer.Write([]string{"123", "foo"}))
+	writer.Abort(errors.New("connection lost"))
+	assert.EqualError(t, uploadErr, "connection lost")
+}